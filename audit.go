@@ -0,0 +1,212 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry records who changed what and when.
+type AuditEntry struct {
+	Time       time.Time              `json:"time" bson:"time"`
+	RequestID  string                 `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	Actor      string                 `json:"actor,omitempty" bson:"actor,omitempty"`
+	Tenant     string                 `json:"tenant,omitempty" bson:"tenant,omitempty"`
+	Method     string                 `json:"method" bson:"method"`
+	Route      string                 `json:"route" bson:"route"`
+	Path       string                 `json:"path" bson:"path"`
+	ResourceID string                 `json:"resource_id,omitempty" bson:"resource_id,omitempty"`
+	Status     int                    `json:"status" bson:"status"`
+	RemoteIP   string                 `json:"remote_ip,omitempty" bson:"remote_ip,omitempty"`
+	Before     map[string]interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	Changes    map[string]interface{} `json:"changes,omitempty" bson:"changes,omitempty"`
+	body       map[string]interface{}
+	redact     []string
+	dryRun     bool
+}
+
+type AuditSink interface {
+	Write(ctx context.Context, entry AuditEntry) error
+}
+
+// AuditSinkFunc adapts a function, for example one producing to a Kafka topic, to AuditSink.
+type AuditSinkFunc func(ctx context.Context, entry AuditEntry) error
+
+func (self AuditSinkFunc) Write(ctx context.Context, entry AuditEntry) error {
+	return self(ctx, entry)
+}
+
+// StoreAuditSink inserts entries into store.
+func StoreAuditSink(store Store) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, entry AuditEntry) error {
+		return store.Insert(ctx, entry)
+	})
+}
+
+func MongoAuditSink(collection *mongo.Collection) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, entry AuditEntry) error {
+		_, err := collection.InsertOne(ctx, entry)
+		return err
+	})
+}
+
+// FileAuditSink appends entries to a file as JSON lines.
+type FileAuditSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+func (self *FileAuditSink) Write(ctx context.Context, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	_, err = self.file.Write(append(data, '\n'))
+	return err
+}
+
+func (self *FileAuditSink) Close() error {
+	return self.file.Close()
+}
+
+type AuditConfig struct {
+	Sink AuditSink
+	// Redact lists body fields, matched case-insensitively at any depth, that are redacted on top
+	// of DefaultRedaction. Routes add their own with WithAuditRedaction.
+	Redact []string
+	// ResourceParam names the path param holding the resource id, "id" when empty.
+	ResourceParam string
+	// IncludeFailures also records requests answered with a 4xx or 5xx.
+	IncludeFailures bool
+}
+
+func AuditFromContext(ctx context.Context) *AuditEntry {
+	entry, _ := ctx.Value(AuditKey).(*AuditEntry)
+	return entry
+}
+
+// SetAuditBefore records the state of the resource before the change, so the entry keeps only
+// the fields the request changed. Handlers that create resources can set ResourceID through
+// AuditFromContext instead.
+func SetAuditBefore(r *http.Request, before interface{}) {
+	entry := AuditFromContext(r.Context())
+	if entry == nil {
+		return
+	}
+	if values, ok := before.(map[string]interface{}); ok {
+		entry.Before = values
+		return
+	}
+	data, err := json.Marshal(before)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &entry.Before)
+}
+
+// WithAuditRedaction adds fields to the redacted ones of the route, next to the VMap that
+// validates them.
+func WithAuditRedaction(fields ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if entry := AuditFromContext(r.Context()); entry != nil {
+				entry.redact = append(entry.redact, fields...)
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func (self *AuditEntry) finish(redaction *Redaction) {
+	changes := self.body
+	if self.Before != nil && changes != nil {
+		// The body of a PATCH holds only the fields it changes, so removed fields are not
+		// reported.
+		diff := Diff(self.Before, changes)
+		changed := diff.Set()
+		before := map[string]interface{}{}
+		for path, change := range diff.Changed {
+			before[path] = change.Old
+		}
+		changes, self.Before = changed, before
+	}
+	if self.Before != nil {
+		self.Before, _ = redaction.Value(self.Before).(map[string]interface{})
+	}
+	if changes != nil {
+		self.Changes, _ = redaction.Value(changes).(map[string]interface{})
+	}
+}
+
+// AuditMiddlewareFactory writes an AuditEntry to config.Sink for every successful POST, PUT,
+// PATCH and DELETE that is not a DryRun. The actor comes from the auth middleware, which must
+// run first, and the changes from the body validated by WithBody. Added to routes rather than
+// with Router.Use, entries carry the route pattern instead of the path.
+func AuditMiddlewareFactory(config AuditConfig) func(http.Handler) http.Handler {
+	param := config.ResourceParam
+	if param == "" {
+		param = "id"
+	}
+	return func(next http.Handler) http.Handler {
+		var route string
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+			entry := &AuditEntry{
+				Time:      time.Now().UTC(),
+				RequestID: GetRequestID(r),
+				Method:    r.Method,
+				Route:     route,
+				Path:      r.URL.Path,
+				RemoteIP:  ClientIP(r),
+			}
+			if entry.Route == "" {
+				entry.Route = r.URL.Path
+			}
+			if identity := GetIdentity(r); identity != nil {
+				entry.Actor = identity.ID
+			}
+			if tenant := GetTenant(r); tenant != nil {
+				entry.Tenant = tenant.ID
+			}
+			recorder := NewResponseRecorder(w)
+			r = SetInContext(entry, AuditKey, r)
+			next.ServeHTTP(recorder, r)
+			entry.Status = recorder.Status
+			if entry.dryRun || DryRunFromContext(r.Context()) || entry.Status >= 400 && !config.IncludeFailures {
+				return
+			}
+			if entry.ResourceID == "" {
+				entry.ResourceID = ParamsFromContext(r.Context())[param]
+			}
+			entry.finish(DefaultRedaction.With(config.Redact...).With(entry.redact...))
+			if err := config.Sink.Write(context.WithoutCancel(r.Context()), *entry); err != nil {
+				LoggerFromContext(r.Context()).Log(ErrorLevel, "audit write failed", Fields{"error": err.Error()})
+			}
+		}
+
+		return describe(http.HandlerFunc(fn), func(described *Route) {
+			route = described.Path
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package httputils
+
+import (
+	"net/http"
+)
+
+type Identity struct {
+	ID          string   `json:"id"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+func (self *Identity) HasRole(role string) bool {
+	return contains(self.Roles, role)
+}
+
+func (self *Identity) HasPermission(permission string) bool {
+	return contains(self.Permissions, permission)
+}
+
+func SetIdentity(identity *Identity, req *http.Request) *http.Request {
+	return SetInContext(identity, IdentityKey, req)
+}
+
+func GetIdentity(r *http.Request) *Identity {
+	return IdentityFromContext(r.Context())
+}
+
+// RequireRole passes the request through when the identity has at least one of roles.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return requireIdentity(func(identity *Identity) bool {
+		for _, role := range roles {
+			if identity.HasRole(role) {
+				return true
+			}
+		}
+		return len(roles) == 0
+	}, func(route *Route) {
+		route.Roles = append(route.Roles, roles...)
+	})
+}
+
+// RequirePermission passes the request through only when the identity has every permission.
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return requireIdentity(func(identity *Identity) bool {
+		for _, permission := range permissions {
+			if !identity.HasPermission(permission) {
+				return false
+			}
+		}
+		return true
+	}, func(route *Route) {
+		route.Permissions = append(route.Permissions, permissions...)
+	})
+}
+
+func requireIdentity(allowed func(identity *Identity) bool, describeRoute func(route *Route)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			identity := GetIdentity(r)
+			if identity == nil {
+				HTTP401().Write(w)
+				return
+			}
+			if !allowed(identity) {
+				HTTP403().Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return describe(http.HandlerFunc(fn), describeRoute)
+	}
+}
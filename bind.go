@@ -0,0 +1,265 @@
+package httputils
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	objectIDType = reflect.TypeOf(bson.ObjectId(""))
+)
+
+// BindQuery fills the fields of the struct dest points to from path params and query values.
+// Fields are selected with a `query:"name"` tag; path params win over query values of the same
+// name. Supported types are strings, bools, ints, uints, floats, time.Time (RFC 3339),
+// time.Duration, bson.ObjectId, pointers to them, which stay nil when the value is absent, and
+// slices of them, read from repeated or comma separated values. A `default:"..."` tag applies
+// when the value is absent and a `validate:"..."` tag adds comma separated rules: required,
+// min=N, max=N (numeric bounds, or lengths for strings) and oneof=a|b|c.
+//
+// Conversion and validation failures are collected into a single 400 ServerError. Malformed
+// tags and unsupported field types return a plain error.
+func BindQuery(r *http.Request, dest interface{}) error {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("httputils: BindQuery needs a pointer to a struct, got %T", dest)
+	}
+	value = value.Elem()
+	params := Params(r)
+	query := r.URL.Query()
+	collector := NewErrorCollector()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := field.Tag.Get("query")
+		if key == "" || key == "-" || field.PkgPath != "" {
+			continue
+		}
+		var raw []string
+		if param, ok := params[key]; ok && param != "" {
+			raw = []string{param}
+		} else {
+			for _, item := range query[key] {
+				if item != "" {
+					raw = append(raw, item)
+				}
+			}
+		}
+		if len(raw) == 0 {
+			if def, ok := field.Tag.Lookup("default"); ok {
+				raw = []string{def}
+			}
+		}
+		rules, err := parseBindRules(field.Tag.Get("validate"))
+		if err != nil {
+			return fmt.Errorf("httputils: field %s: %v", field.Name, err)
+		}
+		if len(raw) == 0 {
+			if rules.required {
+				collector.AddErrors(Error{Key: key, Description: "Field is required", Code: CodeRequiredFieldError})
+			}
+			continue
+		}
+		converted, err := convertBindValue(field.Type, raw)
+		if typeError, ok := err.(bindTypeError); ok {
+			collector.AddErrors(Error{Key: key, Description: "Should be " + string(typeError), Code: CodeTypeError, Args: []string{string(typeError)}})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := rules.check(key, converted); err != nil {
+			collector.Merge(err)
+			continue
+		}
+		value.Field(i).Set(converted)
+	}
+	return collector.Err()
+}
+
+type bindTypeError string
+
+func (self bindTypeError) Error() string {
+	return string(self)
+}
+
+func convertBindValue(t reflect.Type, raw []string) (reflect.Value, error) {
+	switch {
+	case t.Kind() == reflect.Ptr:
+		elem, err := convertBindValue(t.Elem(), raw)
+		if err != nil {
+			return elem, err
+		}
+		pointer := reflect.New(t.Elem())
+		pointer.Elem().Set(elem)
+		return pointer, nil
+	case t.Kind() == reflect.Slice && t != objectIDType:
+		var items []string
+		for _, value := range raw {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		}
+		slice := reflect.MakeSlice(t, 0, len(items))
+		for _, item := range items {
+			elem, err := convertBindScalar(t.Elem(), item)
+			if err != nil {
+				return slice, err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		return slice, nil
+	}
+	return convertBindScalar(t, raw[0])
+}
+
+func convertBindScalar(t reflect.Type, raw string) (reflect.Value, error) {
+	value := reflect.New(t).Elem()
+	switch {
+	case t == objectIDType:
+		if !bson.IsObjectIdHex(raw) {
+			return value, bindTypeError("objectid")
+		}
+		value.Set(reflect.ValueOf(bson.ObjectIdHex(raw)))
+	case t == timeType:
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return value, bindTypeError("datetime")
+		}
+		value.Set(reflect.ValueOf(parsed))
+	case t == durationType:
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return value, bindTypeError("duration")
+		}
+		value.SetInt(int64(parsed))
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			value.SetString(raw)
+		case reflect.Bool:
+			parsed, err := strconv.ParseBool(raw)
+			if err != nil {
+				return value, bindTypeError("bool")
+			}
+			value.SetBool(parsed)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			parsed, err := strconv.ParseInt(raw, 10, t.Bits())
+			if err != nil {
+				return value, bindTypeError("int")
+			}
+			value.SetInt(parsed)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			parsed, err := strconv.ParseUint(raw, 10, t.Bits())
+			if err != nil {
+				return value, bindTypeError("int")
+			}
+			value.SetUint(parsed)
+		case reflect.Float32, reflect.Float64:
+			parsed, err := strconv.ParseFloat(raw, t.Bits())
+			if err != nil {
+				return value, bindTypeError("float")
+			}
+			value.SetFloat(parsed)
+		default:
+			return value, fmt.Errorf("httputils: BindQuery does not support fields of type %s", t)
+		}
+	}
+	return value, nil
+}
+
+type bindRules struct {
+	required bool
+	min      *float64
+	max      *float64
+	oneOf    []string
+}
+
+func parseBindRules(tag string) (bindRules, error) {
+	var rules bindRules
+	if tag == "" {
+		return rules, nil
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, argument, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			rules.required = true
+		case "min", "max":
+			bound, err := strconv.ParseFloat(argument, 64)
+			if err != nil {
+				return rules, fmt.Errorf("invalid %s rule %q", name, argument)
+			}
+			if name == "min" {
+				rules.min = &bound
+			} else {
+				rules.max = &bound
+			}
+		case "oneof":
+			rules.oneOf = strings.Split(argument, "|")
+		default:
+			return rules, fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+	return rules, nil
+}
+
+// check applies the rules to value, or to each element when value is a slice.
+func (self bindRules) check(key string, value reflect.Value) error {
+	if value.Kind() == reflect.Ptr {
+		return self.check(key, value.Elem())
+	}
+	if value.Kind() == reflect.Slice && value.Type() != objectIDType {
+		for i := 0; i < value.Len(); i++ {
+			if err := self.check(key, value.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(self.oneOf) > 0 {
+		if err := StringContainsValidator(key, self.oneOf)(fmt.Sprintf("%v", value.Interface())); err != nil {
+			return err
+		}
+	}
+	if self.min == nil && self.max == nil {
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		length := len(value.String())
+		meta := map[string]interface{}{"actual": length}
+		if self.min != nil {
+			meta["min"] = int(*self.min)
+		}
+		if self.max != nil {
+			meta["max"] = int(*self.max)
+		}
+		if (self.min != nil && float64(length) < *self.min) || (self.max != nil && float64(length) > *self.max) {
+			return Error{Key: key, Description: fmt.Sprintf("Invalid %s length", key), Code: CodeStringLengthError, Meta: meta}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int64InRangeValidator(key, Int64Range{int64Bound(self.max), int64Bound(self.min)})(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Int64InRangeValidator(key, Int64Range{int64Bound(self.max), int64Bound(self.min)})(int64(value.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return FloatInRangeValidator(key, FloatRange{self.max, self.min})(value.Float())
+	}
+	return nil
+}
+
+func int64Bound(bound *float64) *int64 {
+	if bound == nil {
+		return nil
+	}
+	value := int64(*bound)
+	return &value
+}
@@ -0,0 +1,28 @@
+package httputils
+
+import (
+	"net/http"
+)
+
+func HTTP413() ServerError {
+	return ServerError{413, Errors{[]Error{UndefinedKeyError(CodeRequestTooLarge, "Request body is too large")}}}
+}
+
+// BodyLimitMiddlewareFactory rejects bodies larger than limit bytes with a 413. Bodies without
+// a declared length are cut off at limit, which GetBody reports as a 413 as well.
+func BodyLimitMiddlewareFactory(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				HTTP413().Write(w)
+				return
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
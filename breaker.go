@@ -0,0 +1,238 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTP503CircuitOpen is returned without calling the service while the circuit of name is open.
+func HTTP503CircuitOpen(name string) ServerError {
+	return ServerError{503, Errors{[]Error{Error{Key: "undefined", Description: "Service is unavailable", Code: CodeCircuitOpen, Args: []string{name}}}}}
+}
+
+// ErrCircuitOpen matches the errors of every open circuit with errors.Is.
+var ErrCircuitOpen = HTTP503CircuitOpen("")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+var breakerStateNames = []string{"closed", "open", "half-open"}
+
+func (self BreakerState) String() string {
+	if self < BreakerClosed || self > BreakerHalfOpen {
+		return fmt.Sprintf("state(%d)", int(self))
+	}
+	return breakerStateNames[self]
+}
+
+type BreakerConfig struct {
+	// The circuit opens when at least MinRequests calls were made in Window and FailureRate of
+	// them failed.
+	MinRequests int
+	FailureRate float64
+	Window      time.Duration
+	// OpenTimeout is how long calls are refused before HalfOpenRequests trial calls are let
+	// through. The circuit closes when they all succeed and opens again on the first failure.
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	MinRequests:      20,
+	FailureRate:      0.5,
+	Window:           10 * time.Second,
+	OpenTimeout:      5 * time.Second,
+	HalfOpenRequests: 1,
+}
+
+type CircuitBreaker struct {
+	Name        string
+	config      BreakerConfig
+	mutex       sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trialsAt    time.Time
+	trials      int
+	successes   int
+}
+
+func NewCircuitBreaker(name string, config BreakerConfig) *CircuitBreaker {
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{Name: name, config: config, windowStart: time.Now()}
+}
+
+func (self *CircuitBreaker) State() BreakerState {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.advance(time.Now())
+	return self.state
+}
+
+func (self *CircuitBreaker) advance(now time.Time) {
+	if self.state == BreakerOpen && now.Sub(self.openedAt) >= self.config.OpenTimeout {
+		self.state, self.trialsAt, self.trials, self.successes = BreakerHalfOpen, now, 0, 0
+	}
+	// Trials whose outcome never came back, such as cancelled calls, are given up on after
+	// another OpenTimeout.
+	if self.state == BreakerHalfOpen && self.trials >= self.config.HalfOpenRequests &&
+		now.Sub(self.trialsAt) >= self.config.OpenTimeout {
+		self.trialsAt, self.trials, self.successes = now, 0, 0
+	}
+	if self.state == BreakerClosed && now.Sub(self.windowStart) >= self.config.Window {
+		self.windowStart, self.requests, self.failures = now, 0, 0
+	}
+}
+
+func (self *CircuitBreaker) open(now time.Time) {
+	self.state, self.openedAt = BreakerOpen, now
+	DefaultLogger.Log(WarnLevel, "circuit opened", Fields{"breaker": self.Name})
+}
+
+// Allow reserves a call, returning HTTP503CircuitOpen when the circuit refuses it. Otherwise
+// done must be called with the outcome of the call.
+func (self *CircuitBreaker) Allow() (done func(success bool), err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.advance(time.Now())
+	switch self.state {
+	case BreakerOpen:
+		return nil, HTTP503CircuitOpen(self.Name)
+	case BreakerHalfOpen:
+		if self.trials >= self.config.HalfOpenRequests {
+			return nil, HTTP503CircuitOpen(self.Name)
+		}
+		self.trials++
+	}
+	state := self.state
+	return func(success bool) {
+		self.record(state, success)
+	}, nil
+}
+
+func (self *CircuitBreaker) record(state BreakerState, success bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := time.Now()
+	if state != self.state {
+		return
+	}
+	switch state {
+	case BreakerHalfOpen:
+		if !success {
+			self.open(now)
+			return
+		}
+		self.successes++
+		if self.successes >= self.config.HalfOpenRequests {
+			self.state, self.windowStart, self.requests, self.failures = BreakerClosed, now, 0, 0
+		}
+	case BreakerClosed:
+		self.requests++
+		if !success {
+			self.failures++
+		}
+		if self.requests >= self.config.MinRequests && float64(self.failures)/float64(self.requests) >= self.config.FailureRate {
+			self.open(now)
+		}
+	}
+}
+
+// Execute calls fn unless the circuit is open, counting an error from fn as a failure.
+func (self *CircuitBreaker) Execute(fn func() error) error {
+	done, err := self.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err == nil)
+	return err
+}
+
+// CircuitBreakers keeps one CircuitBreaker per key, such as an upstream host.
+type CircuitBreakers struct {
+	config   BreakerConfig
+	mutex    sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func NewCircuitBreakers(config BreakerConfig) *CircuitBreakers {
+	return &CircuitBreakers{config: config, breakers: make(map[string]*CircuitBreaker)}
+}
+
+func (self *CircuitBreakers) For(key string) *CircuitBreaker {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	breaker, ok := self.breakers[key]
+	if !ok {
+		breaker = NewCircuitBreaker(key, self.config)
+		self.breakers[key] = breaker
+	}
+	return breaker
+}
+
+// States returns the state of every breaker by key.
+func (self *CircuitBreakers) States() map[string]BreakerState {
+	self.mutex.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(self.breakers))
+	for _, breaker := range self.breakers {
+		breakers = append(breakers, breaker)
+	}
+	self.mutex.Unlock()
+	states := make(map[string]BreakerState, len(breakers))
+	for _, breaker := range breakers {
+		states[breaker.Name] = breaker.State()
+	}
+	return states
+}
+
+// roundTrip sends req through the breaker of its host. Connection errors and 5xx responses
+// count as failures; requests cancelled by the caller are not counted either way.
+func (self *CircuitBreakers) roundTrip(transport http.RoundTripper, req *http.Request) (*http.Response, error) {
+	done, err := self.For(req.URL.Host).Allow()
+	if err != nil {
+		return nil, err
+	}
+	response, err := transport.RoundTrip(req)
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		return response, err
+	}
+	done(err == nil && response.StatusCode < 500)
+	return response, err
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (self roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return self(req)
+}
+
+type breakerTransport struct {
+	transport http.RoundTripper
+	breakers  *CircuitBreakers
+}
+
+func (self breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return self.breakers.roundTrip(self.transport, req)
+}
+
+// BreakerTransport guards transport with a circuit breaker per upstream host.
+func BreakerTransport(transport http.RoundTripper, breakers *CircuitBreakers) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return breakerTransport{transport, breakers}
+}
@@ -0,0 +1,114 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var duplicateKeyRegexp = regexp.MustCompile(`dup key: \{ ?"?([^:"]+)"?:`)
+
+// duplicateKeyField returns the field a duplicate key message names, or "undefined".
+func duplicateKeyField(message string) string {
+	if match := duplicateKeyRegexp.FindStringSubmatch(message); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return "undefined"
+}
+
+// MongoUpsertOne updates the document filter matches or inserts one, returning the id of the
+// inserted document or nil when one was updated. An update without operators replaces the
+// document. Duplicate keys are answered with a 409 naming the field.
+func MongoUpsertOne(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}) (interface{}, error) {
+	operators := false
+	if values, ok := asDocument(update); ok {
+		for key := range values {
+			operators = operators || strings.HasPrefix(key, "$")
+		}
+	}
+	var result *mongo.UpdateResult
+	var err error
+	if operators {
+		result, err = collection.UpdateOne(ctx, driverFilter(filter), toDriver(update), options.Update().SetUpsert(true))
+	} else {
+		result, err = collection.ReplaceOne(ctx, driverFilter(filter), toDriver(update), options.Replace().SetUpsert(true))
+	}
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, HTTP409(duplicateKeyField(err.Error())).Wrap(err)
+		}
+		return nil, MongoError(err, filterID(filter))
+	}
+	return result.UpsertedID, nil
+}
+
+// bulkWriteError reports the failed writes of a bulk operation, one Error per document keyed by
+// its index. The status is 409 when every failure is a duplicate key and 500 otherwise.
+func bulkWriteError(err error) error {
+	var exception mongo.BulkWriteException
+	if !errors.As(err, &exception) {
+		return MongoError(err, nil)
+	}
+	if len(exception.WriteErrors) == 0 {
+		return Internal(err)
+	}
+	collector := NewErrorCollector().Status(409)
+	for _, writeError := range exception.WriteErrors {
+		index := strconv.Itoa(writeError.Index)
+		meta := map[string]interface{}{"index": writeError.Index}
+		if mongo.IsDuplicateKeyError(writeError.WriteError) {
+			meta["field"] = duplicateKeyField(writeError.Message)
+			collector.AddErrors(Error{Key: index, Description: "Value already exists", Code: CodeDuplicateValueError, Args: []string{index}, Meta: meta})
+		} else {
+			collector.Status(500)
+			collector.AddErrors(Error{Key: index, Description: "Write failed", Code: CodeInternalServerError, Args: []string{index}, Meta: meta})
+		}
+	}
+	return collector.ServerError().Wrap(err)
+}
+
+// MongoInsertMany inserts docs and returns the ids of those inserted. Unordered inserts go on
+// past failures, which are all reported by bulkWriteError while the ids of the other documents
+// are still returned.
+func MongoInsertMany(ctx context.Context, collection *mongo.Collection, docs []interface{}, ordered bool) ([]interface{}, error) {
+	converted := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		converted[i] = toDriver(doc)
+	}
+	result, err := collection.InsertMany(ctx, converted, options.InsertMany().SetOrdered(ordered))
+	if err == nil {
+		return result.InsertedIDs, nil
+	}
+	var exception mongo.BulkWriteException
+	var inserted []interface{}
+	if result != nil && errors.As(err, &exception) {
+		failed := make(map[int]bool)
+		for _, writeError := range exception.WriteErrors {
+			failed[writeError.Index] = true
+		}
+		last := len(result.InsertedIDs)
+		if ordered && len(exception.WriteErrors) > 0 {
+			last = exception.WriteErrors[0].Index
+		}
+		for i, id := range result.InsertedIDs {
+			if i < last && !failed[i] {
+				inserted = append(inserted, id)
+			}
+		}
+	}
+	return inserted, bulkWriteError(err)
+}
+
+// MongoBulkWrite runs models, reporting per-model failures like MongoInsertMany. The result
+// counts the writes that succeeded.
+func MongoBulkWrite(ctx context.Context, collection *mongo.Collection, models []mongo.WriteModel, ordered bool) (*mongo.BulkWriteResult, error) {
+	result, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(ordered))
+	if err != nil {
+		return result, bulkWriteError(err)
+	}
+	return result, nil
+}
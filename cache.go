@@ -0,0 +1,183 @@
+package httputils
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"sync"
+	"time"
+)
+
+var ErrCacheMiss = errors.New("httputils: cache miss")
+
+// Cache stores byte values with a time to live. Get returns ErrCacheMiss for missing and
+// expired keys. A ttl of 0 keeps the value until it is evicted or deleted.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheAdder is implemented by caches that can atomically set a key only when it is missing,
+// as needed to use something exactly once across concurrent requests.
+type CacheAdder interface {
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// MemoryCache is a Cache held in process memory that evicts the least recently used keys
+// beyond its capacity.
+type MemoryCache struct {
+	mutex    sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{capacity: capacity, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (self *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	element, ok := self.entries[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		self.order.Remove(element)
+		delete(self.entries, key)
+		return nil, ErrCacheMiss
+	}
+	self.order.MoveToFront(element)
+	return entry.value, nil
+}
+
+func (self *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.set(key, value, ttl)
+	return nil
+}
+
+// Add sets key unless it holds a value that has not expired, reporting whether it did.
+func (self *MemoryCache) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if element, ok := self.entries[key]; ok {
+		entry := element.Value.(*memoryCacheEntry)
+		if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+			return false, nil
+		}
+	}
+	self.set(key, value, ttl)
+	return true, nil
+}
+
+func (self *MemoryCache) set(key string, value []byte, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	if element, ok := self.entries[key]; ok {
+		element.Value = &memoryCacheEntry{key, value, expires}
+		self.order.MoveToFront(element)
+		return
+	}
+	self.entries[key] = self.order.PushFront(&memoryCacheEntry{key, value, expires})
+	for self.capacity > 0 && self.order.Len() > self.capacity {
+		oldest := self.order.Back()
+		self.order.Remove(oldest)
+		delete(self.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+func (self *MemoryCache) Delete(ctx context.Context, key string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if element, ok := self.entries[key]; ok {
+		self.order.Remove(element)
+		delete(self.entries, key)
+	}
+	return nil
+}
+
+func (self *MemoryCache) Len() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.order.Len()
+}
+
+type RedisCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisCache(client redis.UniversalClient, prefix string) *RedisCache {
+	return &RedisCache{client, prefix}
+}
+
+func (self *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := self.client.Get(ctx, self.prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	return data, err
+}
+
+func (self *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return self.client.Set(ctx, self.prefix+key, value, ttl).Err()
+}
+
+func (self *RedisCache) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return self.client.SetNX(ctx, self.prefix+key, value, ttl).Result()
+}
+
+func (self *RedisCache) Delete(ctx context.Context, key string) error {
+	return self.client.Del(ctx, self.prefix+key).Err()
+}
+
+// GetJSON decodes the value cached under key into dest, returning ErrCacheMiss when there is none.
+func GetJSON(ctx context.Context, cache Cache, key string, dest interface{}) error {
+	data, err := cache.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func SetJSON(ctx context.Context, cache Cache, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return cache.Set(ctx, key, data, ttl)
+}
+
+// Remember fills dest from the cache, or on a miss with load, caching what load produced for
+// ttl. Cache failures are logged and fall back to load.
+func Remember(ctx context.Context, cache Cache, key string, ttl time.Duration, dest interface{}, load func(ctx context.Context) error) error {
+	err := GetJSON(ctx, cache, key, dest)
+	if err == nil {
+		return nil
+	}
+	if err != ErrCacheMiss {
+		LoggerFromContext(ctx).Log(WarnLevel, "cache read failed", Fields{"key": key, "error": err.Error()})
+	}
+	if err := load(ctx); err != nil {
+		return err
+	}
+	if err := SetJSON(ctx, cache, key, dest, ttl); err != nil {
+		LoggerFromContext(ctx).Log(WarnLevel, "cache write failed", Fields{"key": key, "error": err.Error()})
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client calls services built on this package. Non-2xx responses are decoded back into a
+// ServerError, so they can be inspected with errors.Is or written on with WriteError.
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	// Header is sent with every request.
+	Header http.Header
+	// Retries is how many more times idempotent requests are sent after a connection error or a
+	// 429, 502, 503 or 504 response. The wait starts at RetryBackoff and grows as RetryPolicy,
+	// whose Attempts and Backoff are ignored, describes.
+	Retries      int
+	RetryBackoff time.Duration
+	RetryPolicy  RetryPolicy
+	// Breakers stops calling hosts that keep failing, answering HTTP503CircuitOpen instead.
+	Breakers *CircuitBreakers
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{HTTPClient: http.DefaultClient, BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Header: http.Header{}, RetryBackoff: 100 * time.Millisecond,
+		RetryPolicy: DefaultRetryPolicy, Breakers: NewCircuitBreakers(DefaultBreakerConfig)}
+}
+
+// Do sends body encoded as JSON, unless it is nil, and decodes a 2xx response into result,
+// unless it is nil. The request id stored in ctx is forwarded in X-Request-ID.
+func (self *Client) Do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	response, err := self.send(ctx, method, path, payload)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return DecodeServerError(response)
+	}
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+func (self *Client) send(ctx context.Context, method string, path string, payload []byte) (*http.Response, error) {
+	policy := self.RetryPolicy
+	policy.Attempts = self.Retries + 1
+	policy.Backoff = self.RetryBackoff
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		policy.Attempts = 1
+	}
+	var response *http.Response
+	err := Retry(ctx, policy, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, method, self.BaseURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return Permanent(err)
+		}
+		for key, values := range self.Header {
+			req.Header[key] = append([]string(nil), values...)
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", "application/json")
+		if id := RequestIDFromContext(ctx); id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		response, err = self.do(req)
+		if err != nil || policy.Attempts == 1 {
+			return err
+		}
+		switch response.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			defer response.Body.Close()
+			err, response = DecodeServerError(response), nil
+			return err
+		}
+		return nil
+	})
+	return response, err
+}
+
+func (self *Client) do(req *http.Request) (*http.Response, error) {
+	if self.Breakers == nil {
+		return self.HTTPClient.Do(req)
+	}
+	return self.Breakers.roundTrip(roundTripperFunc(self.HTTPClient.Do), req)
+}
+
+func (self *Client) Get(ctx context.Context, path string, query url.Values, result interface{}) error {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return self.Do(ctx, http.MethodGet, path, nil, result)
+}
+
+func (self *Client) Post(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return self.Do(ctx, http.MethodPost, path, body, result)
+}
+
+func (self *Client) Put(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return self.Do(ctx, http.MethodPut, path, body, result)
+}
+
+func (self *Client) Patch(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return self.Do(ctx, http.MethodPatch, path, body, result)
+}
+
+func (self *Client) Delete(ctx context.Context, path string, result interface{}) error {
+	return self.Do(ctx, http.MethodDelete, path, nil, result)
+}
+
+// DecodeServerError rebuilds the ServerError written by JSONErrorSerializer or
+// ProblemSerializer. Other bodies become a single error with the response status.
+func DecodeServerError(response *http.Response) ServerError {
+	data, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	var payload struct {
+		Errors []Error `json:"errors"`
+		Code   string  `json:"code"`
+		Detail string  `json:"detail"`
+	}
+	if json.Unmarshal(data, &payload) == nil {
+		if len(payload.Errors) > 0 {
+			return ServerError{response.StatusCode, Errors{payload.Errors}}
+		}
+		if payload.Code != "" {
+			return ServerError{response.StatusCode, Errors{[]Error{UndefinedKeyError(payload.Code, payload.Detail)}}}
+		}
+	}
+	code := CodeBadGateway
+	if response.StatusCode < 500 {
+		code = CodeInvalidRequest
+	}
+	return ServerError{response.StatusCode, Errors{[]Error{UndefinedKeyError(code, http.StatusText(response.StatusCode))}}}
+}
@@ -0,0 +1,99 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CoalesceKey identifies identical requests by method, path, query and the ID of the
+// authenticated identity, so users never share each other's responses. When no identity is set,
+// as when coalescing runs before authentication, a hash of the Authorization and Cookie headers
+// stands in for it.
+func CoalesceKey(r *http.Request) string {
+	key := r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+	if identity := GetIdentity(r); identity != nil {
+		return key + " " + identity.ID
+	}
+	authorization, cookie := r.Header.Values("Authorization"), r.Header.Values("Cookie")
+	if len(authorization) > 0 || len(cookie) > 0 {
+		sum := sha256.Sum256([]byte(strings.Join(authorization, "\n") + "\x00" + strings.Join(cookie, "\n")))
+		key += " " + hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+type coalescedResponse struct {
+	header http.Header
+	code   int
+	body   []byte
+}
+
+type coalesceResponseWriter struct {
+	http.ResponseWriter
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (self *coalesceResponseWriter) Header() http.Header {
+	return self.header
+}
+
+func (self *coalesceResponseWriter) WriteHeader(code int) {
+	if self.code == 0 {
+		self.code = code
+	}
+}
+
+func (self *coalesceResponseWriter) Write(data []byte) (int, error) {
+	if self.code == 0 {
+		self.code = http.StatusOK
+	}
+	return self.body.Write(data)
+}
+
+func (self *coalesceResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+// CoalesceMiddlewareFactory runs concurrent GET and HEAD requests with the same key only once,
+// sending every waiting client a copy of the response. A nil key uses CoalesceKey. The handler
+// keeps running when the client that started it goes away, and its output is buffered, so it
+// must not stream.
+func CoalesceMiddlewareFactory(key KeyFunc) func(http.Handler) http.Handler {
+	if key == nil {
+		key = CoalesceKey
+	}
+	group := &singleflight.Group{}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			result, _, _ := group.Do(key(r), func() (interface{}, error) {
+				buffer := &coalesceResponseWriter{ResponseWriter: w, header: http.Header{}}
+				next.ServeHTTP(buffer, r.WithContext(context.WithoutCancel(r.Context())))
+				if buffer.code == 0 {
+					buffer.code = http.StatusOK
+				}
+				return coalescedResponse{buffer.header, buffer.code, buffer.body.Bytes()}, nil
+			})
+			response := result.(coalescedResponse)
+			header := w.Header()
+			for name, values := range response.header {
+				header[name] = append([]string(nil), values...)
+			}
+			w.WriteHeader(response.code)
+			w.Write(response.body)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
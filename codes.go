@@ -0,0 +1,146 @@
+package httputils
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	CodeRequiredFieldError      = "REQUIRED_FIELD_ERROR"
+	CodeTypeError               = "TYPE_ERROR"
+	CodeFloatRangeError         = "FLOAT_RANGE_ERROR"
+	CodeIntRangeError           = "INT_RANGE_ERROR"
+	CodeStringLengthError       = "STRING_LENGTH_ERROR"
+	CodeInvalidLanguageError    = "INVALID_LANGUAGE_ERROR"
+	CodeInvalidURLError         = "INVALID_URL_ERROR"
+	CodeInvalidTimezoneError    = "INVALID_TIMEZONE_ERROR"
+	CodeInvalidDatetimeError    = "INVALID_DATETIME_ERROR"
+	CodeInvalidCountryError     = "INVALID_COUNTRY_ERROR"
+	CodeInvalidRequest          = "INVALID_REQUEST"
+	CodeUnauthorized            = "UNAUTHORIZED"
+	CodePermissionDenied        = "PERMISSION_DENIED"
+	CodeItemNotFound            = "ITEM_NOT_FOUND"
+	CodeRouteNotFound           = "ROUTE_NOT_FOUND"
+	CodeMethodNotAllowed        = "METHOD_NOT_ALLOWED"
+	CodeTooManyRequests         = "TOO_MANY_REQUESTS"
+	CodeGatewayTimeout          = "GATEWAY_TIMEOUT"
+	CodeInternalServerError     = "INTERNAL_SERVER_ERROR"
+	CodeInvalidSignature        = "INVALID_SIGNATURE"
+	CodeInvalidCursor           = "INVALID_CURSOR"
+	CodeInvalidQueryError       = "INVALID_QUERY_ERROR"
+	CodeDuplicateValueError     = "DUPLICATE_VALUE_ERROR"
+	CodePreconditionFailed      = "PRECONDITION_FAILED"
+	CodePreconditionRequired    = "PRECONDITION_REQUIRED"
+	CodeBadGateway              = "BAD_GATEWAY"
+	CodeRequestTooLarge         = "REQUEST_TOO_LARGE"
+	CodeCircuitOpen             = "CIRCUIT_OPEN"
+	CodeServiceUnavailable      = "SERVICE_UNAVAILABLE"
+	CodeInvalidCoordinateError  = "INVALID_COORDINATE_ERROR"
+	CodeInvalidDecimalError     = "INVALID_DECIMAL_ERROR"
+	CodeInvalidCurrencyError    = "INVALID_CURRENCY_ERROR"
+	CodeInvalidSlugError        = "INVALID_SLUG_ERROR"
+	CodeInvalidUsernameError    = "INVALID_USERNAME_ERROR"
+	CodeInvalidBase64Error      = "INVALID_BASE64_ERROR"
+	CodeFileTooLargeError       = "FILE_TOO_LARGE_ERROR"
+	CodeInvalidFileTypeError    = "INVALID_FILE_TYPE_ERROR"
+	CodeUnsupportedMediaType    = "UNSUPPORTED_MEDIA_TYPE"
+	CodeInvalidPatchError       = "INVALID_PATCH_ERROR"
+	CodeInvalidReferenceError   = "INVALID_REFERENCE_ERROR"
+	CodeInvalidDeviceTokenError = "INVALID_DEVICE_TOKEN_ERROR"
+	CodeInvalidPhoneError       = "INVALID_PHONE_ERROR"
+	CodeInvalidOTPError         = "INVALID_OTP_ERROR"
+	CodeExpiredOTPError         = "EXPIRED_OTP_ERROR"
+	CodeAccountLocked           = "ACCOUNT_LOCKED"
+)
+
+type ErrorCode struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+var (
+	errorCodesMutex sync.RWMutex
+	errorCodes      = make(map[string]ErrorCode)
+)
+
+// RegisterErrorCode adds code to the registry and panics if it was already registered, so two
+// packages cannot silently give the same code different meanings.
+func RegisterErrorCode(code string, description string) {
+	errorCodesMutex.Lock()
+	defer errorCodesMutex.Unlock()
+	if _, ok := errorCodes[code]; ok {
+		panic(fmt.Sprintf("httputils: error code %q is already registered", code))
+	}
+	errorCodes[code] = ErrorCode{code, description}
+}
+
+func IsRegisteredErrorCode(code string) bool {
+	errorCodesMutex.RLock()
+	defer errorCodesMutex.RUnlock()
+	_, ok := errorCodes[code]
+	return ok
+}
+
+// ErrorCodes returns every registered code sorted by code. Codes built at runtime, such as the
+// INVALID_<KEY>_ERROR codes of StringContainsValidator, are not listed.
+func ErrorCodes() []ErrorCode {
+	errorCodesMutex.RLock()
+	defer errorCodesMutex.RUnlock()
+	codes := make([]ErrorCode, 0, len(errorCodes))
+	for _, code := range errorCodes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+	return codes
+}
+
+func init() {
+	RegisterErrorCode(CodeRequiredFieldError, "Field is required")
+	RegisterErrorCode(CodeTypeError, "Field has a wrong type")
+	RegisterErrorCode(CodeFloatRangeError, "Number is out of range")
+	RegisterErrorCode(CodeIntRangeError, "Integer is out of range")
+	RegisterErrorCode(CodeStringLengthError, "String is too short")
+	RegisterErrorCode(CodeInvalidLanguageError, "Invalid language code")
+	RegisterErrorCode(CodeInvalidURLError, "Invalid url")
+	RegisterErrorCode(CodeInvalidTimezoneError, "Invalid timezone")
+	RegisterErrorCode(CodeInvalidDatetimeError, "Invalid datetime")
+	RegisterErrorCode(CodeInvalidCountryError, "Invalid country code")
+	RegisterErrorCode(CodeInvalidRequest, "Request body could not be parsed")
+	RegisterErrorCode(CodeUnauthorized, "Authentication is required")
+	RegisterErrorCode(CodePermissionDenied, "Permission denied")
+	RegisterErrorCode(CodeItemNotFound, "Item not found")
+	RegisterErrorCode(CodeRouteNotFound, "Route not found")
+	RegisterErrorCode(CodeMethodNotAllowed, "Method not allowed")
+	RegisterErrorCode(CodeTooManyRequests, "Rate limit exceeded")
+	RegisterErrorCode(CodeGatewayTimeout, "Request timed out")
+	RegisterErrorCode(CodeInternalServerError, "Internal server error")
+	RegisterErrorCode(CodeInvalidSignature, "Request signature is invalid")
+	RegisterErrorCode(CodeInvalidCursor, "Pagination cursor is malformed")
+	RegisterErrorCode(CodeInvalidQueryError, "Sort or filter parameter is not allowed")
+	RegisterErrorCode(CodeDuplicateValueError, "Value must be unique")
+	RegisterErrorCode(CodePreconditionFailed, "Resource was modified since it was read")
+	RegisterErrorCode(CodePreconditionRequired, "If-Match header is required")
+	RegisterErrorCode(CodeBadGateway, "Upstream service failed")
+	RegisterErrorCode(CodeRequestTooLarge, "Request body is too large")
+	RegisterErrorCode(CodeCircuitOpen, "Upstream service is unavailable")
+	RegisterErrorCode(CodeServiceUnavailable, "Server is overloaded")
+	RegisterErrorCode(CodeInvalidCoordinateError, "Invalid coordinates")
+	RegisterErrorCode(CodeInvalidDecimalError, "Invalid decimal number")
+	RegisterErrorCode(CodeInvalidCurrencyError, "Invalid currency code")
+	RegisterErrorCode(CodeInvalidSlugError, "Invalid slug")
+	RegisterErrorCode(CodeInvalidUsernameError, "Username is not allowed")
+	RegisterErrorCode(CodeInvalidBase64Error, "Invalid base64 data")
+	RegisterErrorCode(CodeFileTooLargeError, "File is too large")
+	RegisterErrorCode(CodeInvalidFileTypeError, "File type is not allowed")
+	RegisterErrorCode(CodeUnsupportedMediaType, "Content type is not supported")
+	RegisterErrorCode(CodeInvalidPatchError, "Patch could not be applied")
+	RegisterErrorCode(CodeInvalidReferenceError, "Referenced item does not exist")
+	RegisterErrorCode(CodeInvalidDeviceTokenError, "Invalid push notification device token")
+	RegisterErrorCode(CodeInvalidPhoneError, "Invalid phone number")
+	RegisterErrorCode(CodeInvalidOTPError, "Verification code is wrong")
+	RegisterErrorCode(CodeExpiredOTPError, "Verification code expired or was not sent")
+	RegisterErrorCode(CodeAccountLocked, "Too many failed logins, account is temporarily locked")
+}
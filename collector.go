@@ -0,0 +1,69 @@
+package httputils
+
+import (
+	"errors"
+)
+
+// ErrorCollector accumulates field errors over several steps and turns them into a single
+// ServerError. The status defaults to 400 and only ever increases as errors are merged.
+type ErrorCollector struct {
+	status int
+	errors []Error
+}
+
+func NewErrorCollector() *ErrorCollector {
+	return &ErrorCollector{status: 400}
+}
+
+func (self *ErrorCollector) Add(key string, code string, description string, args ...string) *ErrorCollector {
+	return self.AddErrors(Error{Key: key, Description: description, Code: code, Args: args})
+}
+
+func (self *ErrorCollector) AddErrors(errs ...Error) *ErrorCollector {
+	self.errors = append(self.errors, errs...)
+	return self
+}
+
+// Merge adds the errors carried by err: the field errors of a ServerError (adopting its status
+// when higher), a single Error, or any other error as an internal error.
+func (self *ErrorCollector) Merge(err error) *ErrorCollector {
+	if err == nil {
+		return self
+	}
+	var serverError ServerError
+	var fieldError Error
+	switch {
+	case errors.As(err, &serverError):
+		self.Status(serverError.StatusCode)
+		self.AddErrors(serverError.Errors.Errors...)
+	case errors.As(err, &fieldError):
+		self.AddErrors(fieldError)
+	default:
+		self.Status(500)
+		self.AddErrors(HTTP500().Errors.Errors...)
+	}
+	return self
+}
+
+func (self *ErrorCollector) Status(code int) *ErrorCollector {
+	if code > self.status {
+		self.status = code
+	}
+	return self
+}
+
+func (self *ErrorCollector) HasErrors() bool {
+	return len(self.errors) > 0
+}
+
+func (self *ErrorCollector) ServerError() ServerError {
+	return ServerError{self.status, Errors{append([]Error{}, self.errors...)}}
+}
+
+// Err returns nil when nothing was collected, so it can be returned directly from a handler.
+func (self *ErrorCollector) Err() error {
+	if !self.HasErrors() {
+		return nil
+	}
+	return self.ServerError()
+}
@@ -0,0 +1,241 @@
+package httputils
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration read from strings such as "30s" in YAML, JSON and environment
+// variables.
+type Duration time.Duration
+
+func (self *Duration) UnmarshalText(text []byte) error {
+	d, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*self = Duration(d)
+	return nil
+}
+
+func (self Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(self).String()), nil
+}
+
+func (self *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+	return self.UnmarshalText([]byte(text))
+}
+
+type RateLimitConfig struct {
+	// Rate is the number of requests per second refilled into each client's bucket. Zero
+	// disables rate limiting.
+	Rate  float64 `yaml:"rate" json:"rate"`
+	Burst int     `yaml:"burst" json:"burst"`
+	// Key identifies clients: "ip" (the default), "api_key" or "header:<name>".
+	Key string `yaml:"key" json:"key"`
+}
+
+type Config struct {
+	// Secret enables AccessMiddlewareFactory when set.
+	Secret string `yaml:"secret" json:"secret"`
+	// TrustedProxies are the CIDRs whose forwarding headers RealIPMiddlewareFactory believes.
+	TrustedProxies []string        `yaml:"trusted_proxies" json:"trusted_proxies"`
+	CORS           *CORSConfig     `yaml:"cors" json:"cors"`
+	RateLimit      RateLimitConfig `yaml:"rate_limit" json:"rate_limit"`
+	Timeout        Duration        `yaml:"timeout" json:"timeout"`
+	// MaxBodySize is in bytes; zero means unlimited.
+	MaxBodySize int64  `yaml:"max_body_size" json:"max_body_size"`
+	LogLevel    string `yaml:"log_level" json:"log_level"`
+	// LogFormat is "text" (the default) or "json".
+	LogFormat string `yaml:"log_format" json:"log_format"`
+	// Production hides panic values from clients.
+	Production bool `yaml:"production" json:"production"`
+	// Maintenance answers every request with a 503.
+	Maintenance bool `yaml:"maintenance" json:"maintenance"`
+}
+
+// LoadConfig reads a YAML or JSON file, chosen by its extension, and then applies the
+// environment variables described in ConfigFromEnv.
+func LoadConfig(path string, envPrefix string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	case ".json":
+		err = json.Unmarshal(data, &config)
+	default:
+		err = fmt.Errorf("httputils: unsupported config format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return config, err
+	}
+	return config, ConfigFromEnv(envPrefix, &config)
+}
+
+// ConfigFromEnv overrides config with the variables that are set among <prefix>SECRET,
+// <prefix>TRUSTED_PROXIES and <prefix>CORS_ORIGINS (both comma separated), <prefix>RATE_LIMIT,
+// <prefix>RATE_BURST, <prefix>RATE_KEY, <prefix>TIMEOUT, <prefix>MAX_BODY_SIZE,
+// <prefix>LOG_LEVEL, <prefix>LOG_FORMAT, <prefix>PRODUCTION and <prefix>MAINTENANCE.
+func ConfigFromEnv(prefix string, config *Config) error {
+	env := func(name string) (string, bool) {
+		return os.LookupEnv(prefix + name)
+	}
+	if value, ok := env("SECRET"); ok {
+		config.Secret = value
+	}
+	if value, ok := env("TRUSTED_PROXIES"); ok {
+		config.TrustedProxies = strings.Split(value, ",")
+	}
+	if value, ok := env("CORS_ORIGINS"); ok {
+		if config.CORS == nil {
+			config.CORS = &CORSConfig{}
+		}
+		config.CORS.AllowedOrigins = strings.Split(value, ",")
+	}
+	if value, ok := env("RATE_LIMIT"); ok {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("httputils: %sRATE_LIMIT: %v", prefix, err)
+		}
+		config.RateLimit.Rate = rate
+	}
+	if value, ok := env("RATE_BURST"); ok {
+		burst, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("httputils: %sRATE_BURST: %v", prefix, err)
+		}
+		config.RateLimit.Burst = burst
+	}
+	if value, ok := env("RATE_KEY"); ok {
+		config.RateLimit.Key = value
+	}
+	if value, ok := env("TIMEOUT"); ok {
+		if err := config.Timeout.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("httputils: %sTIMEOUT: %v", prefix, err)
+		}
+	}
+	if value, ok := env("MAX_BODY_SIZE"); ok {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("httputils: %sMAX_BODY_SIZE: %v", prefix, err)
+		}
+		config.MaxBodySize = size
+	}
+	if value, ok := env("LOG_LEVEL"); ok {
+		config.LogLevel = value
+	}
+	if value, ok := env("LOG_FORMAT"); ok {
+		config.LogFormat = value
+	}
+	if value, ok := env("PRODUCTION"); ok {
+		production, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("httputils: %sPRODUCTION: %v", prefix, err)
+		}
+		config.Production = production
+	}
+	if value, ok := env("MAINTENANCE"); ok {
+		maintenance, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("httputils: %sMAINTENANCE: %v", prefix, err)
+		}
+		config.Maintenance = maintenance
+	}
+	return nil
+}
+
+// NewLogger builds the logger described by LogLevel and LogFormat, writing to stderr.
+func (self Config) NewLogger() (Logger, error) {
+	level := InfoLevel
+	if self.LogLevel != "" {
+		var err error
+		if level, err = ParseLevel(self.LogLevel); err != nil {
+			return nil, err
+		}
+	}
+	switch self.LogFormat {
+	case "", "text":
+		return &StdLogger{Level: level}, nil
+	case "json":
+		return NewJSONLogger(os.Stderr, level), nil
+	}
+	return nil, fmt.Errorf("httputils: unknown log format %q", self.LogFormat)
+}
+
+func (self RateLimitConfig) keyFunc() (KeyFunc, error) {
+	switch {
+	case self.Key == "" || self.Key == "ip":
+		return IPKey, nil
+	case self.Key == "api_key":
+		return APIKey, nil
+	case strings.HasPrefix(self.Key, "header:"):
+		return HeaderKey(strings.TrimPrefix(self.Key, "header:")), nil
+	}
+	return nil, fmt.Errorf("httputils: unknown rate limit key %q", self.Key)
+}
+
+// BuildMiddlewares assembles the stack described by config, outermost first: request id,
+// client IP resolution, logging, recovery, maintenance mode, CORS, body size limit, rate
+// limiting, secret check and timeout. Parts whose settings are empty are left out.
+func BuildMiddlewares(config Config) (func(http.Handler) http.Handler, error) {
+	logger, err := config.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParseCIDRs(config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	mws := []func(http.Handler) http.Handler{
+		RequestIDMiddleware,
+		RealIPMiddlewareFactory(config.TrustedProxies...),
+		LoggingMiddlewareFactory(logger),
+		RecoverMiddlewareFactory(RecoverConfig{Logger: logger, Production: config.Production}),
+	}
+	if config.Maintenance {
+		mws = append(mws, MaintenanceMiddleware)
+	}
+	if config.CORS != nil {
+		if err := config.CORS.validate(); err != nil {
+			return nil, err
+		}
+		mws = append(mws, CORSMiddlewareFactory(*config.CORS))
+	}
+	if config.MaxBodySize > 0 {
+		mws = append(mws, BodyLimitMiddlewareFactory(config.MaxBodySize))
+	}
+	if config.RateLimit.Rate > 0 {
+		key, err := config.RateLimit.keyFunc()
+		if err != nil {
+			return nil, err
+		}
+		burst := config.RateLimit.Burst
+		if burst <= 0 {
+			burst = int(config.RateLimit.Rate) + 1
+		}
+		mws = append(mws, RateLimitMiddlewareFactory(NewMemoryTokenBucket(config.RateLimit.Rate, burst), key))
+	}
+	if config.Secret != "" {
+		mws = append(mws, AccessMiddlewareFactory(config.Secret))
+	}
+	if config.Timeout > 0 {
+		mws = append(mws, TimeoutMiddlewareFactory(time.Duration(config.Timeout)))
+	}
+	return func(next http.Handler) http.Handler {
+		return chain(next, mws)
+	}, nil
+}
@@ -0,0 +1,84 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+)
+
+type ContextKey string
+
+const (
+	ParamsKey       = ContextKey("params")
+	IdentityKey     = ContextKey("identity")
+	RequestIDKey    = ContextKey("request_id")
+	LoggerKey       = ContextKey("logger")
+	DBSessionKey    = ContextKey("db_session")
+	SessionKey      = ContextKey("session")
+	ClientIPKey     = ContextKey("client_ip")
+	BodyKey         = ContextKey("body")
+	QueryKey        = ContextKey("query")
+	FeatureFlagsKey = ContextKey("feature_flags")
+	TenantKey       = ContextKey("tenant")
+	AuditKey        = ContextKey("audit")
+	LocaleKey       = ContextKey("locale")
+	DryRunKey       = ContextKey("dry_run")
+)
+
+// legacyParamsKey is the plain string key params were stored under before ParamsKey existed.
+//
+// Deprecated: read params with Params or ParamsFromContext.
+const legacyParamsKey = "params"
+
+func ParamsFromContext(ctx context.Context) map[string]string {
+	if params, ok := ctx.Value(ParamsKey).(map[string]string); ok {
+		return params
+	}
+	if params, ok := ctx.Value(legacyParamsKey).(map[string]string); ok {
+		return params
+	}
+	return map[string]string{}
+}
+
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(IdentityKey).(*Identity)
+	return identity
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// LoggerFromContext returns the request logger stored by the logging middleware, falling back
+// to DefaultLogger.
+func LoggerFromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(LoggerKey).(Logger); ok {
+		return logger
+	}
+	return DefaultLogger
+}
+
+func SetLogger(logger Logger, req *http.Request) *http.Request {
+	return SetInContext(logger, LoggerKey, req)
+}
+
+type fieldsLogger struct {
+	logger Logger
+	fields Fields
+}
+
+func (self fieldsLogger) Log(level Level, message string, fields Fields) {
+	merged := make(Fields, len(self.fields)+len(fields))
+	for key, value := range self.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	self.logger.Log(level, message, merged)
+}
+
+// WithFields returns a logger that adds fields to every entry.
+func WithFields(logger Logger, fields Fields) Logger {
+	return fieldsLogger{logger, fields}
+}
@@ -0,0 +1,162 @@
+package httputils
+
+import (
+	"context"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+const (
+	CreatedAtField = "created_at"
+	UpdatedAtField = "updated_at"
+	DeletedAtField = "deleted_at"
+)
+
+// scopeFilter adds the condition field == value to filter, keeping any condition filter already
+// has on field.
+func scopeFilter(filter interface{}, field string, value interface{}) interface{} {
+	switch typed := filter.(type) {
+	case nil:
+		return bson.M{field: value}
+	case bson.M:
+		return scopeFilter(map[string]interface{}(typed), field, value)
+	case map[string]interface{}:
+		scoped := make(bson.M, len(typed)+1)
+		for key, item := range typed {
+			scoped[key] = item
+		}
+		if _, ok := typed[field]; ok {
+			return bson.M{"$and": []interface{}{scoped, bson.M{field: value}}}
+		}
+		scoped[field] = value
+		return scoped
+	}
+	return bson.M{"$and": []interface{}{filter, bson.M{field: value}}}
+}
+
+func stampNow() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+type timestampStore struct {
+	Store
+}
+
+// TimestampStore sets created_at and updated_at on inserted map documents that do not have them,
+// and updated_at on every update: in $set for operator updates, on the document for
+// replacements, which keep the created_at of the document they replace. Other documents must
+// carry the fields themselves.
+func TimestampStore(store Store) Store {
+	return timestampStore{store}
+}
+
+func (self timestampStore) Insert(ctx context.Context, docs ...interface{}) error {
+	now := stampNow()
+	for _, doc := range docs {
+		if values, ok := asDocument(doc); ok {
+			if _, ok := values[CreatedAtField]; !ok {
+				values[CreatedAtField] = now
+			}
+			if _, ok := values[UpdatedAtField]; !ok {
+				values[UpdatedAtField] = now
+			}
+		}
+	}
+	return self.Store.Insert(ctx, docs...)
+}
+
+func (self timestampStore) Update(ctx context.Context, selector interface{}, update interface{}) error {
+	values, ok := asDocument(update)
+	if !ok {
+		return self.Store.Update(ctx, selector, update)
+	}
+	stamped := make(bson.M, len(values)+1)
+	operators := false
+	for key, value := range values {
+		stamped[key] = value
+		operators = operators || strings.HasPrefix(key, "$")
+	}
+	if !operators {
+		stamped[UpdatedAtField] = stampNow()
+		if _, ok := stamped[CreatedAtField]; !ok {
+			var current bson.M
+			if err := self.Store.Find(ctx, selector).One(&current); err == nil && current[CreatedAtField] != nil {
+				stamped[CreatedAtField] = current[CreatedAtField]
+			}
+		}
+		return self.Store.Update(ctx, selector, stamped)
+	}
+	set := bson.M{}
+	if current, ok := asDocument(values["$set"]); ok {
+		for key, value := range current {
+			set[key] = value
+		}
+	}
+	set[UpdatedAtField] = stampNow()
+	stamped["$set"] = set
+	return self.Store.Update(ctx, selector, stamped)
+}
+
+func (self timestampStore) withDeleted() Store {
+	return timestampStore{WithDeleted(self.Store)}
+}
+
+type softDeleteStore struct {
+	store Store
+}
+
+// SoftDeleteStore hides documents whose deleted_at is set: queries and updates only match live
+// documents, and Remove sets deleted_at instead of deleting. Use WithDeleted to reach deleted
+// documents and Restore to bring them back.
+func SoftDeleteStore(store Store) Store {
+	return softDeleteStore{store}
+}
+
+func (self softDeleteStore) Find(ctx context.Context, filter interface{}) Query {
+	return self.store.Find(ctx, scopeFilter(filter, DeletedAtField, nil))
+}
+
+func (self softDeleteStore) Insert(ctx context.Context, docs ...interface{}) error {
+	return self.store.Insert(ctx, docs...)
+}
+
+func (self softDeleteStore) Update(ctx context.Context, selector interface{}, update interface{}) error {
+	return self.store.Update(ctx, scopeFilter(selector, DeletedAtField, nil), update)
+}
+
+func (self softDeleteStore) Remove(ctx context.Context, selector interface{}) error {
+	return self.store.Update(ctx, scopeFilter(selector, DeletedAtField, nil), bson.M{"$set": bson.M{DeletedAtField: stampNow()}})
+}
+
+// deletedStore is implemented by the stores wrapping another one, such as TimestampStore and
+// TenantStore, which rebuild themselves around WithDeleted of the store they wrap.
+type deletedStore interface {
+	withDeleted() Store
+}
+
+// WithDeleted returns store without its SoftDeleteStore, keeping the stores wrapping it: its
+// queries also match deleted documents and its Remove deletes for good. Stores without soft
+// deletion are returned unchanged.
+func WithDeleted(store Store) Store {
+	switch typed := store.(type) {
+	case softDeleteStore:
+		return typed.store
+	case deletedStore:
+		return typed.withDeleted()
+	}
+	return store
+}
+
+// Restore clears deleted_at on the deleted document selector matches, returning ErrNotFound
+// when there is none.
+func Restore(ctx context.Context, store Store, selector interface{}) error {
+	deleted := scopeFilter(selector, DeletedAtField, bson.M{"$ne": nil})
+	return WithDeleted(store).Update(ctx, deleted, bson.M{"$unset": bson.M{DeletedAtField: ""}})
+}
+
+// ConventionStore applies the conventions shared by services using this package to store:
+// timestamps and soft deletion.
+func ConventionStore(store Store) Store {
+	return SoftDeleteStore(TimestampStore(store))
+}
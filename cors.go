@@ -0,0 +1,85 @@
+package httputils
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CORSConfig struct {
+	// AllowedOrigins lists exact origins; "*" allows any, and cannot be combined with
+	// AllowCredentials.
+	AllowedOrigins   []string `yaml:"allowed_origins" json:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods" json:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers" json:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers" json:"exposed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials" json:"allow_credentials"`
+	MaxAge           Duration `yaml:"max_age" json:"max_age"`
+}
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete}
+
+func (self CORSConfig) validate() error {
+	if self.AllowCredentials && contains(self.AllowedOrigins, "*") {
+		return errors.New("httputils: CORS credentials need explicit origins, not \"*\"")
+	}
+	return nil
+}
+
+// CORSMiddlewareFactory answers preflight requests with 204 and adds the CORS headers to
+// requests from allowed origins. Use it on the root router so preflights for any path are handled.
+// It panics when config allows credentials from any origin, which would let every site read
+// responses with the user's cookies.
+func CORSMiddlewareFactory(config CORSConfig) func(http.Handler) http.Handler {
+	if err := config.validate(); err != nil {
+		panic(err)
+	}
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	anyOrigin := contains(config.AllowedOrigins, "*")
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			if origin == "" || (!anyOrigin && !contains(config.AllowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if anyOrigin {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if config.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				if len(config.ExposedHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(config.AllowedHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				header.Set("Access-Control-Allow-Headers", requested)
+			}
+			if config.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(time.Duration(config.MaxAge).Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
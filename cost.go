@@ -0,0 +1,155 @@
+package httputils
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CostLimiter charges requests against a budget per key and window.
+type CostLimiter interface {
+	Charge(key string, cost int) (RateLimitResult, error)
+}
+
+// IdentityOrIPKey keys limits by the authenticated identity, falling back to ClientIP.
+func IdentityOrIPKey(r *http.Request) string {
+	if identity := GetIdentity(r); identity != nil {
+		return "identity:" + identity.ID
+	}
+	return "ip:" + ClientIP(r)
+}
+
+type costWindow struct {
+	used  int
+	start time.Time
+}
+
+// MemoryCostWindow gives every key budget units per fixed window.
+type MemoryCostWindow struct {
+	mutex     sync.Mutex
+	budget    int
+	window    time.Duration
+	windows   map[string]*costWindow
+	lastSweep time.Time
+}
+
+func NewMemoryCostWindow(budget int, window time.Duration) *MemoryCostWindow {
+	return &MemoryCostWindow{budget: budget, window: window, windows: make(map[string]*costWindow), lastSweep: time.Now()}
+}
+
+func (self *MemoryCostWindow) Charge(key string, cost int) (RateLimitResult, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(self.lastSweep) > self.window {
+		for k, w := range self.windows {
+			if now.Sub(w.start) > self.window {
+				delete(self.windows, k)
+			}
+		}
+		self.lastSweep = now
+	}
+
+	w, ok := self.windows[key]
+	if !ok || now.Sub(w.start) > self.window {
+		w = &costWindow{0, now}
+		self.windows[key] = w
+	}
+	result := RateLimitResult{Limit: self.budget}
+	if w.used+cost <= self.budget {
+		w.used += cost
+		result.Allowed = true
+	}
+	result.Remaining = self.budget - w.used
+	result.Reset = self.window - now.Sub(w.start)
+	return result, nil
+}
+
+var costWindowScript = redis.NewScript(`
+local cost = tonumber(ARGV[1])
+local budget = tonumber(ARGV[2])
+local used = redis.call("INCRBY", KEYS[1], cost)
+if used == cost then
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+end
+local allowed = 1
+if used > budget then
+	used = redis.call("DECRBY", KEYS[1], cost)
+	allowed = 0
+end
+return {allowed, budget - used, redis.call("PTTL", KEYS[1])}
+`)
+
+type RedisCostWindow struct {
+	client redis.UniversalClient
+	prefix string
+	budget int
+	window time.Duration
+}
+
+func NewRedisCostWindow(client redis.UniversalClient, prefix string, budget int, window time.Duration) *RedisCostWindow {
+	return &RedisCostWindow{client, prefix, budget, window}
+}
+
+func (self *RedisCostWindow) Charge(key string, cost int) (RateLimitResult, error) {
+	values, err := costWindowScript.Run(context.Background(), self.client, []string{self.prefix + key},
+		cost, self.budget, self.window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     self.budget,
+		Remaining: int(values[1]),
+		Reset:     time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// CostThrottle shares one budget per key between routes that each declare their cost.
+type CostThrottle struct {
+	limiter CostLimiter
+	key     KeyFunc
+}
+
+// NewCostThrottle charges against limiter by key, IdentityOrIPKey when nil, so the auth
+// middleware must run before the routes' Cost middlewares.
+func NewCostThrottle(limiter CostLimiter, key KeyFunc) *CostThrottle {
+	if key == nil {
+		key = IdentityOrIPKey
+	}
+	return &CostThrottle{limiter, key}
+}
+
+// Cost charges cost units per request to the route, answering 429 once the budget of the
+// window is spent. The X-Cost-* headers report the budget, what is left and when it resets.
+func (self *CostThrottle) Cost(cost int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			result, err := self.limiter.Charge(self.key(r), cost)
+			if err != nil {
+				LoggerFromContext(r.Context()).Log(ErrorLevel, "cost limiter failed", Fields{"error": err.Error()})
+				next.ServeHTTP(w, r)
+				return
+			}
+			reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+			w.Header().Set("X-Cost", strconv.Itoa(cost))
+			w.Header().Set("X-Cost-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("X-Cost-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("X-Cost-Reset", reset)
+			if !result.Allowed {
+				w.Header().Set("Retry-After", reset)
+				HTTP429().Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return describe(http.HandlerFunc(fn), func(route *Route) {
+			route.Cost += cost
+		})
+	}
+}
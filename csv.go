@@ -0,0 +1,259 @@
+package httputils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVRows streams export rows by calling write with each one, stopping at the first error
+// write returns. It lets CSVResponse write from a cursor without loading every row.
+type CSVRows func(write func(row interface{}) error) error
+
+// CSVFlushRows is how many rows CSVResponse writes between flushes.
+var CSVFlushRows = 100
+
+// csvFormulaPrefixes start cells that spreadsheets evaluate as formulas.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell formats value for a cell. Strings that a spreadsheet would run as a formula are
+// prefixed with a quote; numbers are not, so negative values stay numbers.
+func csvCell(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if typed != "" && strings.ContainsRune(csvFormulaPrefixes, rune(typed[0])) {
+			return "'" + typed
+		}
+		return typed
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(typed)
+	case time.Time:
+		return typed.Format(time.RFC3339)
+	case bson.ObjectId:
+		return typed.Hex()
+	case fmt.Stringer:
+		return csvCell(typed.String())
+	}
+	if _, ok := asDocument(value); ok {
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	if kind := reflect.ValueOf(value).Kind(); kind == reflect.Slice || kind == reflect.Array {
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+func csvRecord(row interface{}, headers []string) ([]string, error) {
+	if values, ok := row.([]string); ok {
+		record := make([]string, len(values))
+		for i, value := range values {
+			record[i] = csvCell(value)
+		}
+		return record, nil
+	}
+	if values, ok := row.([]interface{}); ok {
+		record := make([]string, len(values))
+		for i, value := range values {
+			record[i] = csvCell(value)
+		}
+		return record, nil
+	}
+	document, ok := asDocument(row)
+	if !ok {
+		return nil, fmt.Errorf("unsupported csv row %T", row)
+	}
+	record := make([]string, len(headers))
+	for i, header := range headers {
+		record[i] = csvCell(document[header])
+	}
+	return record, nil
+}
+
+func checkRows(rows interface{}) error {
+	if _, ok := rows.(CSVRows); ok || rows == nil || reflect.ValueOf(rows).Kind() == reflect.Slice {
+		return nil
+	}
+	return fmt.Errorf("unsupported rows %T", rows)
+}
+
+// eachRow calls write with the rows of a slice or CSVRows.
+func eachRow(rows interface{}, write func(row interface{}) error) error {
+	if source, ok := rows.(CSVRows); ok {
+		return source(write)
+	}
+	if rows == nil {
+		return nil
+	}
+	values := reflect.ValueOf(rows)
+	for i := 0; i < values.Len(); i++ {
+		if err := write(values.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CSVResponse writes rows as a CSV download whose first line is headers. Rows are documents,
+// whose values are read by header, or slices written as they are; rows may be a slice of them
+// or CSVRows. Rows are flushed as they are written, so an error after the first flush can only
+// end the response early: it is logged and returned.
+func CSVResponse(w http.ResponseWriter, rows interface{}, headers []string) error {
+	if err := checkRows(rows); err != nil {
+		writeMarshalError(w, err)
+		return err
+	}
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	writer := csv.NewWriter(w)
+	count := 0
+	write := func(row interface{}) error {
+		record, err := csvRecord(row, headers)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		if count++; count%CSVFlushRows == 0 {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return err
+			}
+			controller.Flush()
+		}
+		return nil
+	}
+	err := writer.Write(headers)
+	if err == nil {
+		err = eachRow(rows, write)
+	}
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		DefaultLogger.Log(ErrorLevel, "csv export failed", Fields{"error": err.Error(), "rows": count})
+	}
+	return err
+}
+
+type CSVOptions struct {
+	// Comma separates fields, ',' when zero.
+	Comma rune
+	// Infer converts "true", "false" and numbers, which FloatValidator and BoolValidator
+	// expect, as XMLOptions.Infer does. Otherwise every value is a string.
+	Infer bool
+	// MaxRows bounds the rows read, unbounded when zero.
+	MaxRows int
+	// MaxErrors stops reading once as many errors were found, 100 when zero.
+	MaxErrors int
+}
+
+// DefaultCSVOptions keeps every value a string, so codes and phone numbers keep their leading
+// zeros and plus signs. Set Infer for numeric and boolean columns.
+var DefaultCSVOptions = CSVOptions{}
+
+func csvRowError(row int, line int, description string) Error {
+	return Error{Key: "row", Description: description, Code: CodeInvalidRequest, Args: []string{strconv.Itoa(row)},
+		Meta: map[string]interface{}{"row": row, "line": line}}
+}
+
+// ParseCSV reads rows from reader, keyed by the header line, and validates each with
+// validatorMap. Empty cells are left out so required validators catch them. Errors are returned
+// together as a 400, each with the row number, counting from 1 after the header, and the line in
+// its Meta; malformed rows are reported under the key "row".
+func ParseCSV(reader io.Reader, validatorMap VMap, options CSVOptions) ([]map[string]interface{}, error) {
+	csvReader := csv.NewReader(reader)
+	if options.Comma != 0 {
+		csvReader.Comma = options.Comma
+	}
+	maxErrors := options.MaxErrors
+	if maxErrors == 0 {
+		maxErrors = 100
+	}
+	headers, err := csvReader.Read()
+	if err == io.EOF {
+		return []map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, csvReadError(err, 0)
+	}
+	for i, header := range headers {
+		headers[i] = strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))
+	}
+	rows := []map[string]interface{}{}
+	collector := NewErrorCollector().Status(400)
+	errorCount := 0
+	for row := 1; errorCount < maxErrors; row++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseError *csv.ParseError
+			if !errors.As(err, &parseError) {
+				return nil, csvReadError(err, row)
+			}
+			collector.AddErrors(csvRowError(row, parseError.StartLine, "Malformed row"))
+			errorCount++
+			continue
+		}
+		if options.MaxRows > 0 && row > options.MaxRows {
+			return nil, HTTP413()
+		}
+		line, _ := csvReader.FieldPos(0)
+		values := make(map[string]interface{}, len(headers))
+		for i, header := range headers {
+			if cell := strings.TrimSpace(record[i]); cell != "" {
+				if options.Infer {
+					values[header] = inferScalar(cell)
+				} else {
+					values[header] = cell
+				}
+			}
+		}
+		errs := ValidateMap(values, validatorMap)
+		for _, item := range errs {
+			collector.AddErrors(item.WithMeta("row", row).WithMeta("line", line))
+		}
+		errorCount += len(errs)
+		rows = append(rows, values)
+	}
+	if err := collector.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func csvReadError(err error, row int) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return HTTP413()
+	}
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return ServerError{400, Errors{[]Error{csvRowError(row, parseError.StartLine, "Malformed row")}}}
+	}
+	return HTTP400()
+}
+
+// GetCSVBody parses and validates the CSV body of req with DefaultCSVOptions.
+func GetCSVBody(req *http.Request, validatorMap VMap) ([]map[string]interface{}, error) {
+	defer req.Body.Close()
+	return ParseCSV(req.Body, validatorMap, DefaultCSVOptions)
+}
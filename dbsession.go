@@ -0,0 +1,193 @@
+package httputils
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	mgo "gopkg.in/mgo.v2"
+	"net/http"
+)
+
+// DBSession is a unit of database work bound to a single request.
+type DBSession interface {
+	// Bind returns ctx with the session attached so that database calls made with it join the session.
+	Bind(ctx context.Context) context.Context
+	Commit(ctx context.Context) error
+	Abort(ctx context.Context) error
+	Close(ctx context.Context)
+}
+
+type DBSessionFactory func(r *http.Request) (DBSession, error)
+
+func DBSessionFromContext(ctx context.Context) DBSession {
+	session, _ := ctx.Value(DBSessionKey).(DBSession)
+	return session
+}
+
+func GetDBSession(r *http.Request) DBSession {
+	return DBSessionFromContext(r.Context())
+}
+
+// DBSessionMiddlewareFactory opens a session per request and stores it in the request context.
+// The session is committed right before a status below 400 is sent, so a failed commit is still
+// reported to the client as an error, and aborted on any other status or on panic. It is always
+// closed once the handler returns.
+func DBSessionMiddlewareFactory(open DBSessionFactory) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			session, err := open(r)
+			if err != nil {
+				WriteError(w, Internal(err))
+				return
+			}
+			ctx := session.Bind(context.WithValue(r.Context(), DBSessionKey, session))
+			writer := &sessionResponseWriter{ResponseWriter: w, session: session, ctx: ctx}
+			defer func() {
+				if err := recover(); err != nil {
+					writer.finish(http.StatusInternalServerError)
+					session.Close(ctx)
+					panic(err)
+				}
+				writer.finish(http.StatusOK)
+				session.Close(ctx)
+			}()
+			next.ServeHTTP(writer, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+type sessionResponseWriter struct {
+	http.ResponseWriter
+	session  DBSession
+	ctx      context.Context
+	finished bool
+	failed   bool
+}
+
+// finish commits or aborts the session depending on status and reports whether the response
+// may still be written.
+func (self *sessionResponseWriter) finish(status int) bool {
+	if self.finished {
+		return !self.failed
+	}
+	self.finished = true
+	if status >= 400 {
+		if err := self.session.Abort(self.ctx); err != nil {
+			LoggerFromContext(self.ctx).Log(ErrorLevel, "session abort failed", Fields{"error": err.Error()})
+		}
+		return true
+	}
+	if err := self.session.Commit(self.ctx); err != nil {
+		self.failed = true
+		WriteError(self.ResponseWriter, Internal(err))
+		return false
+	}
+	return true
+}
+
+func (self *sessionResponseWriter) WriteHeader(code int) {
+	if self.finish(code) {
+		self.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (self *sessionResponseWriter) Write(data []byte) (int, error) {
+	if !self.finish(http.StatusOK) {
+		return len(data), nil
+	}
+	return self.ResponseWriter.Write(data)
+}
+
+func (self *sessionResponseWriter) Flush() {
+	if flusher, ok := self.ResponseWriter.(http.Flusher); ok && self.finish(http.StatusOK) {
+		flusher.Flush()
+	}
+}
+
+func (self *sessionResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+// MgoSession is a copied mgo session. mgo has no transactions, so Commit and Abort do nothing.
+type MgoSession struct {
+	Session *mgo.Session
+}
+
+func (self MgoSession) Bind(ctx context.Context) context.Context {
+	return ctx
+}
+
+func (self MgoSession) Commit(ctx context.Context) error {
+	return nil
+}
+
+func (self MgoSession) Abort(ctx context.Context) error {
+	return nil
+}
+
+func (self MgoSession) Close(ctx context.Context) {
+	self.Session.Close()
+}
+
+// MgoSessionFactory gives every request its own copy of session.
+func MgoSessionFactory(session *mgo.Session) DBSessionFactory {
+	return func(r *http.Request) (DBSession, error) {
+		return MgoSession{session.Copy()}, nil
+	}
+}
+
+// MgoSessionFromContext returns the request's mgo session, or nil outside MgoSessionFactory.
+func MgoSessionFromContext(ctx context.Context) *mgo.Session {
+	if session, ok := DBSessionFromContext(ctx).(MgoSession); ok {
+		return session.Session
+	}
+	return nil
+}
+
+// MongoSession runs the request in a mongo-driver transaction. Bind attaches the session to the
+// request context, so helpers such as MongoFind called with r.Context() join the transaction.
+type MongoSession struct {
+	Session mongo.Session
+}
+
+func (self MongoSession) Bind(ctx context.Context) context.Context {
+	return mongo.NewSessionContext(ctx, self.Session)
+}
+
+func (self MongoSession) Commit(ctx context.Context) error {
+	return self.Session.CommitTransaction(ctx)
+}
+
+func (self MongoSession) Abort(ctx context.Context) error {
+	return self.Session.AbortTransaction(ctx)
+}
+
+func (self MongoSession) Close(ctx context.Context) {
+	self.Session.EndSession(context.WithoutCancel(ctx))
+}
+
+// MongoSessionFactory starts a session and a transaction per request. Transactions require a
+// replica set or sharded cluster.
+func MongoSessionFactory(client *mongo.Client, opts ...*options.TransactionOptions) DBSessionFactory {
+	return func(r *http.Request) (DBSession, error) {
+		session, err := client.StartSession()
+		if err != nil {
+			return nil, err
+		}
+		if err := session.StartTransaction(opts...); err != nil {
+			session.EndSession(r.Context())
+			return nil, err
+		}
+		return MongoSession{session}, nil
+	}
+}
+
+// MongoSessionFromContext returns the request's mongo-driver session, or nil outside MongoSessionFactory.
+func MongoSessionFromContext(ctx context.Context) mongo.Session {
+	if session, ok := DBSessionFromContext(ctx).(MongoSession); ok {
+		return session.Session
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package httputils
+
+import (
+	"context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// UniqueValidator fails when a document of the collection registered as collectionName already
+// holds the value in fieldName. On updates, excludeParam names the path param with the id of the
+// document being updated, which is not counted; pass "" on creation. The check races with
+// concurrent writes, so a unique index remains the source of truth and MongoError still answers
+// its violations with a 409.
+func UniqueValidator(key string, collectionName string, fieldName string, excludeParam string) ContextValidator {
+	return func(ctx context.Context, value interface{}) error {
+		store, err := CollectionStore(collectionName)
+		if err != nil {
+			return err
+		}
+		filter := bson.M{fieldName: value}
+		if excludeParam != "" {
+			if id, ok := ParamsFromContext(ctx)[excludeParam]; ok && DefaultIDType.Valid(id) {
+				filter["_id"] = bson.M{"$ne": DefaultIDType.Parse(id)}
+			}
+		}
+		var doc bson.M
+		err = store.Find(ctx, filter).Limit(1).One(&doc)
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return Error{Key: key, Description: "Value already exists", Code: CodeDuplicateValueError,
+			Meta: map[string]interface{}{"collection": collectionName, "field": fieldName}}
+	}
+}
+
+func referenceID(value interface{}) (interface{}, bool) {
+	id, ok := value.(string)
+	if !ok || !DefaultIDType.Valid(id) {
+		return nil, false
+	}
+	return DefaultIDType.Parse(id), true
+}
+
+// ExistsValidator fails unless a document of the collection registered as collectionName has
+// the referenced id, in DefaultIDType form, in fieldName, usually "_id". Arrays of ids pass only
+// when every id exists.
+func ExistsValidator(key string, collectionName string, fieldName string) ContextValidator {
+	return func(ctx context.Context, value interface{}) error {
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		ids := []interface{}{}
+		seen := make(map[interface{}]bool)
+		for _, item := range values {
+			id, ok := referenceID(item)
+			if !ok {
+				return Error{Key: key, Description: "Invalid reference", Code: CodeInvalidReferenceError}
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		store, err := CollectionStore(collectionName)
+		if err != nil {
+			return err
+		}
+		count, err := store.Find(ctx, bson.M{fieldName: bson.M{"$in": ids}}).Count()
+		if err != nil {
+			return err
+		}
+		if count < len(ids) {
+			return Error{Key: key, Description: "Referenced item not found", Code: CodeInvalidReferenceError,
+				Meta: map[string]interface{}{"collection": collectionName}}
+		}
+		return nil
+	}
+}
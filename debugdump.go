@@ -0,0 +1,235 @@
+package httputils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DebugDump is a captured request and its response. Bodies are decoded JSON or form values when
+// they parse, text otherwise, and redacted either way.
+type DebugDump struct {
+	Time            time.Time         `json:"time"`
+	RequestID       string            `json:"request_id,omitempty"`
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RemoteIP        string            `json:"remote_ip"`
+	Status          int               `json:"status"`
+	Duration        string            `json:"duration"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     interface{}       `json:"request_body,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	ResponseBody    interface{}       `json:"response_body,omitempty"`
+}
+
+// DebugDumpBuffer keeps the latest dumps in memory.
+type DebugDumpBuffer struct {
+	mutex sync.Mutex
+	dumps []DebugDump
+	next  int
+	full  bool
+}
+
+func NewDebugDumpBuffer(size int) *DebugDumpBuffer {
+	return &DebugDumpBuffer{dumps: make([]DebugDump, size)}
+}
+
+func (self *DebugDumpBuffer) Add(dump DebugDump) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if len(self.dumps) == 0 {
+		return
+	}
+	self.dumps[self.next] = dump
+	self.next = (self.next + 1) % len(self.dumps)
+	self.full = self.full || self.next == 0
+}
+
+// Dumps returns the kept dumps, newest first.
+func (self *DebugDumpBuffer) Dumps() []DebugDump {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	count := self.next
+	if self.full {
+		count = len(self.dumps)
+	}
+	dumps := make([]DebugDump, 0, count)
+	for i := 1; i <= count; i++ {
+		dumps = append(dumps, self.dumps[(self.next-i+len(self.dumps))%len(self.dumps)])
+	}
+	return dumps
+}
+
+// Handler lists the dumps as JSON, filtered by the "request_id" query parameter when given.
+func (self *DebugDumpBuffer) Handler() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		dumps := self.Dumps()
+		if id := r.URL.Query().Get("request_id"); id != "" {
+			filtered := []DebugDump{}
+			for _, dump := range dumps {
+				if dump.RequestID == id {
+					filtered = append(filtered, dump)
+				}
+			}
+			dumps = filtered
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		JSON(w, dumps, http.StatusOK)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+type DebugDumpConfig struct {
+	// Always dumps every request, for routes being diagnosed. Otherwise only requests whose
+	// Header carries Secret are dumped, and none when Secret is empty.
+	Always bool
+	Secret string
+	// Header is "X-Debug-Dump" when empty.
+	Header string
+	// MaxBodyBytes bounds the captured part of each body, 16KB when zero.
+	MaxBodyBytes int
+	// Redaction is DefaultRedaction when nil.
+	Redaction *Redaction
+	// Buffer keeps dumps for its Handler. When nil dumps are logged with the request logger.
+	Buffer *DebugDumpBuffer
+}
+
+type dumpResponseWriter struct {
+	*ResponseRecorder
+	body bytes.Buffer
+	max  int
+}
+
+func (self *dumpResponseWriter) Write(data []byte) (int, error) {
+	if room := self.max + 1 - self.body.Len(); room > 0 {
+		self.body.Write(data[:min(room, len(data))])
+	}
+	return self.ResponseRecorder.Write(data)
+}
+
+func dumpHeaders(header http.Header, redaction *Redaction, skip string) map[string]string {
+	values := make(map[string]string, len(header))
+	for name := range header {
+		switch {
+		case http.CanonicalHeaderKey(name) == skip || redaction.Field(name):
+			values[name] = RedactedValue
+		default:
+			values[name] = redaction.String(header.Get(name))
+		}
+	}
+	return values
+}
+
+// dumpBody decodes data by contentType for redaction. Bodies that are cut at max, or do not
+// parse, are redacted as text.
+func dumpBody(data []byte, contentType string, max int, redaction *Redaction) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	truncated := len(data) > max
+	if truncated {
+		data = data[:max]
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !truncated {
+		switch mediaType {
+		case "application/json", "application/problem+json":
+			var value interface{}
+			if json.Unmarshal(data, &value) == nil {
+				return redaction.Value(value)
+			}
+		case "application/x-www-form-urlencoded":
+			if form, err := url.ParseQuery(string(data)); err == nil {
+				values := make(map[string]interface{}, len(form))
+				for key, items := range form {
+					values[key] = items[0]
+				}
+				return redaction.Value(values)
+			}
+		}
+	}
+	if !utf8.Valid(data) {
+		return fmt.Sprintf("<%d bytes of %s>", len(data), mediaType)
+	}
+	text := redaction.Text(string(data))
+	if truncated {
+		text += "...[truncated]"
+	}
+	return text
+}
+
+// DebugDumpMiddlewareFactory captures requests and responses, bodies included, for diagnosing
+// client integrations. Headers and bodies are redacted with the config's Redaction, and the
+// secret header itself is never dumped. Bodies are captured up to MaxBodyBytes while they
+// stream, so large uploads and downloads are not held in memory.
+func DebugDumpMiddlewareFactory(config DebugDumpConfig) func(http.Handler) http.Handler {
+	if config.Header == "" {
+		config.Header = "X-Debug-Dump"
+	}
+	config.Header = http.CanonicalHeaderKey(config.Header)
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = 16 * 1024
+	}
+	if config.Redaction == nil {
+		config.Redaction = DefaultRedaction
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			enabled := config.Always || (config.Secret != "" && ConstantTimeEqual(r.Header.Get(config.Header), config.Secret))
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			t1 := time.Now()
+			var requestBody []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				requestBody, _ = io.ReadAll(io.LimitReader(r.Body, int64(config.MaxBodyBytes)+1))
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+			}
+			writer := &dumpResponseWriter{ResponseRecorder: NewResponseRecorder(w), max: config.MaxBodyBytes}
+			defer func() {
+				dump := DebugDump{
+					Time:            t1,
+					RequestID:       GetRequestID(r),
+					Method:          r.Method,
+					URL:             config.Redaction.URL(r.URL),
+					RemoteIP:        ClientIP(r),
+					Status:          writer.Status,
+					Duration:        time.Since(t1).String(),
+					RequestHeaders:  dumpHeaders(r.Header, config.Redaction, config.Header),
+					RequestBody:     dumpBody(requestBody, r.Header.Get("Content-Type"), config.MaxBodyBytes, config.Redaction),
+					ResponseHeaders: dumpHeaders(writer.Header(), config.Redaction, config.Header),
+					ResponseBody:    dumpBody(writer.body.Bytes(), writer.Header().Get("Content-Type"), config.MaxBodyBytes, config.Redaction),
+				}
+				if config.Buffer != nil {
+					config.Buffer.Add(dump)
+					return
+				}
+				LoggerFromContext(r.Context()).Log(InfoLevel, "debug dump", Fields{
+					"method": dump.Method, "url": dump.URL, "status": dump.Status, "duration": dump.Duration,
+					"request_headers": dump.RequestHeaders, "request_body": dump.RequestBody,
+					"response_headers": dump.ResponseHeaders, "response_body": dump.ResponseBody,
+				})
+			}()
+			next.ServeHTTP(writer, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// DebugDumps registers an endpoint listing the dumps kept by buffer. Protect it with mws.
+func (self *Router) DebugDumps(path string, buffer *DebugDumpBuffer, mws ...func(http.Handler) http.Handler) {
+	self.Get(path, buffer.Handler(), mws...)
+}
@@ -0,0 +1,51 @@
+package httputils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func dumpRequest(t *testing.T, body string, contentType string) DebugDump {
+	buffer := NewDebugDumpBuffer(1)
+	handler := DebugDumpMiddlewareFactory(DebugDumpConfig{Always: true, Buffer: buffer})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	r := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	dumps := buffer.Dumps()
+	if len(dumps) != 1 {
+		t.Fatalf("expected 1 dump, got %d", len(dumps))
+	}
+	return dumps[0]
+}
+
+func TestDebugDumpRedactsTruncatedJSON(t *testing.T) {
+	body := `{"password":"hunter2","padding":"` + strings.Repeat("x", 17*1024) + `"}`
+	dump := dumpRequest(t, body, "application/json")
+	text, ok := dump.RequestBody.(string)
+	if !ok || !strings.HasSuffix(text, "[truncated]") {
+		t.Fatalf("expected a truncated text body, got %v", dump.RequestBody)
+	}
+	if strings.Contains(text, "hunter2") {
+		t.Fatalf("password leaked into dump: %.100s", text)
+	}
+}
+
+func TestDebugDumpRedactsBodyWithoutContentType(t *testing.T) {
+	dump := dumpRequest(t, `{"password":"hunter2","user":"bob"}`, "")
+	text := dump.RequestBody.(string)
+	if strings.Contains(text, "hunter2") || !strings.Contains(text, `"user":"bob"`) {
+		t.Fatalf("unexpected dump body: %s", text)
+	}
+	dump = dumpRequest(t, "user=bob&password=hunter2", "text/plain")
+	if text := dump.RequestBody.(string); strings.Contains(text, "hunter2") || !strings.Contains(text, "user=bob") {
+		t.Fatalf("unexpected dump body: %s", text)
+	}
+}
@@ -0,0 +1,242 @@
+package httputils
+
+import (
+	"encoding/json"
+	"errors"
+	"golang.org/x/text/currency"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidDecimal = errors.New("httputils: invalid decimal")
+
+// Decimal is an exact base-10 number, the unscaled integer divided by 10^scale, for amounts that
+// float64 cannot hold exactly. The zero Decimal is 0.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+// ParseDecimal reads plain notation such as "-12.50"; exponents are not accepted.
+func ParseDecimal(value string) (Decimal, error) {
+	digits := value
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		digits = value[1:]
+	}
+	integer, fraction, _ := strings.Cut(digits, ".")
+	if integer == "" && fraction == "" || strings.Contains(fraction, ".") {
+		return Decimal{}, ErrInvalidDecimal
+	}
+	for _, r := range integer + fraction {
+		if r < '0' || r > '9' {
+			return Decimal{}, ErrInvalidDecimal
+		}
+	}
+	unscaled, _ := new(big.Int).SetString(integer+fraction, 10)
+	if strings.HasPrefix(value, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return Decimal{unscaled, len(fraction)}, nil
+}
+
+func MustParseDecimal(value string) Decimal {
+	decimal, err := ParseDecimal(value)
+	if err != nil {
+		panic(err)
+	}
+	return decimal
+}
+
+// DecimalFromValue reads a decoded JSON value: a string, a json.Number, or a float64 taken at
+// its shortest representation, which is exact for up to 15 significant digits.
+func DecimalFromValue(value interface{}) (Decimal, error) {
+	switch value := value.(type) {
+	case string:
+		return ParseDecimal(value)
+	case json.Number:
+		return ParseDecimal(value.String())
+	case float64:
+		return ParseDecimal(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return Decimal{}, ErrInvalidDecimal
+}
+
+func (self Decimal) int() *big.Int {
+	if self.unscaled == nil {
+		return new(big.Int)
+	}
+	return self.unscaled
+}
+
+// Scale is the number of digits after the decimal point.
+func (self Decimal) Scale() int {
+	return self.scale
+}
+
+func (self Decimal) Sign() int {
+	return self.int().Sign()
+}
+
+// Rescale returns the decimal with scale digits after the point, and false when digits would be
+// lost.
+func (self Decimal) Rescale(scale int) (Decimal, bool) {
+	unscaled := new(big.Int).Set(self.int())
+	if scale >= self.scale {
+		unscaled.Mul(unscaled, pow10(scale-self.scale))
+		return Decimal{unscaled, scale}, true
+	}
+	unscaled, remainder := unscaled.QuoRem(unscaled, pow10(self.scale-scale), new(big.Int))
+	if remainder.Sign() != 0 {
+		return self, false
+	}
+	return Decimal{unscaled, scale}, true
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func (self Decimal) align(other Decimal) (*big.Int, *big.Int, int) {
+	scale := self.scale
+	if other.scale > scale {
+		scale = other.scale
+	}
+	a, _ := self.Rescale(scale)
+	b, _ := other.Rescale(scale)
+	return a.unscaled, b.unscaled, scale
+}
+
+func (self Decimal) Add(other Decimal) Decimal {
+	a, b, scale := self.align(other)
+	return Decimal{a.Add(a, b), scale}
+}
+
+func (self Decimal) Sub(other Decimal) Decimal {
+	a, b, scale := self.align(other)
+	return Decimal{a.Sub(a, b), scale}
+}
+
+func (self Decimal) Mul(other Decimal) Decimal {
+	return Decimal{new(big.Int).Mul(self.int(), other.int()), self.scale + other.scale}
+}
+
+// Cmp compares the values, so 1.5 and 1.50 are equal.
+func (self Decimal) Cmp(other Decimal) int {
+	a, b, _ := self.align(other)
+	return a.Cmp(b)
+}
+
+func (self Decimal) String() string {
+	digits := new(big.Int).Abs(self.int()).String()
+	if self.scale > 0 {
+		if len(digits) <= self.scale {
+			digits = strings.Repeat("0", self.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-self.scale] + "." + digits[len(digits)-self.scale:]
+	}
+	if self.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// MarshalJSON writes the decimal as a string so clients do not round it.
+func (self Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.String())
+}
+
+func (self *Decimal) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	decimal, err := DecimalFromValue(value)
+	if err != nil {
+		return err
+	}
+	*self = decimal
+	return nil
+}
+
+func decimalError(key string, value interface{}) (Decimal, error) {
+	decimal, err := DecimalFromValue(value)
+	if err != nil {
+		return decimal, Error{Key: key, Description: "Should be decimal", Code: CodeInvalidDecimalError, Args: []string{"decimal"}}
+	}
+	return decimal, nil
+}
+
+// DecimalValidator accepts decimal strings, and JSON numbers, with at most maxScale digits
+// after the point.
+func DecimalValidator(key string, maxScale int) Validator {
+	return func(value interface{}) error {
+		decimal, err := decimalError(key, value)
+		if err != nil {
+			return err
+		}
+		if decimal.Scale() > maxScale {
+			return Error{Key: key, Description: "Too many decimal places", Code: CodeInvalidDecimalError, Args: []string{strconv.Itoa(maxScale)},
+				Meta: map[string]interface{}{"max_scale": maxScale, "actual": decimal.String()}}
+		}
+		return nil
+	}
+}
+
+type Money struct {
+	Amount   Decimal `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// ParseMoney reads an object holding the amount under "amount" and the ISO 4217 code under
+// currencyKey, checking that the amount has no more decimal places than the currency's minor
+// unit. Errors are reported under key.
+func ParseMoney(key string, currencyKey string, value interface{}) (Money, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return Money{}, Error{Key: key, Description: "Should be money", Code: CodeTypeError, Args: []string{"money"}}
+	}
+	code, _ := object[currencyKey].(string)
+	unit, err := currency.ParseISO(code)
+	if err != nil || code != strings.ToUpper(code) {
+		return Money{}, Error{Key: key + "." + currencyKey, Description: "Invalid currency", Code: CodeInvalidCurrencyError, Args: []string{code}}
+	}
+	amountKey := key + ".amount"
+	if object["amount"] == nil {
+		return Money{}, Error{Key: amountKey, Description: "Field is required", Code: CodeRequiredFieldError}
+	}
+	amount, err := decimalError(amountKey, object["amount"])
+	if err != nil {
+		return Money{}, err
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	if amount.Scale() > scale {
+		if amount, ok = amount.Rescale(scale); !ok {
+			return Money{}, Error{Key: amountKey, Description: "Too many decimal places", Code: CodeInvalidDecimalError, Args: []string{strconv.Itoa(scale)},
+				Meta: map[string]interface{}{"max_scale": scale, "currency": code}}
+		}
+	}
+	return Money{amount, code}, nil
+}
+
+// MoneyValidator accepts objects such as {"amount": "12.30", "currency": "EUR"} that ParseMoney
+// reads, with currencyKey naming the currency field.
+func MoneyValidator(key string, currencyKey string) Validator {
+	return func(value interface{}) error {
+		_, err := ParseMoney(key, currencyKey, value)
+		return err
+	}
+}
+
+// BodyDecimal returns the decimal at key of the body validated by WithBody.
+func BodyDecimal(r *http.Request, key string) (Decimal, error) {
+	return DecimalFromValue(ValidatedBody(r)[key])
+}
+
+// BodyMoney returns the money at key of the body validated by WithBody.
+func BodyMoney(r *http.Request, key string, currencyKey string) (Money, error) {
+	return ParseMoney(key, currencyKey, ValidatedBody(r)[key])
+}
@@ -0,0 +1,139 @@
+package httputils
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"sort"
+)
+
+type FieldChange struct {
+	Old interface{} `json:"old" bson:"old"`
+	New interface{} `json:"new" bson:"new"`
+}
+
+// DocumentDiff lists the differences between two documents by dotted path, such as
+// "address.city". Nested objects are compared field by field; arrays are compared whole.
+type DocumentDiff struct {
+	Added   map[string]interface{} `json:"added,omitempty"`
+	Removed map[string]interface{} `json:"removed,omitempty"`
+	Changed map[string]FieldChange `json:"changed,omitempty"`
+}
+
+var documentType = reflect.TypeOf(map[string]interface{}{})
+
+// asDocument accepts map[string]interface{} and named map types such as bson.M.
+func asDocument(value interface{}) (map[string]interface{}, bool) {
+	if doc, ok := value.(map[string]interface{}); ok {
+		return doc, true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map || !v.Type().ConvertibleTo(documentType) {
+		return nil, false
+	}
+	return v.Convert(documentType).Interface().(map[string]interface{}), true
+}
+
+func asFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// valuesEqual treats numbers of different types as equal when their values are, since documents
+// read from Mongo hold int32 and int64 where decoded JSON holds float64.
+func valuesEqual(a interface{}, b interface{}) bool {
+	if x, ok := asFloat(a); ok {
+		y, ok := asFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Diff compares old and new, the stored document and the validated body for instance.
+func Diff(old map[string]interface{}, new map[string]interface{}) DocumentDiff {
+	diff := DocumentDiff{map[string]interface{}{}, map[string]interface{}{}, map[string]FieldChange{}}
+	diff.compare("", old, new)
+	return diff
+}
+
+func (self DocumentDiff) compare(prefix string, old map[string]interface{}, new map[string]interface{}) {
+	for key, oldValue := range old {
+		if _, ok := new[key]; !ok {
+			self.Removed[prefix+key] = oldValue
+		}
+	}
+	for key, newValue := range new {
+		oldValue, ok := old[key]
+		if !ok {
+			self.Added[prefix+key] = newValue
+			continue
+		}
+		oldDoc, oldIsDoc := asDocument(oldValue)
+		newDoc, newIsDoc := asDocument(newValue)
+		if oldIsDoc && newIsDoc {
+			self.compare(prefix+key+".", oldDoc, newDoc)
+		} else if !valuesEqual(oldValue, newValue) {
+			self.Changed[prefix+key] = FieldChange{oldValue, newValue}
+		}
+	}
+}
+
+func (self DocumentDiff) Empty() bool {
+	return len(self.Added) == 0 && len(self.Removed) == 0 && len(self.Changed) == 0
+}
+
+// Paths returns every differing path, sorted.
+func (self DocumentDiff) Paths() []string {
+	paths := make([]string, 0, len(self.Added)+len(self.Removed)+len(self.Changed))
+	for path := range self.Added {
+		paths = append(paths, path)
+	}
+	for path := range self.Removed {
+		paths = append(paths, path)
+	}
+	for path := range self.Changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Set returns the new values of the added and changed paths, a minimal $set document.
+func (self DocumentDiff) Set() bson.M {
+	set := bson.M{}
+	for path, value := range self.Added {
+		set[path] = value
+	}
+	for path, change := range self.Changed {
+		set[path] = change.New
+	}
+	return set
+}
+
+// Update returns the Mongo update turning the old document into the new one, with $set for the
+// added and changed paths and $unset for the removed ones. It is nil when nothing differs. For a
+// partial body pass only Set, as the fields it leaves out would be unset.
+func (self DocumentDiff) Update() bson.M {
+	update := bson.M{}
+	if set := self.Set(); len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(self.Removed) > 0 {
+		unset := bson.M{}
+		for path := range self.Removed {
+			unset[path] = ""
+		}
+		update["$unset"] = unset
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	return update
+}
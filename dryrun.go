@@ -0,0 +1,91 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// IsDryRun reports whether r asks to be validated only, with a "dry_run" query parameter or an
+// "X-Dry-Run" header set to a true value.
+func IsDryRun(r *http.Request) bool {
+	if value, err := strconv.ParseBool(r.URL.Query().Get("dry_run")); err == nil && value {
+		return true
+	}
+	value, err := strconv.ParseBool(r.Header.Get("X-Dry-Run"))
+	return err == nil && value
+}
+
+// dryRunResponseWriter reports the 400s of failed validation as 422.
+type dryRunResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (self *dryRunResponseWriter) WriteHeader(code int) {
+	if code == http.StatusBadRequest {
+		code = http.StatusUnprocessableEntity
+	}
+	self.ResponseWriter.WriteHeader(code)
+}
+
+func (self *dryRunResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+// DryRunFromContext reports whether DryRun let the request through as a dry run.
+func DryRunFromContext(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(DryRunKey).(bool)
+	return dryRun
+}
+
+// dryRunHandler marks handlers, such as those of Router.Resource, that validate on their own and
+// stop before writing anything when DryRunFromContext.
+type dryRunHandler struct {
+	http.Handler
+}
+
+func writeDryRunValid(w http.ResponseWriter) {
+	JSON(w, map[string]interface{}{"valid": true}, http.StatusOK)
+}
+
+// DryRun runs the validating middlewares mws, such as WithBody, WithQuery and RequireRole, before
+// the handler. Dry run requests go through the same mws but never reach the handler: they are
+// answered with a 200 once every check passed and with a 422, instead of a 400, when the
+// validation failed. Other failures, such as a 401 or a 404, keep their status. The handlers of
+// Router.Resource, which validate on their own, are reached with DryRunFromContext set instead,
+// when DryRun comes last in the route's middlewares. Dry runs are never audited.
+func DryRun(mws ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	valid := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeDryRunValid(w)
+	})
+	return func(next http.Handler) http.Handler {
+		var describers []RouteDescriber
+		handler := next
+		for i := len(mws) - 1; i >= 0; i-- {
+			handler = mws[i](handler)
+			if describer, ok := handler.(RouteDescriber); ok {
+				describers = append(describers, describer)
+			}
+		}
+		validate := chain(valid, mws)
+		if _, ok := next.(dryRunHandler); ok {
+			validate = handler
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if !IsDryRun(r) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			if entry := AuditFromContext(r.Context()); entry != nil {
+				entry.dryRun = true
+			}
+			validate.ServeHTTP(&dryRunResponseWriter{w}, SetInContext(true, DryRunKey, r))
+		}
+
+		return describe(http.HandlerFunc(fn), func(route *Route) {
+			for _, describer := range describers {
+				describer.DescribeRoute(route)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package httputils
+
+import (
+	"net/http"
+)
+
+// Envelope wraps successful response data together with metadata such as pagination.
+type Envelope func(data interface{}, meta map[string]interface{}) interface{}
+
+// DefaultEnvelope is used by routers that do not configure one. When nil, data is written as is
+// and meta is dropped.
+var DefaultEnvelope Envelope
+
+type DataEnvelope struct {
+	Data interface{}            `json:"data"`
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+// StandardEnvelope writes {"data": ..., "meta": {...}}.
+func StandardEnvelope(data interface{}, meta map[string]interface{}) interface{} {
+	return DataEnvelope{data, meta}
+}
+
+type envelopeCarrier interface {
+	envelope() Envelope
+}
+
+type envelopeResponseWriter struct {
+	http.ResponseWriter
+	wrap Envelope
+}
+
+func (self envelopeResponseWriter) envelope() Envelope {
+	return self.wrap
+}
+
+func (self envelopeResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+func envelopeFor(w http.ResponseWriter) Envelope {
+	for {
+		if carrier, ok := w.(envelopeCarrier); ok {
+			return carrier.envelope()
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return DefaultEnvelope
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// EnvelopeMiddlewareFactory makes Respond, OK, Created and WritePage use envelope for the
+// wrapped handlers.
+func EnvelopeMiddlewareFactory(envelope Envelope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(envelopeResponseWriter{w, envelope}, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// WithEnvelope selects how the router wraps successful responses.
+func WithEnvelope(envelope Envelope) RouterOption {
+	return func(router *Router) {
+		router.envelope = envelope
+	}
+}
+
+// Respond writes data with status code, wrapped in the envelope configured for w.
+func Respond(w http.ResponseWriter, code int, data interface{}, meta map[string]interface{}) {
+	if envelope := envelopeFor(w); envelope != nil {
+		data = envelope(data, meta)
+	}
+	JSON(w, data, code)
+}
+
+func OK(w http.ResponseWriter, data interface{}) {
+	Respond(w, http.StatusOK, data, nil)
+}
+
+func Created(w http.ResponseWriter, data interface{}) {
+	Respond(w, http.StatusCreated, data, nil)
+}
+
+// PageMeta returns the pagination fields of page as envelope metadata.
+func PageMeta(page Page) map[string]interface{} {
+	meta := map[string]interface{}{}
+	if page.Total != nil {
+		meta["total"] = *page.Total
+	}
+	if page.NextCursor != "" {
+		meta["next_cursor"] = page.NextCursor
+	}
+	if page.PrevCursor != "" {
+		meta["prev_cursor"] = page.PrevCursor
+	}
+	if len(page.Links) > 0 {
+		meta["links"] = page.Links
+	}
+	return meta
+}
@@ -11,6 +11,11 @@ type Errors struct {
 	Errors []Error `json:"errors"`
 }
 
+type errorsPayload struct {
+	Errors
+	RequestID string `json:"request_id,omitempty"`
+}
+
 type ServerError struct {
 	StatusCode int
 	Errors     Errors
@@ -20,38 +25,88 @@ func (self ServerError) Error() string {
 	return self.Errors.Error()
 }
 
+// Unwrap exposes the individual field errors so errors.Is and errors.As can match them.
+func (self ServerError) Unwrap() []error {
+	errs := make([]error, len(self.Errors.Errors))
+	for i, err := range self.Errors.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Is reports whether target is a ServerError with the same status code and, when target
+// carries errors, the same leading error code.
+func (self ServerError) Is(target error) bool {
+	other, ok := target.(ServerError)
+	if !ok || other.StatusCode != self.StatusCode {
+		return false
+	}
+	if len(other.Errors.Errors) == 0 {
+		return true
+	}
+	return len(self.Errors.Errors) > 0 && self.Errors.Errors[0].Code == other.Errors.Errors[0].Code
+}
+
+// Wrap returns an error that is written to clients as self while keeping cause in its chain for
+// logging and errors.Is checks. The cause is never serialized.
+func (self ServerError) Wrap(cause error) error {
+	return wrappedServerError{self, cause}
+}
+
 func (self ServerError) Write(w http.ResponseWriter) {
-	JSON(w, self.Errors, self.StatusCode)
+	errorSerializerFor(w)(w, self)
 }
 
 func raise500(w http.ResponseWriter, err interface{}) {
-	str := fmt.Sprintf("%v", err)
-	ServerError{500, Errors{[]Error{Error{"undefined",
-		"Internal server error", "INTERNAL_SERVER_ERROR", []string{str}}}}}.Write(w)
+	var args []string
+	if err != nil {
+		args = []string{redactedArg(err)}
+	}
+	ServerError{500, Errors{[]Error{Error{Key: "undefined",
+		Description: "Internal server error", Code: CodeInternalServerError, Args: args}}}}.Write(w)
 }
 
 func HTTP400() ServerError {
-	return ServerError{400, Errors{[]Error{UndefinedKeyError("INVALID_REQUEST", "Invalid request")}}}
+	return ServerError{400, Errors{[]Error{UndefinedKeyError(CodeInvalidRequest, "Invalid request")}}}
 }
 
 func HTTP401() ServerError {
-	return ServerError{401, Errors{[]Error{UndefinedKeyError("UNAUTHORIZED", "Unauthorized user")}}}
+	return ServerError{401, Errors{[]Error{UndefinedKeyError(CodeUnauthorized, "Unauthorized user")}}}
 }
 
 func HTTP403() ServerError {
-	return ServerError{403, Errors{[]Error{UndefinedKeyError("PERMISSION_DENIED", "Permission denied")}}}
+	return ServerError{403, Errors{[]Error{UndefinedKeyError(CodePermissionDenied, "Permission denied")}}}
 }
 
 func HTTP404(id string) ServerError {
-	return ServerError{404, Errors{[]Error{Error{"undefined", "Item not found", "ITEM_NOT_FOUND", []string{id}}}}}
+	return ServerError{404, Errors{[]Error{Error{Key: "undefined", Description: "Item not found", Code: CodeItemNotFound, Args: []string{id}}}}}
+
+}
 
+func HTTP405() ServerError {
+	return ServerError{405, Errors{[]Error{UndefinedKeyError(CodeMethodNotAllowed, "Method not allowed")}}}
 }
 
+// Error describes a single failure. Args is the legacy stringly-typed detail list and is still
+// emitted for existing clients; Meta holds the same details with their JSON types.
 type Error struct {
-	Key         string   `json:"key"`
-	Description string   `json:"description"`
-	Code        string   `json:"code"`
-	Args        []string `json:"args, omitempty"`
+	Key         string                 `json:"key"`
+	Description string                 `json:"description"`
+	Code        string                 `json:"code"`
+	Args        []string               `json:"args,omitempty"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+}
+
+// WithMeta returns a copy of the error with key set in its Meta, leaving the Meta of the error
+// it was copied from unchanged.
+func (self Error) WithMeta(key string, value interface{}) Error {
+	meta := make(map[string]interface{}, len(self.Meta)+1)
+	for k, v := range self.Meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	self.Meta = meta
+	return self
 }
 
 func (self Error) WriteWithCode(code int, w http.ResponseWriter) {
@@ -64,13 +119,48 @@ func (self Error) AsServerError(code int)error {
 }
 
 func UndefinedKeyError(code string, description string) Error {
-	return Error{"undefined", description, code, nil}
+	return Error{Key: "undefined", Description: description, Code: code}
 }
 
 func (self Error) Error() string {
 	return self.Code
 }
 
+// Is matches a target Error by code, and by key when the target sets one.
+func (self Error) Is(target error) bool {
+	other, ok := target.(Error)
+	if !ok {
+		return false
+	}
+	return other.Code == self.Code && (other.Key == "" || other.Key == self.Key)
+}
+
+type wrappedServerError struct {
+	ServerError
+	cause error
+}
+
+func (self wrappedServerError) Error() string {
+	return self.ServerError.Error() + ": " + self.cause.Error()
+}
+
+func (self wrappedServerError) Unwrap() []error {
+	return append([]error{self.cause}, self.ServerError.Unwrap()...)
+}
+
+func (self wrappedServerError) As(target interface{}) bool {
+	if serverError, ok := target.(*ServerError); ok {
+		*serverError = self.ServerError
+		return true
+	}
+	return false
+}
+
+// Internal wraps cause into a 500 that hides it from the client.
+func Internal(cause error) error {
+	return HTTP500().Wrap(cause)
+}
+
 
 
 
@@ -0,0 +1,55 @@
+package httputils
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrorMapper converts a domain error into a ServerError, reporting false for errors it does not handle.
+type ErrorMapper func(err error) (ServerError, bool)
+
+var (
+	errorMappersMutex sync.RWMutex
+	errorMappers      []ErrorMapper
+)
+
+func RegisterErrorMapper(mapper ErrorMapper) {
+	errorMappersMutex.Lock()
+	defer errorMappersMutex.Unlock()
+	errorMappers = append(errorMappers, mapper)
+}
+
+func HTTP500() ServerError {
+	return ServerError{500, Errors{[]Error{UndefinedKeyError(CodeInternalServerError, "Internal server error")}}}
+}
+
+// ToServerError finds a ServerError in err's chain, falling back to registered mappers, a 400
+// for a bare field Error, and finally a 500 that does not expose err to the client.
+func ToServerError(err error) (ServerError, bool) {
+	var serverError ServerError
+	if errors.As(err, &serverError) {
+		return serverError, true
+	}
+	errorMappersMutex.RLock()
+	mappers := errorMappers
+	errorMappersMutex.RUnlock()
+	for _, mapper := range mappers {
+		if serverError, ok := mapper(err); ok {
+			return serverError, true
+		}
+	}
+	var fieldError Error
+	if errors.As(err, &fieldError) {
+		return ServerError{400, Errors{[]Error{fieldError}}}, true
+	}
+	return HTTP500(), false
+}
+
+func WriteError(w http.ResponseWriter, err error) {
+	serverError, ok := ToServerError(err)
+	if !ok || serverError.StatusCode >= 500 {
+		DefaultLogger.Log(ErrorLevel, "request failed", Fields{"error": err.Error(), "status": serverError.StatusCode})
+	}
+	serverError.Write(w)
+}
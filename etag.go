@@ -0,0 +1,88 @@
+package httputils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func HTTP412() ServerError {
+	return ServerError{412, Errors{[]Error{UndefinedKeyError(CodePreconditionFailed, "Resource was modified since it was read")}}}
+}
+
+func HTTP428() ServerError {
+	return ServerError{428, Errors{[]Error{UndefinedKeyError(CodePreconditionRequired, "If-Match header is required")}}}
+}
+
+// ETag formats version, such as a revision counter or an update timestamp, as a strong entity tag.
+func ETag(version interface{}) string {
+	return `"` + strings.Replace(fmt.Sprintf("%v", version), `"`, "", -1) + `"`
+}
+
+// ContentETag derives a strong entity tag from a response body.
+func ContentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func SetETag(w http.ResponseWriter, version interface{}) {
+	w.Header().Set("ETag", ETag(version))
+}
+
+// CheckIfMatch compares the If-Match header against the current entity tag using the strong
+// comparison of RFC 7232, so weak tags never match. A missing header passes.
+func CheckIfMatch(r *http.Request, current string) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || (tag == current && !strings.HasPrefix(tag, "W/")) {
+			return nil
+		}
+	}
+	return HTTP412()
+}
+
+type IfMatchConfig struct {
+	// Current returns the entity tag of the resource addressed by the request.
+	Current func(r *http.Request) (string, error)
+	// Required answers 428 to mutating requests sent without If-Match.
+	Required bool
+}
+
+// IfMatchMiddlewareFactory enforces If-Match on PUT, PATCH and DELETE requests, answering 412
+// when the resource changed since the client read it.
+func IfMatchMiddlewareFactory(config IfMatchConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPut && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Header.Get("If-Match") == "" {
+				if config.Required {
+					HTTP428().Write(w)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			current, err := config.Current(r)
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			if err := CheckIfMatch(r, current); err != nil {
+				WriteError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,144 @@
+package httputils
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// FieldsQueryParam names the query parameter listing the fields a client wants.
+var FieldsQueryParam = "fields"
+
+type fieldTree map[string]fieldTree
+
+func parseFields(value string) fieldTree {
+	tree := fieldTree{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		node := tree
+		for _, part := range strings.Split(field, ".") {
+			child, ok := node[part]
+			if !ok {
+				child = fieldTree{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// prune keeps the requested fields of objects, applying the tree to every element of arrays.
+// A field without children keeps its whole value.
+func (self fieldTree) prune(value interface{}) interface{} {
+	if typed, ok := value.([]interface{}); ok {
+		pruned := make([]interface{}, len(typed))
+		for i, item := range typed {
+			pruned[i] = self.prune(item)
+		}
+		return pruned
+	}
+	document, ok := asDocument(value)
+	if !ok {
+		return value
+	}
+	pruned := make(map[string]interface{}, len(self))
+	for key, children := range self {
+		child, ok := document[key]
+		if !ok {
+			continue
+		}
+		if len(children) > 0 {
+			child = children.prune(child)
+		}
+		pruned[key] = child
+	}
+	return pruned
+}
+
+// WithSparseFields prunes successful JSON responses to the comma separated fields requested in
+// ?fields=id,name,author.name. Fields outside allowed are rejected with a 400; an empty allowed
+// list accepts any field. Responses wrapped in an envelope or a Page are pruned inside "data".
+func WithSparseFields(allowed ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			requested := r.URL.Query().Get(FieldsQueryParam)
+			if requested == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tree := parseFields(requested)
+			if len(allowed) > 0 {
+				collector := NewErrorCollector()
+				for _, field := range strings.Split(requested, ",") {
+					field = strings.TrimSpace(field)
+					if field != "" && !contains(allowed, field) {
+						collector.AddErrors(Error{Key: FieldsQueryParam, Description: "Field is not allowed", Code: CodeInvalidQueryError,
+							Args: []string{field},
+							Meta: map[string]interface{}{"field": field, "allowed": allowed}})
+					}
+				}
+				if collector.HasErrors() {
+					collector.ServerError().Write(w)
+					return
+				}
+			}
+			buffer := &fieldsResponseWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(buffer, r)
+			buffer.flush(tree)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+type fieldsResponseWriter struct {
+	http.ResponseWriter
+	code   int
+	body   bytes.Buffer
+	header bool
+}
+
+func (self *fieldsResponseWriter) WriteHeader(code int) {
+	if !self.header {
+		self.code = code
+		self.header = true
+	}
+}
+
+func (self *fieldsResponseWriter) Write(data []byte) (int, error) {
+	self.header = true
+	return self.body.Write(data)
+}
+
+func (self *fieldsResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+func (self *fieldsResponseWriter) flush(tree fieldTree) {
+	data := self.body.Bytes()
+	mediaType, _, _ := mime.ParseMediaType(self.Header().Get("Content-Type"))
+	if self.code >= 200 && self.code < 300 && mediaType == "application/json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var value interface{}
+		if decoder.Decode(&value) == nil {
+			if object, ok := value.(map[string]interface{}); ok && object["data"] != nil && tree["data"] == nil {
+				object["data"] = tree.prune(object["data"])
+			} else {
+				value = tree.prune(value)
+			}
+			if pruned, err := json.Marshal(value); err == nil {
+				data = pruned
+			}
+		}
+	}
+	self.Header().Del("Content-Length")
+	self.ResponseWriter.WriteHeader(self.code)
+	self.ResponseWriter.Write(data)
+}
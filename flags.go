@@ -0,0 +1,222 @@
+package httputils
+
+import (
+	"context"
+	"golang.org/x/sync/singleflight"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Flag describes when a feature is on. It is on for the listed identities and roles, for
+// Percentage percent of the other clients picked consistently by identity or IP, and for
+// everyone when Enabled is set.
+type Flag struct {
+	Enabled    bool     `json:"enabled" yaml:"enabled"`
+	Percentage int      `json:"percentage" yaml:"percentage"`
+	Identities []string `json:"identities" yaml:"identities"`
+	Roles      []string `json:"roles" yaml:"roles"`
+}
+
+func (self Flag) enabledFor(name string, identity *Identity, key string) bool {
+	if self.Enabled {
+		return true
+	}
+	if identity != nil {
+		if contains(self.Identities, identity.ID) {
+			return true
+		}
+		for _, role := range self.Roles {
+			if identity.HasRole(role) {
+				return true
+			}
+		}
+	}
+	if self.Percentage <= 0 || key == "" {
+		return false
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(name + ":" + key))
+	return int(hash.Sum32()%100) < self.Percentage
+}
+
+type FlagProvider interface {
+	Flags(ctx context.Context) (map[string]Flag, error)
+}
+
+// StaticFlags provides flags fixed in code or loaded with the rest of the configuration.
+type StaticFlags map[string]Flag
+
+func (self StaticFlags) Flags(ctx context.Context) (map[string]Flag, error) {
+	return self, nil
+}
+
+// EnvFlags reads flags from environment variables starting with prefix, so FEATURE_NEW_CHECKOUT
+// with prefix "FEATURE_" is the flag new_checkout. Values are booleans or rollout percentages
+// such as "25%".
+type EnvFlags string
+
+func (self EnvFlags) Flags(ctx context.Context) (map[string]Flag, error) {
+	flags := map[string]Flag{}
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		name, ok := strings.CutPrefix(key, string(self))
+		if !ok || name == "" {
+			continue
+		}
+		name = strings.ToLower(name)
+		if percentage, ok := strings.CutSuffix(value, "%"); ok {
+			if n, err := strconv.Atoi(percentage); err == nil {
+				flags[name] = Flag{Percentage: n}
+			}
+		} else if enabled, err := strconv.ParseBool(value); err == nil {
+			flags[name] = Flag{Enabled: enabled}
+		}
+	}
+	return flags, nil
+}
+
+// RemoteFlags fetches a JSON object of flags by name from Path with Client, keeping them for
+// TTL. Concurrent refreshes share one fetch. When a refresh fails the previous flags are kept,
+// and fetching is retried after a backoff growing from a second up to TTL.
+type RemoteFlags struct {
+	Client   *Client
+	Path     string
+	TTL      time.Duration
+	group    singleflight.Group
+	mutex    sync.Mutex
+	flags    map[string]Flag
+	next     time.Time
+	failures int
+	err      error
+}
+
+func NewRemoteFlags(client *Client, path string, ttl time.Duration) *RemoteFlags {
+	return &RemoteFlags{Client: client, Path: path, TTL: ttl}
+}
+
+func (self *RemoteFlags) Flags(ctx context.Context) (map[string]Flag, error) {
+	self.mutex.Lock()
+	flags, next, err := self.flags, self.next, self.err
+	self.mutex.Unlock()
+	if time.Now().Before(next) {
+		if flags != nil {
+			return flags, nil
+		}
+		return nil, err
+	}
+	fetched, err, _ := self.group.Do("flags", func() (interface{}, error) {
+		return self.fetch(context.WithoutCancel(ctx))
+	})
+	if err != nil {
+		if flags != nil {
+			LoggerFromContext(ctx).Log(WarnLevel, "feature flags refresh failed", Fields{"error": err.Error()})
+			return flags, nil
+		}
+		return nil, err
+	}
+	return fetched.(map[string]Flag), nil
+}
+
+func (self *RemoteFlags) fetch(ctx context.Context) (map[string]Flag, error) {
+	var flags map[string]Flag
+	err := self.Client.Get(ctx, self.Path, nil, &flags)
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if err != nil {
+		if self.failures < 10 {
+			self.failures++
+		}
+		backoff := time.Second << (self.failures - 1)
+		if self.TTL > 0 && backoff > self.TTL {
+			backoff = self.TTL
+		}
+		self.next, self.err = time.Now().Add(backoff), err
+		return nil, err
+	}
+	self.flags, self.next, self.failures, self.err = flags, time.Now().Add(self.TTL), 0, nil
+	return flags, nil
+}
+
+// FeatureFlags holds the flags evaluated for a request.
+type FeatureFlags map[string]bool
+
+func (self FeatureFlags) Enabled(name string) bool {
+	return self[name]
+}
+
+// Active returns the names of the enabled flags, sorted.
+func (self FeatureFlags) Active() []string {
+	var names []string
+	for name, enabled := range self {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FeatureFlagsHeader names the response header listing the flags active for the request. An
+// empty name leaves it out.
+var FeatureFlagsHeader = "X-Feature-Flags"
+
+func FeatureFlagsFromContext(ctx context.Context) FeatureFlags {
+	flags, _ := ctx.Value(FeatureFlagsKey).(FeatureFlags)
+	return flags
+}
+
+func FeatureEnabled(r *http.Request, name string) bool {
+	return FeatureFlagsFromContext(r.Context()).Enabled(name)
+}
+
+// FeatureFlagsMiddlewareFactory evaluates the flags of provider for every request. Percentage
+// rollouts are keyed by the identity, so the auth middleware should run first, or by ClientIP
+// for anonymous requests. When the provider fails, every flag is off.
+func FeatureFlagsMiddlewareFactory(provider FlagProvider) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			flags, err := provider.Flags(r.Context())
+			if err != nil {
+				LoggerFromContext(r.Context()).Log(ErrorLevel, "feature flags unavailable", Fields{"error": err.Error()})
+			}
+			identity := GetIdentity(r)
+			key := ClientIP(r)
+			if identity != nil {
+				key = identity.ID
+			}
+			evaluated := make(FeatureFlags, len(flags))
+			for name, flag := range flags {
+				evaluated[name] = flag.enabledFor(name, identity, key)
+			}
+			if FeatureFlagsHeader != "" {
+				if active := evaluated.Active(); len(active) > 0 {
+					w.Header().Set(FeatureFlagsHeader, strings.Join(active, ","))
+				}
+			}
+			next.ServeHTTP(w, SetInContext(evaluated, FeatureFlagsKey, r))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RequireFeature answers 404 unless flag name is on, hiding routes that are not released yet.
+func RequireFeature(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if !FeatureEnabled(r, name) {
+				HTTP404(r.URL.Path).Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,126 @@
+package httputils
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func coordinateValidator(key string, name string, limit float64) Validator {
+	return func(value interface{}) error {
+		float, ok := value.(float64)
+		if !ok {
+			return Error{Key: key, Description: " Should be float", Code: CodeTypeError, Args: []string{"float"}}
+		}
+		if float < -limit || float > limit {
+			return Error{Key: key, Description: "Invalid " + name, Code: CodeInvalidCoordinateError, Args: []string{name},
+				Meta: map[string]interface{}{"min": -limit, "max": limit, "actual": float}}
+		}
+		return nil
+	}
+}
+
+func LatitudeValidator(key string) Validator {
+	return coordinateValidator(key, "latitude", 90)
+}
+
+func LongitudeValidator(key string) Validator {
+	return coordinateValidator(key, "longitude", 180)
+}
+
+type GeoPoint struct {
+	Lat float64 `json:"lat" bson:"lat"`
+	Lng float64 `json:"lng" bson:"lng"`
+}
+
+// GeoJSON returns the point as a GeoJSON Point, the form 2dsphere indexes expect.
+func (self GeoPoint) GeoJSON() bson.M {
+	return bson.M{"type": "Point", "coordinates": []float64{self.Lng, self.Lat}}
+}
+
+// ParseGeoPoint reads {"lat": 1, "lng": 2} or a GeoJSON Point, whose coordinates are longitude
+// first, reporting errors under key.
+func ParseGeoPoint(key string, value interface{}) (GeoPoint, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return GeoPoint{}, Error{Key: key, Description: "Should be geo point", Code: CodeTypeError, Args: []string{"geo point"}}
+	}
+	var lat, lng interface{}
+	latKey, lngKey := key+".lat", key+".lng"
+	if object["type"] != nil {
+		coordinates, ok := object["coordinates"].([]interface{})
+		if object["type"] != "Point" || !ok || len(coordinates) != 2 {
+			return GeoPoint{}, Error{Key: key, Description: "Invalid GeoJSON point", Code: CodeInvalidCoordinateError, Args: []string{"point"}}
+		}
+		lng, lat = coordinates[0], coordinates[1]
+		lngKey, latKey = key+".coordinates.0", key+".coordinates.1"
+	} else {
+		lat, lng = object["lat"], object["lng"]
+	}
+	if lat == nil {
+		return GeoPoint{}, Error{Key: latKey, Description: "Field is required", Code: CodeRequiredFieldError}
+	}
+	if lng == nil {
+		return GeoPoint{}, Error{Key: lngKey, Description: "Field is required", Code: CodeRequiredFieldError}
+	}
+	if err := LatitudeValidator(latKey)(lat); err != nil {
+		return GeoPoint{}, err
+	}
+	if err := LongitudeValidator(lngKey)(lng); err != nil {
+		return GeoPoint{}, err
+	}
+	return GeoPoint{lat.(float64), lng.(float64)}, nil
+}
+
+// GeoPointValidator accepts the values ParseGeoPoint reads.
+func GeoPointValidator(key string) Validator {
+	return func(value interface{}) error {
+		_, err := ParseGeoPoint(key, value)
+		return err
+	}
+}
+
+type BoundingBox struct {
+	SouthWest GeoPoint `json:"south_west"`
+	NorthEast GeoPoint `json:"north_east"`
+}
+
+// BSON matches documents whose GeoJSON field lies inside the box.
+func (self BoundingBox) BSON(field string) bson.M {
+	sw, ne := self.SouthWest, self.NorthEast
+	ring := [][]float64{{sw.Lng, sw.Lat}, {ne.Lng, sw.Lat}, {ne.Lng, ne.Lat}, {sw.Lng, ne.Lat}, {sw.Lng, sw.Lat}}
+	return bson.M{field: bson.M{"$geoWithin": bson.M{"$geometry": bson.M{"type": "Polygon", "coordinates": [][][]float64{ring}}}}}
+}
+
+// GetBoundingBox reads the query parameter key in the GeoJSON bbox order
+// min_lng,min_lat,max_lng,max_lat, returning nil when it is absent and a 400 when it is invalid.
+func GetBoundingBox(r *http.Request, key string) (*BoundingBox, error) {
+	value := GetValueFromURLInRequest(r, key)
+	if value == nil {
+		return nil, nil
+	}
+	invalid := Error{Key: key, Description: "Invalid bounding box", Code: CodeInvalidCoordinateError, Args: []string{"bbox"}}.AsServerError(400)
+	parts := strings.Split(*value, ",")
+	if len(parts) != 4 {
+		return nil, invalid
+	}
+	numbers := make([]float64, 4)
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, invalid
+		}
+		numbers[i] = number
+	}
+	box := BoundingBox{GeoPoint{numbers[1], numbers[0]}, GeoPoint{numbers[3], numbers[2]}}
+	for _, point := range []GeoPoint{box.SouthWest, box.NorthEast} {
+		if LatitudeValidator(key)(point.Lat) != nil || LongitudeValidator(key)(point.Lng) != nil {
+			return nil, invalid
+		}
+	}
+	if box.SouthWest.Lat > box.NorthEast.Lat || box.SouthWest.Lng > box.NorthEast.Lng {
+		return nil, invalid
+	}
+	return &box, nil
+}
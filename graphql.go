@@ -0,0 +1,278 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an entry of the errors of a response. Errors built by GraphQLErrors carry the
+// package's code, key, args and meta as extensions.
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type GraphQLResponse struct {
+	Data       interface{}            `json:"data,omitempty"`
+	Errors     []GraphQLError         `json:"errors,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLExecutor runs a request against a schema. Adapters wrap libraries such as gqlgen or
+// graph-gophers/graphql-go, using GraphQLErrors for the errors their resolvers return.
+type GraphQLExecutor interface {
+	Execute(ctx context.Context, request GraphQLRequest) GraphQLResponse
+}
+
+type GraphQLExecutorFunc func(ctx context.Context, request GraphQLRequest) GraphQLResponse
+
+func (self GraphQLExecutorFunc) Execute(ctx context.Context, request GraphQLRequest) GraphQLResponse {
+	return self(ctx, request)
+}
+
+func graphQLError(err Error, path []interface{}) GraphQLError {
+	extensions := map[string]interface{}{"code": err.Code, "key": err.Key}
+	if len(err.Args) > 0 {
+		extensions["args"] = err.Args
+	}
+	if len(err.Meta) > 0 {
+		extensions["meta"] = err.Meta
+	}
+	return GraphQLError{Message: err.Description, Path: path, Extensions: extensions}
+}
+
+// GraphQLErrors converts an error returned at path to GraphQL errors: one per Error of a
+// ServerError, the Error itself, or an internal error whose cause is logged and not exposed.
+func GraphQLErrors(ctx context.Context, err error, path ...interface{}) []GraphQLError {
+	var serverError ServerError
+	var fieldError Error
+	switch {
+	case errors.As(err, &serverError):
+		if serverError.StatusCode >= 500 {
+			LoggerFromContext(ctx).Log(ErrorLevel, "graphql resolver failed", Fields{"error": redactedArg(err)})
+		}
+		graphQLErrors := make([]GraphQLError, len(serverError.Errors.Errors))
+		for i, item := range serverError.Errors.Errors {
+			graphQLErrors[i] = graphQLError(item, path)
+			graphQLErrors[i].Extensions["status"] = serverError.StatusCode
+		}
+		return graphQLErrors
+	case errors.As(err, &fieldError):
+		return []GraphQLError{graphQLError(fieldError, path)}
+	}
+	return GraphQLErrors(ctx, Internal(err), path...)
+}
+
+type resolverTrace struct {
+	Path        string `json:"path"`
+	StartOffset int64  `json:"start_offset"`
+	Duration    int64  `json:"duration"`
+	Error       bool   `json:"error,omitempty"`
+}
+
+type graphQLTrace struct {
+	start     time.Time
+	mutex     sync.Mutex
+	resolvers []resolverTrace
+}
+
+type graphQLTraceKey struct{}
+
+// TraceResolver times the resolver of path, such as "Query.user", and must be finished with the
+// error it returns. Traces are returned in the response extensions when GraphQLConfig.Tracing
+// is set and the call does nothing otherwise.
+func TraceResolver(ctx context.Context, path string) func(err error) {
+	trace, _ := ctx.Value(graphQLTraceKey{}).(*graphQLTrace)
+	if trace == nil {
+		return func(err error) {}
+	}
+	start := time.Now()
+	return func(err error) {
+		trace.mutex.Lock()
+		defer trace.mutex.Unlock()
+		trace.resolvers = append(trace.resolvers, resolverTrace{path, int64(start.Sub(trace.start)),
+			int64(time.Since(start)), err != nil})
+	}
+}
+
+type GraphQLConfig struct {
+	Executor GraphQLExecutor
+	// AllowGET serves queries passed in the query string. Mutations are refused over GET.
+	AllowGET bool
+	// Tracing adds the timings recorded with TraceResolver to the response extensions.
+	Tracing bool
+}
+
+func graphQLRequestError(w http.ResponseWriter, status int, message string) {
+	JSON(w, GraphQLResponse{Errors: []GraphQLError{{Message: message,
+		Extensions: map[string]interface{}{"code": CodeInvalidRequest}}}}, status)
+}
+
+// errGraphQLMediaType refuses POST bodies of other types, which cross site forms and simple
+// requests can send with the user's cookies.
+var errGraphQLMediaType = errors.New("httputils: graphql requests must be application/json or application/graphql")
+
+func parseGraphQLRequest(r *http.Request) (GraphQLRequest, error) {
+	var request GraphQLRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		request.Query = query.Get("query")
+		request.OperationName = query.Get("operationName")
+		for key, target := range map[string]*map[string]interface{}{"variables": &request.Variables, "extensions": &request.Extensions} {
+			if value := query.Get(key); value != "" {
+				if err := json.Unmarshal([]byte(value), target); err != nil {
+					return request, err
+				}
+			}
+		}
+		return request, nil
+	}
+	defer r.Body.Close()
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/graphql":
+		data, err := io.ReadAll(r.Body)
+		request.Query = string(data)
+		return request, err
+	case "application/json":
+		return request, json.NewDecoder(r.Body).Decode(&request)
+	}
+	return request, errGraphQLMediaType
+}
+
+// graphQLHasMutation reports whether any operation defined in query is a mutation, whichever one
+// operationName selects. It skips comments and strings, and only looks at the keyword starting
+// each top level definition.
+func graphQLHasMutation(query string) bool {
+	depth := 0
+	definitionStart := true
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], `"""`):
+			end := strings.Index(strings.ReplaceAll(query[i+3:], `\"""`, "xxxx"), `"""`)
+			if end < 0 {
+				return true
+			}
+			i += 3 + end + 3
+		case c == '"':
+			for i++; i < len(query) && query[i] != '"' && query[i] != '\n'; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+			i++
+		case c == '{':
+			depth++
+			definitionStart = false
+			i++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				definitionStart = true
+			}
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(query) && (query[i] == '_' || query[i] >= 'a' && query[i] <= 'z' || query[i] >= 'A' && query[i] <= 'Z' || query[i] >= '0' && query[i] <= '9') {
+				i++
+			}
+			if depth == 0 && definitionStart {
+				if query[start:i] == "mutation" {
+					return true
+				}
+				definitionStart = false
+			}
+		default:
+			i++
+		}
+	}
+	return false
+}
+
+// GraphQLHandler serves GraphQL over HTTP. The executor runs with the request context, so the
+// identity, tenant and logger set by the middlewares reach resolvers; malformed requests are
+// answered with a 400 in the GraphQL error format, and POST bodies that are neither JSON nor
+// application/graphql with a 415.
+func GraphQLHandler(config GraphQLConfig) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && !config.AllowGET {
+			HTTP405().Write(w)
+			return
+		}
+		request, err := parseGraphQLRequest(r)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			HTTP413().Write(w)
+			return
+		}
+		if err == errGraphQLMediaType {
+			HTTP415().Write(w)
+			return
+		}
+		if err != nil || strings.TrimSpace(request.Query) == "" {
+			graphQLRequestError(w, http.StatusBadRequest, "Invalid GraphQL request")
+			return
+		}
+		if r.Method == http.MethodGet && graphQLHasMutation(request.Query) {
+			w.Header().Set("Allow", http.MethodPost)
+			graphQLRequestError(w, http.StatusMethodNotAllowed, "Mutations require POST")
+			return
+		}
+		ctx := r.Context()
+		var trace *graphQLTrace
+		if config.Tracing {
+			trace = &graphQLTrace{start: time.Now()}
+			ctx = context.WithValue(ctx, graphQLTraceKey{}, trace)
+		}
+		response := config.Executor.Execute(ctx, request)
+		if trace != nil {
+			if response.Extensions == nil {
+				response.Extensions = map[string]interface{}{}
+			}
+			trace.mutex.Lock()
+			response.Extensions["tracing"] = map[string]interface{}{
+				"duration":  int64(time.Since(trace.start)),
+				"resolvers": trace.resolvers,
+			}
+			trace.mutex.Unlock()
+		}
+		JSON(w, response, http.StatusOK)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// GraphQL mounts GraphQLHandler at path for POST, and GET when allowed, behind mws.
+func (self *Router) GraphQL(path string, config GraphQLConfig, mws ...func(http.Handler) http.Handler) {
+	handler := GraphQLHandler(config)
+	self.Post(path, handler, mws...)
+	if config.AllowGET {
+		self.Get(path, handler, mws...)
+	}
+}
@@ -0,0 +1,475 @@
+package httputils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GRPCErrorDomain is the ErrorInfo domain of the errors ToGRPCError encodes.
+const GRPCErrorDomain = "httputils"
+
+var grpcHTTPStatuses = map[codes.Code]int{
+	codes.OK:                 200,
+	codes.Canceled:           499,
+	codes.Unknown:            500,
+	codes.InvalidArgument:    400,
+	codes.DeadlineExceeded:   504,
+	codes.NotFound:           404,
+	codes.AlreadyExists:      409,
+	codes.PermissionDenied:   403,
+	codes.ResourceExhausted:  429,
+	codes.FailedPrecondition: 400,
+	codes.Aborted:            409,
+	codes.OutOfRange:         400,
+	codes.Unimplemented:      501,
+	codes.Internal:           500,
+	codes.Unavailable:        503,
+	codes.DataLoss:           500,
+	codes.Unauthenticated:    401,
+}
+
+var grpcErrorCodes = map[codes.Code]string{
+	codes.Canceled:           CodeInvalidRequest,
+	codes.InvalidArgument:    CodeInvalidRequest,
+	codes.DeadlineExceeded:   CodeGatewayTimeout,
+	codes.NotFound:           CodeItemNotFound,
+	codes.AlreadyExists:      CodeDuplicateValueError,
+	codes.PermissionDenied:   CodePermissionDenied,
+	codes.ResourceExhausted:  CodeTooManyRequests,
+	codes.FailedPrecondition: CodeInvalidRequest,
+	codes.Aborted:            CodePreconditionFailed,
+	codes.OutOfRange:         CodeInvalidRequest,
+	codes.Unimplemented:      CodeRouteNotFound,
+	codes.Unavailable:        CodeServiceUnavailable,
+	codes.Unauthenticated:    CodeUnauthorized,
+}
+
+// HTTPStatusFromGRPCCode maps code to the status grpc-gateway answers with.
+func HTTPStatusFromGRPCCode(code codes.Code) int {
+	if status, ok := grpcHTTPStatuses[code]; ok {
+		return status
+	}
+	return 500
+}
+
+// GRPCCodeFromHTTPStatus maps status back to a gRPC code, by class for statuses without a
+// counterpart.
+func GRPCCodeFromHTTPStatus(status int) codes.Code {
+	switch status {
+	case 400:
+		return codes.InvalidArgument
+	case 401:
+		return codes.Unauthenticated
+	case 403:
+		return codes.PermissionDenied
+	case 404:
+		return codes.NotFound
+	case 409:
+		return codes.AlreadyExists
+	case 412, 428:
+		return codes.FailedPrecondition
+	case 429:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case 501:
+		return codes.Unimplemented
+	case 503:
+		return codes.Unavailable
+	case 504:
+		return codes.DeadlineExceeded
+	}
+	if status >= 200 && status < 300 {
+		return codes.OK
+	}
+	if status >= 400 && status < 500 {
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
+
+// ToGRPCError converts err to a status error carrying one ErrorInfo per Error, so gRPC clients
+// and GRPCStatusError read the same key, code, args and HTTP status. Internal errors keep their
+// cause out of the status like WriteError does.
+func ToGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var serverError ServerError
+	if _, ok := status.FromError(err); ok && !errors.As(err, &serverError) {
+		return err
+	}
+	serverError, ok := ToServerError(err)
+	if !ok || serverError.StatusCode >= 500 {
+		DefaultLogger.Log(ErrorLevel, "grpc call failed", Fields{"error": err.Error(), "status": serverError.StatusCode})
+	}
+	message := ""
+	if len(serverError.Errors.Errors) > 0 {
+		message = serverError.Errors.Errors[0].Description
+	}
+	st := status.New(GRPCCodeFromHTTPStatus(serverError.StatusCode), message)
+	details := make([]protoiface.MessageV1, 0, len(serverError.Errors.Errors))
+	for _, item := range serverError.Errors.Errors {
+		info := &errdetails.ErrorInfo{Reason: item.Code, Domain: GRPCErrorDomain, Metadata: map[string]string{
+			"key":         item.Key,
+			"description": item.Description,
+			"status":      strconv.Itoa(serverError.StatusCode),
+		}}
+		if len(item.Args) > 0 {
+			args, _ := json.Marshal(item.Args)
+			info.Metadata["args"] = string(args)
+		}
+		if len(item.Meta) > 0 {
+			encoded, _ := json.Marshal(item.Meta)
+			info.Metadata["meta"] = string(encoded)
+		}
+		details = append(details, info)
+	}
+	if withDetails, detailsErr := st.WithDetails(details...); detailsErr == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// GRPCStatusError converts a gRPC status error to a ServerError, restoring the errors
+// ToGRPCError encoded and otherwise mapping the code like grpc-gateway. The message of server
+// side failures is not exposed. It is registered as an ErrorMapper, so WriteError answers
+// status errors in the package's format.
+func GRPCStatusError(err error) (ServerError, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.OK {
+		return ServerError{}, false
+	}
+	httpStatus := HTTPStatusFromGRPCCode(st.Code())
+	var errs []Error
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != GRPCErrorDomain {
+			continue
+		}
+		item := Error{Key: info.Metadata["key"], Description: info.Metadata["description"], Code: info.Reason}
+		if args := info.Metadata["args"]; args != "" {
+			json.Unmarshal([]byte(args), &item.Args)
+		}
+		if meta := info.Metadata["meta"]; meta != "" {
+			json.Unmarshal([]byte(meta), &item.Meta)
+		}
+		if code, err := strconv.Atoi(info.Metadata["status"]); err == nil {
+			httpStatus = code
+		}
+		errs = append(errs, item)
+	}
+	if len(errs) > 0 {
+		return ServerError{httpStatus, Errors{errs}}, true
+	}
+	if httpStatus >= 500 {
+		serverError := HTTP500()
+		serverError.StatusCode = httpStatus
+		if code, ok := grpcErrorCodes[st.Code()]; ok {
+			serverError.Errors.Errors[0].Code = code
+		}
+		return serverError, true
+	}
+	code, ok := grpcErrorCodes[st.Code()]
+	if !ok {
+		code = CodeInvalidRequest
+	}
+	return ServerError{httpStatus, Errors{[]Error{UndefinedKeyError(code, st.Message())}}}, true
+}
+
+func init() {
+	RegisterErrorMapper(GRPCStatusError)
+}
+
+// UnaryServerErrorInterceptor converts the errors of gRPC handlers with ToGRPCError, so
+// services served over gRPC and through GRPCHandler share one error contract.
+func UnaryServerErrorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, ToGRPCError(err)
+	}
+}
+
+// GRPCForwardedHeaders are the request headers GRPCHandler passes to the call as metadata,
+// besides the Grpc-Metadata- prefixed ones.
+var GRPCForwardedHeaders = []string{"Authorization", "Accept-Language", "User-Agent", "X-Forwarded-For"}
+
+// GRPCMarshalOptions and GRPCUnmarshalOptions encode the messages of GRPCHandler.
+var (
+	GRPCMarshalOptions   = protojson.MarshalOptions{EmitUnpopulated: true}
+	GRPCUnmarshalOptions = protojson.UnmarshalOptions{}
+)
+
+// GRPCMethod describes a unary method served as JSON. Call invokes the service implementation
+// or a client stub with a message from Request.
+type GRPCMethod struct {
+	Request func() proto.Message
+	Call    func(ctx context.Context, request proto.Message) (proto.Message, error)
+	// Body is the field the request body decodes into, "*" for the whole message and empty
+	// for none, as in google.api.http rules.
+	Body string
+	// ForwardMetadata also sets the metadata as outgoing, for a Call that invokes a client stub
+	// of a trusted backend. The metadata carries the Authorization header.
+	ForwardMetadata bool
+}
+
+type gatewayStream struct {
+	method  string
+	mutex   sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (self *gatewayStream) Method() string {
+	return self.method
+}
+
+func (self *gatewayStream) SetHeader(md metadata.MD) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.header = metadata.Join(self.header, md)
+	return nil
+}
+
+func (self *gatewayStream) SendHeader(md metadata.MD) error {
+	return self.SetHeader(md)
+}
+
+func (self *gatewayStream) SetTrailer(md metadata.MD) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.trailer = metadata.Join(self.trailer, md)
+	return nil
+}
+
+func (self *gatewayStream) writeHeaders(w http.ResponseWriter) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for key, values := range self.header {
+		for _, value := range values {
+			w.Header().Add("Grpc-Metadata-"+key, value)
+		}
+	}
+	for key, values := range self.trailer {
+		for _, value := range values {
+			w.Header().Add("Grpc-Trailer-"+key, value)
+		}
+	}
+}
+
+// GRPCMetadata returns the metadata GRPCHandler passes for r: the forwarded headers, the
+// Grpc-Metadata- prefixed headers without their prefix, and the request id.
+func GRPCMetadata(r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	for _, name := range GRPCForwardedHeaders {
+		if values := r.Header.Values(name); len(values) > 0 {
+			md.Append(name, values...)
+		}
+	}
+	for name, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "grpc-metadata-") {
+			md.Append(name[len("grpc-metadata-"):], values...)
+		}
+	}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		md.Set("x-request-id", id)
+	}
+	return md
+}
+
+func protoFieldByName(fields protoreflect.FieldDescriptors, name string) protoreflect.FieldDescriptor {
+	if field := fields.ByName(protoreflect.Name(name)); field != nil {
+		return field
+	}
+	return fields.ByJSONName(name)
+}
+
+func parseProtoScalar(field protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(i)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(i), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		u, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(u)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		u, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(u), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BytesKind:
+		b, err := base64.URLEncoding.DecodeString(value)
+		if err != nil {
+			b, err = base64.StdEncoding.DecodeString(value)
+		}
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.EnumKind:
+		if enum := field.Enum().Values().ByName(protoreflect.Name(value)); enum != nil {
+			return protoreflect.ValueOfEnum(enum.Number()), nil
+		}
+		i, err := strconv.ParseInt(value, 10, 32)
+		if err == nil && field.Enum().Values().ByNumber(protoreflect.EnumNumber(i)) == nil {
+			err = fmt.Errorf("unknown enum value %d", i)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), err
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", field.Kind())
+}
+
+// setProtoField sets the field of msg at the dotted path from values, as grpc-gateway does for
+// path and query parameters. Unknown fields are ignored; message fields such as timestamps are
+// parsed from their JSON string form.
+func setProtoField(msg protoreflect.Message, path string, values []string) error {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		field := protoFieldByName(msg.Descriptor().Fields(), part)
+		if field == nil || field.Kind() != protoreflect.MessageKind || field.IsList() || field.IsMap() {
+			return nil
+		}
+		msg = msg.Mutable(field).Message()
+	}
+	field := protoFieldByName(msg.Descriptor().Fields(), parts[len(parts)-1])
+	if field == nil || field.IsMap() || len(values) == 0 {
+		return nil
+	}
+	if field.Kind() == protoreflect.MessageKind || field.Kind() == protoreflect.GroupKind {
+		if field.IsList() {
+			return nil
+		}
+		return protojson.Unmarshal([]byte(strconv.Quote(values[len(values)-1])), msg.Mutable(field).Message().Interface())
+	}
+	if field.IsList() {
+		list := msg.Mutable(field).List()
+		for _, value := range values {
+			parsed, err := parseProtoScalar(field, value)
+			if err != nil {
+				return err
+			}
+			list.Append(parsed)
+		}
+		return nil
+	}
+	parsed, err := parseProtoScalar(field, values[len(values)-1])
+	if err != nil {
+		return err
+	}
+	msg.Set(field, parsed)
+	return nil
+}
+
+func decodeGRPCBody(r *http.Request, request proto.Message, body string) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil || len(strings.TrimSpace(string(data))) == 0 {
+		return err
+	}
+	if body == "*" {
+		return GRPCUnmarshalOptions.Unmarshal(data, request)
+	}
+	msg := request.ProtoReflect()
+	field := protoFieldByName(msg.Descriptor().Fields(), body)
+	if field == nil {
+		return fmt.Errorf("unknown body field %s", body)
+	}
+	// Decode through a wrapper holding only the body field so any field type is supported.
+	wrapped, err := json.Marshal(map[string]json.RawMessage{field.JSONName(): data})
+	if err != nil {
+		return err
+	}
+	holder := msg.New()
+	if err := GRPCUnmarshalOptions.Unmarshal(wrapped, holder.Interface()); err != nil {
+		return err
+	}
+	msg.Set(field, holder.Get(field))
+	return nil
+}
+
+// GRPCHandler serves method as a JSON endpoint. The request message is decoded from the body
+// according to Body, then path parameters and the query string set fields by name. The call runs
+// with the request context, incoming metadata from GRPCMetadata, outgoing too with
+// ForwardMetadata, and a stream whose headers and trailers are written as Grpc-Metadata- and
+// Grpc-Trailer- headers. Errors are written with WriteError.
+func GRPCHandler(method GRPCMethod) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		request := method.Request()
+		if method.Body != "" && r.Body != nil {
+			defer r.Body.Close()
+			if err := decodeGRPCBody(r, request, method.Body); err != nil {
+				if _, ok := err.(*http.MaxBytesError); ok {
+					HTTP413().Write(w)
+					return
+				}
+				HTTP400().Write(w)
+				return
+			}
+		}
+		collector := NewErrorCollector().Status(400)
+		for key, value := range ParamsFromContext(r.Context()) {
+			if err := setProtoField(request.ProtoReflect(), key, []string{value}); err != nil {
+				collector.AddErrors(Error{Key: key, Description: "Invalid value", Code: CodeTypeError, Args: []string{key}})
+			}
+		}
+		if method.Body != "*" {
+			for key, values := range r.URL.Query() {
+				if err := setProtoField(request.ProtoReflect(), key, values); err != nil {
+					collector.AddErrors(Error{Key: key, Description: "Invalid value", Code: CodeTypeError, Args: []string{key}})
+				}
+			}
+		}
+		if err := collector.Err(); err != nil {
+			WriteError(w, err)
+			return
+		}
+		md := GRPCMetadata(r)
+		ctx := metadata.NewIncomingContext(r.Context(), md)
+		if method.ForwardMetadata {
+			ctx = metadata.NewOutgoingContext(ctx, md)
+		}
+		stream := &gatewayStream{method: r.URL.Path}
+		ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+		response, err := method.Call(ctx, request)
+		stream.writeHeaders(w)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		data, err := GRPCMarshalOptions.Marshal(response)
+		if err != nil {
+			WriteError(w, Internal(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,88 @@
+package httputils
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// GetValidatedHeaders validates the headers named in validatorMap with the same errors as body
+// fields. Keys are looked up case-insensitively and kept as given in validatorMap.
+func GetValidatedHeaders(r *http.Request, validatorMap VMap) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, key := range MapKeys(validatorMap) {
+		if value := r.Header.Get(key); value != "" {
+			values[key] = value
+		} else {
+			values[key] = nil
+		}
+	}
+	errs := ValidateMap(values, validatorMap)
+	if len(errs) > 0 {
+		return nil, ServerError{400, Errors{Errors: errs}}
+	}
+	return values, nil
+}
+
+// WithHeaders validates request headers before the handler runs, answering 400 on failure.
+func WithHeaders(validatorMap VMap) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if _, err := GetValidatedHeaders(r, validatorMap); err != nil {
+				WriteError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return describe(http.HandlerFunc(fn), func(route *Route) {
+			route.addValidators("headers", validatorMap)
+		})
+	}
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// ContentTypeIs reports whether the request media type, ignoring parameters such as charset,
+// is one of types.
+func ContentTypeIs(r *http.Request, types ...string) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsJSON reports whether the client accepts a JSON response. A missing Accept header
+// accepts anything.
+func AcceptsJSON(r *http.Request) bool {
+	values := r.Header.Values("Accept")
+	if len(values) == 0 {
+		return true
+	}
+	for _, item := range strings.Split(strings.Join(values, ","), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil || params["q"] == "0" || params["q"] == "0.0" {
+			continue
+		}
+		switch {
+		case mediaType == "*/*", mediaType == "application/*", mediaType == "application/json",
+			strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package httputils
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type checkerFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (self checkerFunc) Name() string {
+	return self.name
+}
+
+func (self checkerFunc) Check(ctx context.Context) error {
+	return self.check(ctx)
+}
+
+func NewChecker(name string, check func(ctx context.Context) error) Checker {
+	return checkerFunc{name, check}
+}
+
+// PingChecker adapts a context-less ping such as mgo's Session.Ping.
+func PingChecker(name string, ping func() error) Checker {
+	return NewChecker(name, func(ctx context.Context) error {
+		return ping()
+	})
+}
+
+func RedisChecker(client redis.UniversalClient) Checker {
+	return NewChecker("redis", func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	})
+}
+
+type CheckResult struct {
+	Status  string  `json:"status"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+var HealthCheckTimeout = 5 * time.Second
+
+func RunChecks(ctx context.Context, checks ...Checker) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+	defer cancel()
+
+	report := HealthReport{Status: "ok", Checks: make(map[string]CheckResult)}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Checker) {
+			defer wg.Done()
+			t1 := time.Now()
+			err := check.Check(ctx)
+			result := CheckResult{Status: "ok", Latency: float64(time.Since(t1)) / float64(time.Millisecond)}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[check.Name()] = result
+			if err != nil {
+				report.Status = "fail"
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+func HealthHandler(checks ...Checker) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		report := RunChecks(r.Context(), checks...)
+		code := http.StatusOK
+		if report.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		JSON(w, report, code)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Health registers a readiness endpoint that reports 503 while any of checks fails.
+func (self *Router) Health(path string, checks ...Checker) {
+	self.Get(path, HealthHandler(checks...))
+}
+
+// Liveness registers an endpoint that only reports that the process is serving requests.
+func (self *Router) Liveness(path string) {
+	self.Get(path, HealthHandler())
+}
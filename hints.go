@@ -0,0 +1,115 @@
+package httputils
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Preload is a resource a page needs early, announced with a Link rel=preload header.
+type Preload struct {
+	Path string
+	// As is the destination such as "style", "script", "font" or "image".
+	As          string
+	Type        string
+	Crossorigin bool
+}
+
+func (self Preload) link() string {
+	link := "<" + self.Path + ">; rel=preload"
+	if self.As != "" {
+		link += "; as=" + self.As
+	}
+	if self.Type != "" {
+		link += `; type="` + self.Type + `"`
+	}
+	if self.Crossorigin {
+		link += "; crossorigin"
+	}
+	return link
+}
+
+var preloadDestinations = map[string]string{
+	".css": "style", ".js": "script", ".mjs": "script",
+	".woff": "font", ".woff2": "font", ".ttf": "font", ".otf": "font",
+	".png": "image", ".jpg": "image", ".jpeg": "image", ".gif": "image", ".svg": "image", ".webp": "image",
+}
+
+// PreloadStatic describes files served by Router.Static under prefix, guessing As from their
+// extension. Fonts are marked crossorigin as browsers require.
+func PreloadStatic(prefix string, names ...string) []Preload {
+	preloads := make([]Preload, len(names))
+	for i, name := range names {
+		as := preloadDestinations[strings.ToLower(path.Ext(name))]
+		preloads[i] = Preload{Path: path.Join("/", prefix, name), As: as, Crossorigin: as == "font"}
+	}
+	return preloads
+}
+
+func innermostWriter(w http.ResponseWriter) http.ResponseWriter {
+	for {
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return w
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// EarlyHints sends a 103 Early Hints response listing preloads, so browsers start fetching them
+// while the handler is still working. It must be called before the response is written and does
+// nothing under TimeoutMiddlewareFactory, which buffers the response.
+func EarlyHints(w http.ResponseWriter, preloads ...Preload) {
+	if len(preloads) == 0 || ResponseWritten(w) {
+		return
+	}
+	inner := innermostWriter(w)
+	if _, ok := inner.(*timeoutWriter); ok {
+		return
+	}
+	header := inner.Header()
+	for _, preload := range preloads {
+		header.Add("Link", preload.link())
+	}
+	inner.WriteHeader(http.StatusEarlyHints)
+}
+
+// Push starts HTTP/2 server pushes of paths where the connection supports it and ignores them
+// otherwise.
+func Push(w http.ResponseWriter, r *http.Request, paths ...string) {
+	for w != nil {
+		if pusher, ok := w.(http.Pusher); ok {
+			for _, target := range paths {
+				if err := pusher.Push(target, &http.PushOptions{Header: http.Header{"Accept-Encoding": r.Header.Values("Accept-Encoding")}}); err != nil {
+					return
+				}
+			}
+			return
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// WithPreload announces the critical resources of a page route with Early Hints and, over
+// HTTP/2, pushes them, before the handler renders the page.
+func WithPreload(preloads ...Preload) func(http.Handler) http.Handler {
+	paths := make([]string, len(preloads))
+	for i, preload := range preloads {
+		paths[i] = preload.Path
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				EarlyHints(w, preloads...)
+				Push(w, r, paths...)
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,167 @@
+package httputils
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Templates renders html/template pages from an fs.FS. Each page is parsed together with
+// Layout and the Partials, so a layout can call {{block "content" .}} and pages define it.
+type Templates struct {
+	FS fs.FS
+	// Layout is the file executed for every page; pages are executed directly when it is empty.
+	Layout string
+	// Partials is a glob of shared templates, such as "partials/*.html".
+	Partials string
+	Funcs    template.FuncMap
+	// Reload parses the files again on every render, for development.
+	Reload bool
+	mutex  sync.RWMutex
+	cache  map[string]*template.Template
+}
+
+func NewTemplates(fsys fs.FS, layout string) *Templates {
+	return &Templates{FS: fsys, Layout: layout, cache: make(map[string]*template.Template)}
+}
+
+// DefaultTemplates is used by HTML and must be set before rendering.
+var DefaultTemplates *Templates
+
+func (self *Templates) parse(name string) (*template.Template, error) {
+	files := []string{name}
+	if self.Layout != "" {
+		files = []string{self.Layout, name}
+	}
+	t := template.New(path.Base(files[0])).Funcs(self.Funcs)
+	if self.Partials != "" {
+		matches, err := fs.Glob(self.FS, self.Partials)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) > 0 {
+			if t, err = t.ParseFS(self.FS, matches...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t.ParseFS(self.FS, files...)
+}
+
+func (self *Templates) lookup(name string) (*template.Template, error) {
+	if self.Reload {
+		return self.parse(name)
+	}
+	self.mutex.RLock()
+	t, ok := self.cache[name]
+	self.mutex.RUnlock()
+	if ok {
+		return t, nil
+	}
+	t, err := self.parse(name)
+	if err != nil {
+		return nil, err
+	}
+	self.mutex.Lock()
+	if self.cache == nil {
+		self.cache = make(map[string]*template.Template)
+	}
+	self.cache[name] = t
+	self.mutex.Unlock()
+	return t, nil
+}
+
+// Render executes page name with data into a buffer, so nothing is written on failure.
+func (self *Templates) Render(name string, data interface{}) ([]byte, error) {
+	t, err := self.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err := t.Execute(&buffer, data); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// HTML writes page name of DefaultTemplates rendered with data. Failures are logged and
+// answered with a 500.
+func HTML(w http.ResponseWriter, name string, data interface{}, code int) {
+	if DefaultTemplates == nil {
+		DefaultLogger.Log(ErrorLevel, "template rendering failed", Fields{"template": name, "error": "DefaultTemplates is not set"})
+		raise500(w, nil)
+		return
+	}
+	DefaultTemplates.Write(w, name, data, code)
+}
+
+func (self *Templates) Write(w http.ResponseWriter, name string, data interface{}, code int) {
+	body, err := self.Render(name, data)
+	if err != nil {
+		DefaultLogger.Log(ErrorLevel, "template rendering failed", Fields{"template": name, "error": err.Error()})
+		raise500(w, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// ErrorPage is the data of error page templates.
+type ErrorPage struct {
+	Status    int
+	Title     string
+	Errors    []Error
+	RequestID string
+}
+
+// HTMLErrorSerializer renders errors with page name of templates, falling back to
+// JSONErrorSerializer when the page fails to render.
+func HTMLErrorSerializer(templates *Templates, name string) ErrorSerializer {
+	return func(w http.ResponseWriter, serverError ServerError) {
+		page := ErrorPage{serverError.StatusCode, http.StatusText(serverError.StatusCode),
+			serverError.Errors.Errors, w.Header().Get(RequestIDHeader)}
+		body, err := templates.Render(name, page)
+		if err != nil {
+			DefaultLogger.Log(ErrorLevel, "template rendering failed", Fields{"template": name, "error": err.Error()})
+			JSONErrorSerializer(w, serverError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(serverError.StatusCode)
+		w.Write(body)
+	}
+}
+
+// AcceptsHTML reports whether the client asks for text/html explicitly, as browsers do, rather
+// than through a wildcard.
+func AcceptsHTML(r *http.Request) bool {
+	for _, item := range strings.Split(strings.Join(r.Header.Values("Accept"), ","), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err == nil && mediaType == "text/html" && params["q"] != "0" && params["q"] != "0.0" {
+			return true
+		}
+	}
+	return false
+}
+
+// HTMLErrorPagesMiddlewareFactory writes errors as the HTML page name of templates to clients
+// that accept HTML, leaving the JSON errors of API clients unchanged.
+func HTMLErrorPagesMiddlewareFactory(templates *Templates, name string) func(http.Handler) http.Handler {
+	serializer := HTMLErrorSerializer(templates, name)
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if AcceptsHTML(r) {
+				w = serializerResponseWriter{w, serializer}
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
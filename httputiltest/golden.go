@@ -0,0 +1,57 @@
+package httputiltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alexmay23/httputils"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// UpdateGolden rewrites golden files instead of comparing against them. It is set by running
+// the tests with UPDATE_GOLDEN=1.
+var UpdateGolden = os.Getenv("UPDATE_GOLDEN") != ""
+
+// AssertGoldenErrors compares the errors in v, anything accepted by ErrorList, with
+// testdata/<name>.golden. Errors are sorted by key and code first because ValidateMap reports
+// them in map order.
+func AssertGoldenErrors(t testing.TB, name string, v interface{}) {
+	t.Helper()
+	errs := append([]httputils.Error{}, ErrorList(v)...)
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Key != errs[j].Key {
+			return errs[i].Key < errs[j].Key
+		}
+		return errs[i].Code < errs[j].Code
+	})
+	AssertGolden(t, name, httputils.Errors{Errors: errs})
+}
+
+// AssertGolden compares v encoded as indented JSON with testdata/<name>.golden.
+func AssertGolden(t testing.TB, name string, v interface{}) {
+	t.Helper()
+	actual, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("encoding %s: %v", name, err)
+	}
+	actual = append(actual, '\n')
+	path := filepath.Join("testdata", name+".golden")
+	if UpdateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file: %v (run with UPDATE_GOLDEN=1 to create it)", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("%s does not match:\n--- want\n%s\n--- got\n%s", path, expected, actual)
+	}
+}
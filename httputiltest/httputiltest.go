@@ -0,0 +1,93 @@
+// Package httputiltest provides helpers for testing handlers built on httputils.
+package httputiltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alexmay23/httputils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// NewRequest builds a request with params injected the same way the router does, so handlers
+// calling Params or GetValueFromURLInRequest work without routing. Strings, byte slices and
+// readers are sent as the body as is, anything else non-nil as JSON.
+func NewRequest(method string, target string, body interface{}, params map[string]string) *http.Request {
+	var reader io.Reader
+	switch value := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(value)
+	case []byte:
+		reader = bytes.NewReader(value)
+	case io.Reader:
+		reader = value
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			panic(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	return httputils.SetParams(params, req)
+}
+
+// Serve runs handler on req and returns the recorded response.
+func Serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// DecodeErrors reads the error envelope written by JSONErrorSerializer or ProblemSerializer.
+func DecodeErrors(recorder *httptest.ResponseRecorder) (httputils.Errors, error) {
+	var errors httputils.Errors
+	err := json.Unmarshal(recorder.Body.Bytes(), &errors)
+	return errors, err
+}
+
+// AssertError fails t unless the response has status and an error with code and, when key is
+// not empty, key.
+func AssertError(t testing.TB, recorder *httptest.ResponseRecorder, status int, code string, key string) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Errorf("status = %d, want %d; body: %s", recorder.Code, status, recorder.Body.String())
+	}
+	errors, err := DecodeErrors(recorder)
+	if err != nil {
+		t.Errorf("decoding errors: %v; body: %s", err, recorder.Body.String())
+		return
+	}
+	for _, e := range errors.Errors {
+		if e.Code == code && (key == "" || e.Key == key) {
+			return
+		}
+	}
+	t.Errorf("no error with code %q and key %q in %s", code, key, recorder.Body.String())
+}
+
+// AssertStatus fails t unless the response has status.
+func AssertStatus(t testing.TB, recorder *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Errorf("status = %d, want %d; body: %s", recorder.Code, status, recorder.Body.String())
+	}
+}
+
+// DecodeJSON unmarshals the response body into value and fails t if it is not valid JSON.
+func DecodeJSON(t testing.TB, recorder *httptest.ResponseRecorder, value interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), value); err != nil {
+		t.Fatalf("decoding body: %v; body: %s", err, recorder.Body.String())
+	}
+}
@@ -0,0 +1,107 @@
+package httputiltest
+
+import (
+	"errors"
+	"github.com/alexmay23/httputils"
+	"net/http/httptest"
+	"sync"
+)
+
+// MockValidator is a Validator test double that records the values it checks and fails on demand.
+type MockValidator struct {
+	// Err is returned while failing. It defaults to a TYPE_ERROR for Key.
+	Err httputils.Error
+	// FailOn decides per value whether to fail. When nil the validator fails while Fail is set.
+	FailOn func(value interface{}) bool
+	Fail   bool
+	mutex  sync.Mutex
+	calls  []interface{}
+}
+
+func NewMockValidator(key string) *MockValidator {
+	return &MockValidator{Err: httputils.Error{Key: key, Description: "Mock validation failed", Code: httputils.CodeTypeError}}
+}
+
+// Validator returns the function to put in a VMap.
+func (self *MockValidator) Validator() httputils.Validator {
+	return func(value interface{}) error {
+		self.mutex.Lock()
+		defer self.mutex.Unlock()
+		self.calls = append(self.calls, value)
+		fail := self.Fail
+		if self.FailOn != nil {
+			fail = self.FailOn(value)
+		}
+		if fail {
+			return self.Err
+		}
+		return nil
+	}
+}
+
+// Calls returns the values validated so far.
+func (self *MockValidator) Calls() []interface{} {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return append([]interface{}(nil), self.calls...)
+}
+
+// FailingValidator always returns err.
+func FailingValidator(err httputils.Error) httputils.Validator {
+	return func(value interface{}) error {
+		return err
+	}
+}
+
+// ErrorList extracts the individual errors from v, which may be an error such as a ServerError,
+// a []Error as returned by ValidateMap, an Errors envelope or a recorded error response.
+func ErrorList(v interface{}) []httputils.Error {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case []httputils.Error:
+		return value
+	case httputils.Errors:
+		return value.Errors
+	case *httptest.ResponseRecorder:
+		errs, _ := DecodeErrors(value)
+		return errs.Errors
+	case httputils.Error:
+		return []httputils.Error{value}
+	case error:
+		var serverError httputils.ServerError
+		if errors.As(value, &serverError) {
+			return serverError.Errors.Errors
+		}
+		var e httputils.Error
+		if errors.As(value, &e) {
+			return []httputils.Error{e}
+		}
+	}
+	return nil
+}
+
+// HasCode reports whether v, anything accepted by ErrorList, contains an error with code.
+func HasCode(v interface{}, code string) bool {
+	return HasError(v, code, "")
+}
+
+// HasKey reports whether v contains an error for key.
+func HasKey(v interface{}, key string) bool {
+	for _, e := range ErrorList(v) {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// HasError reports whether v contains an error with code and, when key is not empty, key.
+func HasError(v interface{}, code string, key string) bool {
+	for _, e := range ErrorList(v) {
+		if e.Code == code && (key == "" || e.Key == key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package httputiltest
+
+import (
+	"github.com/alexmay23/httputils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Router is a real httputils router that records responses instead of serving connections.
+type Router struct {
+	*httputils.Router
+}
+
+func NewRouter(options ...httputils.RouterOption) *Router {
+	return &Router{httputils.NewRouter(options...)}
+}
+
+// Do routes a request built like NewRequest, with params resolved by the router.
+func (self *Router) Do(method string, target string, body interface{}) *httptest.ResponseRecorder {
+	return Serve(self.Router, NewRequest(method, target, body, nil))
+}
+
+// Case is one row of a table-driven handler test.
+type Case struct {
+	Name   string
+	Method string
+	Target string
+	Params map[string]string
+	Body   interface{}
+	Header http.Header
+	// Prepare adjusts the request, e.g. to set an identity.
+	Prepare func(req *http.Request) *http.Request
+	Status  int
+	// Code and Key, when Code is set, must match one error of the response.
+	Code  string
+	Key   string
+	Check func(t *testing.T, recorder *httptest.ResponseRecorder)
+}
+
+// Run executes every case against handler in its own subtest. Method defaults to GET and Target to /.
+func Run(t *testing.T, handler http.Handler, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			method, target := c.Method, c.Target
+			if method == "" {
+				method = http.MethodGet
+			}
+			if target == "" {
+				target = "/"
+			}
+			req := NewRequest(method, target, c.Body, c.Params)
+			for key, values := range c.Header {
+				req.Header[key] = values
+			}
+			if c.Prepare != nil {
+				req = c.Prepare(req)
+			}
+			recorder := Serve(handler, req)
+			if c.Code != "" {
+				AssertError(t, recorder, c.Status, c.Code, c.Key)
+			} else if c.Status != 0 {
+				AssertStatus(t, recorder, c.Status)
+			}
+			if c.Check != nil {
+				c.Check(t, recorder)
+			}
+		})
+	}
+}
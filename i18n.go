@@ -0,0 +1,225 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// Locale formats values for one language. The zero Locale formats like English.
+type Locale struct {
+	Tag     language.Tag
+	printer *message.Printer
+}
+
+func NewLocale(tag language.Tag) Locale {
+	return Locale{tag, message.NewPrinter(tag)}
+}
+
+func (self Locale) String() string {
+	return self.Tag.String()
+}
+
+func (self Locale) p() *message.Printer {
+	if self.printer == nil {
+		return message.NewPrinter(self.Tag)
+	}
+	return self.printer
+}
+
+// FormatNumber writes value, an integer or float, with the locale's grouping and decimal
+// separators.
+func (self Locale) FormatNumber(value interface{}) string {
+	return self.p().Sprint(number.Decimal(value))
+}
+
+func (self Locale) FormatPercent(value float64) string {
+	return self.p().Sprint(number.Percent(value))
+}
+
+// FormatCurrency writes amount of the ISO 4217 currency code with its symbol, falling back to a
+// plain number when code is unknown.
+func (self Locale) FormatCurrency(amount float64, code string) string {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return self.FormatNumber(amount)
+	}
+	return self.p().Sprint(currency.Symbol(unit.Amount(amount)))
+}
+
+// DateLayouts maps locales to the time layout FormatDate uses. A locale without an entry uses
+// the one of its region-less parent, then ISO 8601.
+var DateLayouts = map[string]string{
+	"en":    "01/02/2006",
+	"en-GB": "02/01/2006",
+	"de":    "02.01.2006",
+	"fr":    "02/01/2006",
+	"es":    "02/01/2006",
+	"it":    "02/01/2006",
+	"pt":    "02/01/2006",
+	"ru":    "02.01.2006",
+	"uk":    "02.01.2006",
+	"pl":    "02.01.2006",
+	"nl":    "02-01-2006",
+	"ja":    "2006/01/02",
+	"zh":    "2006/01/02",
+	"ko":    "2006. 01. 02.",
+}
+
+// TimeLayouts is DateLayouts for FormatTime, defaulting to a 24-hour clock.
+var TimeLayouts = map[string]string{
+	"en": "3:04 PM",
+}
+
+func (self Locale) layout(layouts map[string]string, fallback string) string {
+	for tag := self.Tag; ; tag = tag.Parent() {
+		if layout, ok := layouts[tag.String()]; ok {
+			return layout
+		}
+		if tag == language.Und {
+			return fallback
+		}
+	}
+}
+
+func (self Locale) FormatDate(t time.Time) string {
+	return t.Format(self.layout(DateLayouts, "2006-01-02"))
+}
+
+func (self Locale) FormatTime(t time.Time) string {
+	return t.Format(self.layout(TimeLayouts, "15:04"))
+}
+
+func (self Locale) FormatDateTime(t time.Time) string {
+	return self.FormatDate(t) + " " + self.FormatTime(t)
+}
+
+// Catalog holds translations of error descriptions by locale and error code. Translations may
+// refer to the error's Args as {0}, {1}, and so on.
+type Catalog struct {
+	mutex    sync.RWMutex
+	messages map[language.Tag]map[string]string
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{messages: make(map[language.Tag]map[string]string)}
+}
+
+// DefaultCatalog translates the errors of the validators for LocaleMiddlewareFactory.
+var DefaultCatalog = NewCatalog()
+
+func (self *Catalog) Set(tag language.Tag, code string, message string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.messages[tag] == nil {
+		self.messages[tag] = make(map[string]string)
+	}
+	self.messages[tag][code] = message
+}
+
+// Languages returns the locales with translations.
+func (self *Catalog) Languages() []language.Tag {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	tags := make([]language.Tag, 0, len(self.messages))
+	for tag := range self.messages {
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func (self *Catalog) lookup(tag language.Tag, code string) (string, bool) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	for ; ; tag = tag.Parent() {
+		if message, ok := self.messages[tag][code]; ok {
+			return message, true
+		}
+		if tag == language.Und {
+			return "", false
+		}
+	}
+}
+
+// Translate returns err with its description in the language of tag, or unchanged when there
+// is no translation of its code.
+func (self *Catalog) Translate(tag language.Tag, err Error) Error {
+	message, ok := self.lookup(tag, err.Code)
+	if !ok {
+		return err
+	}
+	replacements := make([]string, 0, 2*len(err.Args))
+	for i, arg := range err.Args {
+		replacements = append(replacements, "{"+strconv.Itoa(i)+"}", arg)
+	}
+	err.Description = strings.NewReplacer(replacements...).Replace(message)
+	return err
+}
+
+func LocaleFromContext(ctx context.Context) Locale {
+	if locale, ok := ctx.Value(LocaleKey).(Locale); ok {
+		return locale
+	}
+	return NewLocale(language.English)
+}
+
+func GetLocale(r *http.Request) Locale {
+	return LocaleFromContext(r.Context())
+}
+
+type LocaleConfig struct {
+	// Supported lists the locales offered, the first being the default. It must not be empty.
+	Supported []language.Tag
+	// Catalog translates error descriptions, DefaultCatalog when nil.
+	Catalog *Catalog
+	// QueryParam, when set, names a query parameter such as "lang" that overrides Accept-Language.
+	QueryParam string
+}
+
+// LocaleMiddlewareFactory negotiates the locale from Accept-Language among the supported ones,
+// stores it in the context for GetLocale and answers with Content-Language. Errors written by
+// the wrapped handlers have their descriptions translated by the catalog before being serialized.
+func LocaleMiddlewareFactory(config LocaleConfig) func(http.Handler) http.Handler {
+	if len(config.Supported) == 0 {
+		panic("httputils: LocaleConfig.Supported is empty")
+	}
+	if config.Catalog == nil {
+		config.Catalog = DefaultCatalog
+	}
+	matcher := language.NewMatcher(config.Supported)
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			var preferred []string
+			if config.QueryParam != "" {
+				if lang := r.URL.Query().Get(config.QueryParam); lang != "" {
+					preferred = append(preferred, lang)
+				}
+			}
+			preferred = append(preferred, r.Header.Values("Accept-Language")...)
+			_, index := language.MatchStrings(matcher, preferred...)
+			locale := NewLocale(config.Supported[index])
+			w.Header().Set("Content-Language", locale.String())
+			w.Header().Add("Vary", "Accept-Language")
+
+			serializer := errorSerializerFor(w)
+			w = serializerResponseWriter{w, func(w http.ResponseWriter, serverError ServerError) {
+				translated := make([]Error, len(serverError.Errors.Errors))
+				for i, err := range serverError.Errors.Errors {
+					translated[i] = config.Catalog.Translate(locale.Tag, err)
+				}
+				serializer(w, ServerError{serverError.StatusCode, Errors{translated}})
+			}}
+			next.ServeHTTP(w, SetInContext(locale, LocaleKey, r))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
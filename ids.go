@@ -0,0 +1,89 @@
+package httputils
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+)
+
+// IDType describes how document identifiers look in URLs and in the database, so helpers that
+// accept ids work for stores that do not use Mongo ObjectIds.
+type IDType interface {
+	Valid(value string) bool
+	Parse(value string) interface{}
+	Format(id interface{}) string
+}
+
+type ObjectIDType struct{}
+
+func (ObjectIDType) Valid(value string) bool {
+	return bson.IsObjectIdHex(value)
+}
+
+func (ObjectIDType) Parse(value string) interface{} {
+	return bson.ObjectIdHex(value)
+}
+
+func (ObjectIDType) Format(id interface{}) string {
+	if objectID, ok := id.(bson.ObjectId); ok {
+		return objectID.Hex()
+	}
+	if s, ok := id.(interface{ Hex() string }); ok {
+		return s.Hex()
+	}
+	return ""
+}
+
+type UUIDType struct{}
+
+func (UUIDType) Valid(value string) bool {
+	return IsUUID(value)
+}
+
+func (UUIDType) Parse(value string) interface{} {
+	return strings.ToLower(value)
+}
+
+func (UUIDType) Format(id interface{}) string {
+	s, _ := id.(string)
+	return s
+}
+
+type StringIDType struct{}
+
+func (StringIDType) Valid(value string) bool {
+	return len(value) > 0
+}
+
+func (StringIDType) Parse(value string) interface{} {
+	return value
+}
+
+func (StringIDType) Format(id interface{}) string {
+	s, _ := id.(string)
+	return s
+}
+
+var DefaultIDType IDType = ObjectIDType{}
+
+// ParamID parses the path parameter key with DefaultIDType, answering 404 for malformed ids.
+func ParamID(r *http.Request, key string) (interface{}, error) {
+	value, err := ParamString(r, key)
+	if err != nil {
+		return nil, err
+	}
+	if !DefaultIDType.Valid(value) {
+		return nil, HTTP404(value)
+	}
+	return DefaultIDType.Parse(value), nil
+}
+
+func IDValidator(key string) Validator {
+	return func(value interface{}) error {
+		str, ok := value.(string)
+		if !ok || !DefaultIDType.Valid(str) {
+			return Error{Key: key, Description: " Should be id", Code: CodeTypeError, Args: []string{"id"}}
+		}
+		return nil
+	}
+}
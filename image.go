@@ -0,0 +1,343 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/singleflight"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ImageFitContain = "contain"
+	ImageFitCover   = "cover"
+	ImageFitFill    = "fill"
+)
+
+type ImageConfig struct {
+	// FS holds local sources, named by the path under the mount point or the src parameter.
+	FS fs.FS
+	// AllowedHosts lists the hosts remote sources may be fetched from, given as an http or https
+	// URL in src. A "*." prefix allows subdomains. No remote source is fetched when it is empty.
+	AllowedHosts []string
+	// Client fetches remote sources, a client with a 10 second timeout when nil.
+	Client *http.Client
+	// Cache stores resized images for CacheTTL, which is 30 days when zero.
+	Cache    Cache
+	CacheTTL time.Duration
+	// MaxWidth and MaxHeight bound the w and h parameters, 2048 when zero.
+	MaxWidth  int
+	MaxHeight int
+	// MaxSourceBytes and MaxSourcePixels bound the sources decoded, 20 MB and 40 megapixels
+	// when zero, so a small compressed file cannot expand into a huge bitmap.
+	MaxSourceBytes  int64
+	MaxSourcePixels int
+	// MaxAge is sent in Cache-Control, a year when zero.
+	MaxAge time.Duration
+	// Quality is the JPEG quality, 85 when zero.
+	Quality int
+}
+
+type imageRequest struct {
+	source string
+	width  int
+	height int
+	fit    string
+}
+
+func (self ImageConfig) withDefaults() ImageConfig {
+	if self.Client == nil {
+		self.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if self.CacheTTL == 0 {
+		self.CacheTTL = 30 * 24 * time.Hour
+	}
+	if self.MaxWidth == 0 {
+		self.MaxWidth = 2048
+	}
+	if self.MaxHeight == 0 {
+		self.MaxHeight = 2048
+	}
+	if self.MaxSourceBytes == 0 {
+		self.MaxSourceBytes = 20 << 20
+	}
+	if self.MaxSourcePixels == 0 {
+		self.MaxSourcePixels = 40000000
+	}
+	if self.MaxAge == 0 {
+		self.MaxAge = 365 * 24 * time.Hour
+	}
+	if self.Quality == 0 {
+		self.Quality = 85
+	}
+	return self
+}
+
+func (self ImageConfig) hostAllowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range self.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func imageDimension(collector *ErrorCollector, query url.Values, key string, max int) int {
+	value := query.Get(key)
+	if value == "" {
+		return 0
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		collector.Add(key, CodeTypeError, " Should be int", "int")
+		return 0
+	}
+	if number < 1 || number > max {
+		collector.AddErrors(Error{Key: key, Description: "Integer is out of range", Code: CodeIntRangeError, Args: []string{"1", strconv.Itoa(max)},
+			Meta: map[string]interface{}{"min": 1, "max": max}})
+	}
+	return number
+}
+
+func (self ImageConfig) parseRequest(r *http.Request) (imageRequest, error) {
+	query := r.URL.Query()
+	collector := NewErrorCollector().Status(400)
+	request := imageRequest{source: strings.TrimPrefix(Params(r)["filepath"], "/"), fit: ImageFitContain}
+	if request.source == "" {
+		request.source = query.Get("src")
+	}
+	if request.source == "" {
+		collector.Add("src", CodeRequiredFieldError, "Field is required")
+	}
+	request.width = imageDimension(collector, query, "w", self.MaxWidth)
+	request.height = imageDimension(collector, query, "h", self.MaxHeight)
+	if fit := query.Get("fit"); fit != "" {
+		if fit != ImageFitContain && fit != ImageFitCover && fit != ImageFitFill {
+			collector.Add("fit", CodeTypeError, "Should be one of contain, cover, fill", ImageFitContain, ImageFitCover, ImageFitFill)
+		}
+		request.fit = fit
+	}
+	if request.fit != ImageFitContain && (request.width == 0 || request.height == 0) {
+		collector.Add("fit", CodeRequiredFieldError, "Cover and fill need both w and h", "w", "h")
+	}
+	return request, collector.Err()
+}
+
+// key identifies the resized image in the cache and as its ETag.
+func (self imageRequest) key() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%s", self.source, self.width, self.height, self.fit)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (self ImageConfig) open(ctx context.Context, source string) (io.ReadCloser, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		target, err := url.Parse(source)
+		if err != nil || !self.hostAllowed(target.Hostname()) {
+			return nil, ServerError{400, Errors{[]Error{{Key: "src", Description: "Host is not allowed", Code: CodeInvalidURLError, Args: []string{source}}}}}
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+		if err != nil {
+			return nil, Internal(err)
+		}
+		client := *self.Client
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 || !self.hostAllowed(req.URL.Hostname()) {
+				return errors.New("redirect to a host that is not allowed")
+			}
+			return nil
+		}
+		response, err := client.Do(req)
+		if err != nil {
+			return nil, HTTP502().Wrap(err)
+		}
+		if response.StatusCode == http.StatusNotFound {
+			response.Body.Close()
+			return nil, HTTP404(source)
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return nil, HTTP502().Wrap(fmt.Errorf("image source answered %d", response.StatusCode))
+		}
+		return response.Body, nil
+	}
+	name, ok := cleanFilePath(source)
+	if self.FS == nil || !ok {
+		return nil, HTTP404(source)
+	}
+	file, err := noListingFS{self.FS}.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, HTTP404(source)
+	}
+	if err != nil {
+		return nil, Internal(err)
+	}
+	return file, nil
+}
+
+// imageSize returns the size of an image of width and height resized for request.
+func imageSize(width int, height int, request imageRequest) (int, int) {
+	if request.fit != ImageFitContain {
+		return request.width, request.height
+	}
+	scale := 1.0
+	if request.width > 0 && float64(request.width)/float64(width) < scale {
+		scale = float64(request.width) / float64(width)
+	}
+	if request.height > 0 && float64(request.height)/float64(height) < scale {
+		scale = float64(request.height) / float64(height)
+	}
+	return max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+}
+
+// coverCrop returns the centered part of bounds with the aspect ratio of width by height.
+func coverCrop(bounds image.Rectangle, width int, height int) image.Rectangle {
+	cropWidth, cropHeight := bounds.Dx(), bounds.Dy()
+	if cropWidth*height > cropHeight*width {
+		cropWidth = cropHeight * width / height
+	} else {
+		cropHeight = cropWidth * height / width
+	}
+	x := bounds.Min.X + (bounds.Dx()-cropWidth)/2
+	y := bounds.Min.Y + (bounds.Dy()-cropHeight)/2
+	return image.Rect(x, y, x+cropWidth, y+cropHeight)
+}
+
+// resize decodes the source and encodes the resized image in its format, returning the bytes
+// and the content type. GIFs are resized from their first frame and served as PNG.
+func (self ImageConfig) resize(ctx context.Context, request imageRequest) ([]byte, string, error) {
+	source, err := self.open(ctx, request.source)
+	if err != nil {
+		return nil, "", err
+	}
+	defer source.Close()
+	data, err := io.ReadAll(io.LimitReader(source, self.MaxSourceBytes+1))
+	if err != nil {
+		return nil, "", HTTP502().Wrap(err)
+	}
+	if int64(len(data)) > self.MaxSourceBytes {
+		return nil, "", HTTP413()
+	}
+	invalid := ServerError{400, Errors{[]Error{{Key: "src", Description: "Source is not a supported image", Code: CodeInvalidFileTypeError,
+		Args: []string{"image/jpeg", "image/png", "image/gif"}}}}}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", invalid
+	}
+	if config.Width*config.Height > self.MaxSourcePixels {
+		return nil, "", HTTP413()
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", invalid
+	}
+	bounds := src.Bounds()
+	width, height := imageSize(bounds.Dx(), bounds.Dy(), request)
+	if request.fit == ImageFitCover {
+		bounds = coverCrop(bounds, width, height)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var out bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: self.Quality})
+		return out.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&out, dst)
+	return out.Bytes(), "image/png", err
+}
+
+// ImageHandler serves resized images. The source is the path under the mount point or the src
+// parameter, a name in FS or a URL on an allowed host. w and h bound the size: with fit=contain,
+// the default, the image is scaled down to fit them; cover scales and crops to fill them; fill
+// stretches to them. Results are cached in Cache, concurrent requests for the same image are
+// resized once, and responses carry an ETag and a long-lived Cache-Control.
+func ImageHandler(config ImageConfig) http.Handler {
+	config = config.withDefaults()
+	var group singleflight.Group
+	maxAge := fmt.Sprintf("public, max-age=%d, immutable", int(config.MaxAge.Seconds()))
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		request, err := config.parseRequest(r)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		key := request.key()
+		etag := `"` + key + `"`
+		if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && strings.Contains(ifNoneMatch, etag) {
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", maxAge)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		cacheKey := "image:" + key
+		var body []byte
+		if config.Cache != nil {
+			body, err = config.Cache.Get(r.Context(), cacheKey)
+		}
+		if config.Cache == nil || err != nil {
+			if err != nil && err != ErrCacheMiss {
+				LoggerFromContext(r.Context()).Log(ErrorLevel, "image cache failed", Fields{"error": err.Error()})
+			}
+			result, err, _ := group.Do(cacheKey, func() (interface{}, error) {
+				// Detached from the request so that waiting requests are not failed when the
+				// one that started the resize goes away.
+				ctx := context.WithoutCancel(r.Context())
+				data, contentType, err := config.resize(ctx, request)
+				if err != nil {
+					return nil, err
+				}
+				// The content type is stored before the image, separated by a newline.
+				body := append([]byte(contentType+"\n"), data...)
+				if config.Cache != nil {
+					if err := config.Cache.Set(ctx, cacheKey, body, config.CacheTTL); err != nil {
+						LoggerFromContext(ctx).Log(ErrorLevel, "image cache failed", Fields{"error": err.Error()})
+					}
+				}
+				return body, nil
+			})
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			body = result.([]byte)
+		}
+		contentType, data, ok := bytes.Cut(body, []byte("\n"))
+		if !ok {
+			WriteError(w, Internal(errors.New("malformed cached image")))
+			return
+		}
+		w.Header().Set("Content-Type", string(contentType))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", maxAge)
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(data)
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Images mounts ImageHandler under prefix, serving local sources by path and remote ones
+// through the src parameter.
+func (self *Router) Images(prefix string, config ImageConfig, mws ...func(http.Handler) http.Handler) {
+	self.Get(strings.TrimSuffix(prefix, "/")+"/*filepath", ImageHandler(config), mws...)
+}
@@ -0,0 +1,67 @@
+package httputils
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+func HTTP503() ServerError {
+	return ServerError{503, Errors{[]Error{UndefinedKeyError(CodeServiceUnavailable, "Server is overloaded")}}}
+}
+
+// MaintenanceMiddleware answers every request with a 503 while the service is down for
+// maintenance.
+func MaintenanceMiddleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		ServerError{503, Errors{[]Error{UndefinedKeyError(CodeServiceUnavailable, "Service is under maintenance")}}}.Write(w)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// MaxInFlightMiddlewareFactory lets at most n requests run at once. Up to queueLen more wait for
+// a slot for at most queueTimeout; any others, and those still waiting after it, are shed with a
+// 503 and Retry-After.
+func MaxInFlightMiddlewareFactory(n int, queueLen int, queueTimeout time.Duration) func(http.Handler) http.Handler {
+	slots := make(chan struct{}, n)
+	var waiting int64
+	shed := func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "1")
+		HTTP503().Write(w)
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				if atomic.AddInt64(&waiting, 1) > int64(queueLen) {
+					atomic.AddInt64(&waiting, -1)
+					shed(w)
+					return
+				}
+				timer := time.NewTimer(queueTimeout)
+				select {
+				case slots <- struct{}{}:
+					timer.Stop()
+					atomic.AddInt64(&waiting, -1)
+				case <-timer.C:
+					atomic.AddInt64(&waiting, -1)
+					shed(w)
+					return
+				case <-r.Context().Done():
+					timer.Stop()
+					atomic.AddInt64(&waiting, -1)
+					return
+				}
+			}
+			defer func() {
+				<-slots
+			}()
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
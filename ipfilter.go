@@ -0,0 +1,166 @@
+package httputils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IPLists holds CIDRs, or bare addresses, to allow and deny.
+type IPLists struct {
+	Allow []string `json:"allow" yaml:"allow"`
+	Deny  []string `json:"deny" yaml:"deny"`
+}
+
+// IPListProvider supplies lists that change at runtime, such as ones kept in a database.
+type IPListProvider interface {
+	IPLists(ctx context.Context) (IPLists, error)
+}
+
+type IPListProviderFunc func(ctx context.Context) (IPLists, error)
+
+func (self IPListProviderFunc) IPLists(ctx context.Context) (IPLists, error) {
+	return self(ctx)
+}
+
+type ipListDocument struct {
+	CIDR   string `json:"cidr" bson:"cidr"`
+	Action string `json:"action" bson:"action"`
+}
+
+// StoreIPListProvider reads documents of the form {"cidr": "10.0.0.0/8", "action": "allow"}
+// from store; any action other than "allow" denies.
+func StoreIPListProvider(store Store) IPListProvider {
+	return IPListProviderFunc(func(ctx context.Context) (IPLists, error) {
+		var documents []ipListDocument
+		if err := store.Find(ctx, nil).All(&documents); err != nil {
+			return IPLists{}, err
+		}
+		var lists IPLists
+		for _, document := range documents {
+			if document.Action == "allow" {
+				lists.Allow = append(lists.Allow, document.CIDR)
+			} else {
+				lists.Deny = append(lists.Deny, document.CIDR)
+			}
+		}
+		return lists, nil
+	})
+}
+
+type IPFilterConfig struct {
+	IPLists
+	// Provider lists are added to the static ones and fetched again every RefreshInterval, one
+	// minute by default. When a refresh fails the previous lists are kept.
+	Provider        IPListProvider
+	RefreshInterval time.Duration
+	// FetchTimeout bounds each fetch of the provider lists, 10 seconds by default.
+	FetchTimeout time.Duration
+	// FailClosed denies every client until the provider lists were fetched once. Otherwise only
+	// the static lists apply until then.
+	FailClosed bool
+}
+
+type ipNetworks struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func (self ipNetworks) allowed(ip string) bool {
+	if containsIP(self.deny, ip) {
+		return false
+	}
+	return len(self.allow) == 0 || containsIP(self.allow, ip)
+}
+
+type ipFilter struct {
+	config    IPFilterConfig
+	static    ipNetworks
+	mutex     sync.RWMutex
+	networks  ipNetworks
+	fetched   time.Time
+	refreshes sync.Mutex
+	loaded    sync.Once
+	ready     bool
+}
+
+// refresh fetches the provider lists with a context of its own, so that a request going away
+// does not cut short a fetch other requests rely on, bounded by FetchTimeout.
+func (self *ipFilter) refresh() {
+	if !self.refreshes.TryLock() {
+		return
+	}
+	defer self.refreshes.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), self.config.FetchTimeout)
+	defer cancel()
+	lists, err := self.config.Provider.IPLists(ctx)
+	if err == nil {
+		var networks ipNetworks
+		if networks.allow, err = ParseCIDRs(lists.Allow); err == nil {
+			networks.deny, err = ParseCIDRs(lists.Deny)
+		}
+		if err == nil {
+			networks.allow = append(networks.allow, self.static.allow...)
+			networks.deny = append(networks.deny, self.static.deny...)
+			self.mutex.Lock()
+			self.networks, self.ready = networks, true
+			self.mutex.Unlock()
+		}
+	}
+	if err != nil {
+		DefaultLogger.Log(ErrorLevel, "ip lists refresh failed", Fields{"error": err.Error()})
+	}
+	self.mutex.Lock()
+	self.fetched = time.Now()
+	self.mutex.Unlock()
+}
+
+// current returns the lists, waiting for the first fetch of the provider lists so that their
+// denials apply from the first request on. It reports false while FailClosed denies everyone.
+func (self *ipFilter) current() (ipNetworks, bool) {
+	if self.config.Provider == nil {
+		return self.networks, true
+	}
+	self.loaded.Do(self.refresh)
+	self.mutex.RLock()
+	networks, fetched, ready := self.networks, self.fetched, self.ready
+	self.mutex.RUnlock()
+	if time.Since(fetched) >= self.config.RefreshInterval {
+		go self.refresh()
+	}
+	return networks, ready || !self.config.FailClosed
+}
+
+// IPFilterMiddlewareFactory answers 403 to clients whose ClientIP is denied, or not allowed when
+// there is an allow list. Deny wins over allow. RealIPMiddlewareFactory must run first behind a
+// proxy. It panics on an invalid CIDR in the static lists.
+func IPFilterMiddlewareFactory(config IPFilterConfig) func(http.Handler) http.Handler {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Minute
+	}
+	if config.FetchTimeout <= 0 {
+		config.FetchTimeout = 10 * time.Second
+	}
+	filter := &ipFilter{config: config}
+	var err error
+	if filter.static.allow, err = ParseCIDRs(config.Allow); err != nil {
+		panic(err)
+	}
+	if filter.static.deny, err = ParseCIDRs(config.Deny); err != nil {
+		panic(err)
+	}
+	filter.networks = filter.static
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if networks, ok := filter.current(); !ok || !networks.allowed(ClientIP(r)) {
+				HTTP403().Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
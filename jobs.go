@@ -0,0 +1,155 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrJobQueueFull     = errors.New("httputils: job queue is full")
+	ErrJobRunnerStopped = errors.New("httputils: job runner is stopped")
+)
+
+type Job func(ctx context.Context) error
+
+type queuedJob struct {
+	name string
+	run  Job
+}
+
+type JobStatus struct {
+	Workers   int   `json:"workers"`
+	Queued    int   `json:"queued"`
+	Running   int64 `json:"running"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+// JobRunner runs jobs in the background on a fixed pool of workers, so handlers can hand off
+// slow work such as emails and webhooks and answer right away.
+type JobRunner struct {
+	Logger    Logger
+	workers   int
+	queue     chan queuedJob
+	mutex     sync.RWMutex
+	stopped   bool
+	wg        sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+	running   int64
+	completed int64
+	failed    int64
+}
+
+// NewJobRunner starts workers goroutines serving a queue of up to queueSize waiting jobs.
+func NewJobRunner(workers int, queueSize int) *JobRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := &JobRunner{
+		Logger:  DefaultLogger,
+		workers: workers,
+		queue:   make(chan queuedJob, queueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	runner.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go runner.work()
+	}
+	return runner
+}
+
+// Enqueue queues job without waiting, returning ErrJobQueueFull when the queue is full and
+// ErrJobRunnerStopped once Drain was called. The name is used in logs.
+func (self *JobRunner) Enqueue(name string, job Job) error {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	if self.stopped {
+		return ErrJobRunnerStopped
+	}
+	select {
+	case self.queue <- queuedJob{name, job}:
+		return nil
+	default:
+		return ErrJobQueueFull
+	}
+}
+
+func (self *JobRunner) work() {
+	defer self.wg.Done()
+	for job := range self.queue {
+		self.run(job)
+	}
+}
+
+func (self *JobRunner) run(job queuedJob) {
+	atomic.AddInt64(&self.running, 1)
+	defer atomic.AddInt64(&self.running, -1)
+	t1 := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("panic: %v", recovered)
+				self.Logger.Log(ErrorLevel, "job panicked", Fields{"job": job.name, "stack": string(debug.Stack())})
+			}
+		}()
+		return job.run(self.ctx)
+	}()
+	if err != nil {
+		atomic.AddInt64(&self.failed, 1)
+		self.Logger.Log(ErrorLevel, "job failed", Fields{"job": job.name, "error": err.Error(), "duration": time.Since(t1).String()})
+		return
+	}
+	atomic.AddInt64(&self.completed, 1)
+	self.Logger.Log(DebugLevel, "job completed", Fields{"job": job.name, "duration": time.Since(t1).String()})
+}
+
+// Drain stops accepting jobs and waits for the queued ones to finish. When ctx is done first,
+// the context of running jobs is cancelled and ctx's error returned.
+func (self *JobRunner) Drain(ctx context.Context) error {
+	self.mutex.Lock()
+	if !self.stopped {
+		self.stopped = true
+		close(self.queue)
+	}
+	self.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		self.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		self.cancel()
+		return nil
+	case <-ctx.Done():
+		self.cancel()
+		return ctx.Err()
+	}
+}
+
+func (self *JobRunner) Status() JobStatus {
+	return JobStatus{
+		Workers:   self.workers,
+		Queued:    len(self.queue),
+		Running:   atomic.LoadInt64(&self.running),
+		Completed: atomic.LoadInt64(&self.completed),
+		Failed:    atomic.LoadInt64(&self.failed),
+	}
+}
+
+// StatusHandler reports the runner's Status as JSON.
+func (self *JobRunner) StatusHandler() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		JSON(w, self.Status(), http.StatusOK)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,93 @@
+package httputils
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Links maps relation types such as self, next or prev to URLs.
+type Links map[string]string
+
+func (self Links) Add(rel string, href string) Links {
+	if href != "" {
+		self[rel] = href
+	}
+	return self
+}
+
+// AddRoute links rel to the named route of router, built like Router.URLFor.
+func (self Links) AddRoute(router *Router, rel string, name string, params map[string]string) error {
+	href, err := router.URLFor(name, params)
+	if err != nil {
+		return err
+	}
+	self[rel] = href
+	return nil
+}
+
+// Header formats the links as an RFC 8288 Link header value, ordered by relation.
+func (self Links) Header() string {
+	rels := make([]string, 0, len(self))
+	for rel := range self {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	values := make([]string, len(rels))
+	for i, rel := range rels {
+		values[i] = "<" + self[rel] + `>; rel="` + rel + `"`
+	}
+	return strings.Join(values, ", ")
+}
+
+func SetLinkHeader(w http.ResponseWriter, links Links) {
+	if len(links) > 0 {
+		w.Header().Add("Link", links.Header())
+	}
+}
+
+// SelfLink returns the path and query of the current request.
+func SelfLink(r *http.Request) string {
+	return r.URL.RequestURI()
+}
+
+// withQuery returns the current request URI with key replaced by value and the drop keys removed.
+func withQuery(r *http.Request, key string, value string, drop ...string) string {
+	query := r.URL.Query()
+	for _, name := range drop {
+		query.Del(name)
+	}
+	query.Set(key, value)
+	u := url.URL{Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: query.Encode()}
+	return u.RequestURI()
+}
+
+// PageLinks returns self, next and prev links for page, pointing at the current path with the
+// page's cursors.
+func PageLinks(r *http.Request, page Page) Links {
+	links := Links{"self": SelfLink(r)}
+	if page.NextCursor != "" {
+		links.Add("next", withQuery(r, "cursor", page.NextCursor, "offset"))
+	}
+	if page.PrevCursor != "" {
+		links.Add("prev", withQuery(r, "cursor", page.PrevCursor, "offset"))
+	}
+	return links
+}
+
+// WriteLinkedPage adds PageLinks to page, in its body and in the Link header, and writes it
+// like WritePage.
+func WriteLinkedPage(w http.ResponseWriter, r *http.Request, page Page, err error) {
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	links := PageLinks(r, page)
+	for rel, href := range page.Links {
+		links[rel] = href
+	}
+	page.Links = links
+	SetLinkHeader(w, links)
+	WritePage(w, page, nil)
+}
@@ -0,0 +1,161 @@
+package httputils
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP423 reports a locked account, with the seconds until it unlocks in Meta.
+func HTTP423(retryAfter time.Duration) ServerError {
+	return ServerError{423, Errors{[]Error{Error{Key: "undefined", Description: "Account is locked", Code: CodeAccountLocked,
+		Meta: map[string]interface{}{"retry_after": int(math.Ceil(retryAfter.Seconds()))}}}}}
+}
+
+// LoginAttemptTracker slows down and then locks out repeated failed logins of an identity, such
+// as a username or email, from one IP. Each failure makes the next attempt wait BaseDelay,
+// doubled for every further failure up to MaxDelay; once Failures reaches its limit the pair is
+// locked for Lockout. Locks and delays live in Cache, so with a shared cache and a Redis limiter
+// they hold across instances.
+type LoginAttemptTracker struct {
+	Cache Cache
+	// Failures counts failures by identity and IP. Its limit is the number of failures within its
+	// window that lock the pair out, as with NewMemorySlidingWindow(5, 15*time.Minute).
+	Failures  RateLimiter
+	Lockout   time.Duration
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// NewLoginAttemptTracker locks an identity out of an IP for 15 minutes after 5 failures in 15
+// minutes, with delays from 1 to 30 seconds before that.
+func NewLoginAttemptTracker(cache Cache) *LoginAttemptTracker {
+	return &LoginAttemptTracker{
+		Cache:     cache,
+		Failures:  NewMemorySlidingWindow(5, 15*time.Minute),
+		Lockout:   15 * time.Minute,
+		BaseDelay: time.Second,
+		MaxDelay:  30 * time.Second,
+	}
+}
+
+// LoginAttemptKey keys attempts by identity, case insensitively, and the client IP of r.
+func LoginAttemptKey(identity string, r *http.Request) string {
+	return strings.ToLower(strings.TrimSpace(identity)) + "|" + ClientIP(r)
+}
+
+// until reads the time stored under key, zero when missing or past.
+func (self *LoginAttemptTracker) until(ctx context.Context, key string) (time.Duration, error) {
+	data, err := self.Cache.Get(ctx, key)
+	if err == ErrCacheMiss {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	at, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	return time.Until(time.Unix(0, at)), nil
+}
+
+func (self *LoginAttemptTracker) setUntil(ctx context.Context, key string, wait time.Duration) error {
+	return self.Cache.Set(ctx, key, []byte(strconv.FormatInt(time.Now().Add(wait).UnixNano(), 10)), wait)
+}
+
+// Check fails with a 423 when key is locked out and with a 429 when it must still wait after
+// its last failure. Cache failures are logged and let the attempt through.
+func (self *LoginAttemptTracker) Check(ctx context.Context, key string) error {
+	locked, err := self.until(ctx, "login_lock:"+key)
+	if err == nil && locked > 0 {
+		return HTTP423(locked)
+	}
+	delayed, err2 := self.until(ctx, "login_delay:"+key)
+	if err2 == nil && delayed > 0 {
+		serverError := HTTP429()
+		serverError.Errors.Errors[0] = serverError.Errors.Errors[0].WithMeta("retry_after", int(math.Ceil(delayed.Seconds())))
+		return serverError
+	}
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		LoggerFromContext(ctx).Log(ErrorLevel, "login attempt check failed", Fields{"error": err.Error()})
+	}
+	return nil
+}
+
+// Failed records a failed login of key and returns the 423 of the lockout it triggered, if any.
+func (self *LoginAttemptTracker) Failed(ctx context.Context, key string) error {
+	result, err := self.Failures.Allow(key)
+	if err != nil {
+		LoggerFromContext(ctx).Log(ErrorLevel, "login attempt tracking failed", Fields{"error": err.Error()})
+		return nil
+	}
+	return self.penalize(ctx, key, result)
+}
+
+// penalize locks key out when result used up the failures allowed, or delays its next attempt.
+func (self *LoginAttemptTracker) penalize(ctx context.Context, key string, result RateLimitResult) error {
+	if !result.Allowed || result.Remaining == 0 {
+		LoggerFromContext(ctx).Log(WarnLevel, "login locked out", Fields{"key": key, "lockout": self.Lockout.String()})
+		if err := self.setUntil(ctx, "login_lock:"+key, self.Lockout); err != nil {
+			LoggerFromContext(ctx).Log(ErrorLevel, "login lockout failed", Fields{"error": err.Error()})
+		}
+		return HTTP423(self.Lockout)
+	}
+	failures := result.Limit - result.Remaining
+	delay := time.Duration(float64(self.BaseDelay) * math.Pow(2, float64(failures-1)))
+	if self.MaxDelay > 0 && delay > self.MaxDelay {
+		delay = self.MaxDelay
+	}
+	if delay > 0 {
+		if err := self.setUntil(ctx, "login_delay:"+key, delay); err != nil {
+			LoggerFromContext(ctx).Log(ErrorLevel, "login attempt delay failed", Fields{"error": err.Error()})
+		}
+	}
+	return nil
+}
+
+// Succeeded clears the failures of key.
+func (self *LoginAttemptTracker) Succeeded(ctx context.Context, key string) error {
+	if resetter, ok := self.Failures.(RateLimitResetter); ok {
+		if err := resetter.Reset(key); err != nil {
+			return err
+		}
+	}
+	return self.Cache.Delete(ctx, "login_delay:"+key)
+}
+
+// Guard runs login, which checks the credentials, unless key must wait or is locked out, and
+// records its outcome. The attempt counts as a failure before login runs and is cleared when it
+// succeeds, so concurrent attempts cannot get past the limit before their failures are recorded.
+// Login failures are returned as they are unless they trigger a lockout.
+func (self *LoginAttemptTracker) Guard(ctx context.Context, key string, login func() error) error {
+	if err := self.Check(ctx, key); err != nil {
+		return err
+	}
+	result, err := self.Failures.Allow(key)
+	reserved := err == nil
+	if !reserved {
+		LoggerFromContext(ctx).Log(ErrorLevel, "login attempt tracking failed", Fields{"error": err.Error()})
+	} else if !result.Allowed {
+		return self.penalize(ctx, key, result)
+	}
+	if err := login(); err != nil {
+		if reserved {
+			if lockout := self.penalize(ctx, key, result); lockout != nil {
+				return lockout
+			}
+		}
+		return err
+	}
+	if err := self.Succeeded(ctx, key); err != nil {
+		LoggerFromContext(ctx).Log(ErrorLevel, "login attempt reset failed", Fields{"error": err.Error()})
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (self Level) String() string {
+	if self < DebugLevel || self > ErrorLevel {
+		return fmt.Sprintf("level(%d)", int(self))
+	}
+	return levelNames[self]
+}
+
+func ParseLevel(value string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(name, value) {
+			return Level(i), nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q", value)
+}
+
+type Fields map[string]interface{}
+
+type Logger interface {
+	Log(level Level, message string, fields Fields)
+}
+
+var DefaultLogger Logger = &StdLogger{Level: InfoLevel}
+
+// StdLogger writes "level message key=value ..." lines through a standard library logger,
+// falling back to the package-level log functions when Logger is nil.
+type StdLogger struct {
+	Logger *log.Logger
+	Level  Level
+}
+
+func NewStdLogger(logger *log.Logger, level Level) *StdLogger {
+	return &StdLogger{logger, level}
+}
+
+func (self *StdLogger) Log(level Level, message string, fields Fields) {
+	if level < self.Level {
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var builder strings.Builder
+	builder.WriteString(strings.ToUpper(level.String()))
+	builder.WriteString(" ")
+	builder.WriteString(message)
+	for _, key := range keys {
+		fmt.Fprintf(&builder, " %s=%v", key, fields[key])
+	}
+	if self.Logger != nil {
+		self.Logger.Println(builder.String())
+	} else {
+		log.Println(builder.String())
+	}
+}
+
+type JSONLogger struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	Level  Level
+}
+
+func NewJSONLogger(writer io.Writer, level Level) *JSONLogger {
+	return &JSONLogger{writer: writer, Level: level}
+}
+
+func (self *JSONLogger) Log(level Level, message string, fields Fields) {
+	if level < self.Level {
+		return
+	}
+	entry := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["message"] = message
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"level": ErrorLevel.String(), "message": err.Error()})
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.writer.Write(append(data, '\n'))
+}
+
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger}
+}
+
+var slogLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+func (self *SlogLogger) Log(level Level, message string, fields Fields) {
+	slogLevel := slog.LevelInfo
+	if level >= DebugLevel && level <= ErrorLevel {
+		slogLevel = slogLevels[level]
+	}
+	attrs := make([]slog.Attr, 0, len(fields))
+	for key, value := range fields {
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	self.Logger.LogAttrs(context.Background(), slogLevel, message, attrs...)
+}
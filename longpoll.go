@@ -0,0 +1,64 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// LongPoll runs wait with a context that ends after maxWait or when the client disconnects and
+// answers with the value it returns. wait must return once ctx is done. An expired maxWait is
+// answered with 204 No Content and a disconnected client gets no response at all.
+func LongPoll(w http.ResponseWriter, r *http.Request, maxWait time.Duration, wait func(ctx context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(r.Context(), maxWait)
+	defer cancel()
+	value, err := wait(ctx)
+	if r.Context().Err() != nil {
+		return
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		WriteError(w, err)
+		return
+	}
+	JSON(w, value, http.StatusOK)
+}
+
+// LongPollChannel answers with the first value received from ch within maxWait. A closed ch is
+// answered like an expired wait.
+func LongPollChannel(w http.ResponseWriter, r *http.Request, maxWait time.Duration, ch <-chan interface{}) {
+	LongPoll(w, r, maxWait, func(ctx context.Context) (interface{}, error) {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return nil, context.DeadlineExceeded
+			}
+			return value, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// LongPollCondition checks ready every interval and answers with its value once it reports true.
+func LongPollCondition(w http.ResponseWriter, r *http.Request, maxWait time.Duration, interval time.Duration, ready func(ctx context.Context) (interface{}, bool, error)) {
+	LongPoll(w, r, maxWait, func(ctx context.Context) (interface{}, error) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			value, ok, err := ready(ctx)
+			if err != nil || ok {
+				return value, err
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	})
+}
@@ -0,0 +1,503 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Email is a message to send. Addresses may carry a name, as in "Ann <ann@example.com>".
+type Email struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     string
+	Subject     string
+	Text        string
+	HTML        string
+	Headers     map[string]string
+	Attachments []EmailAttachment
+}
+
+// Mailer delivers emails. Failures that sending again cannot fix, such as a rejected
+// recipient, are marked Permanent so SendEmail does not retry them.
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// Recipients returns the addresses of To, Cc and Bcc.
+func (self Email) Recipients() []string {
+	var recipients []string
+	for _, list := range [][]string{self.To, self.Cc, self.Bcc} {
+		for _, value := range list {
+			if address, err := mail.ParseAddress(value); err == nil {
+				recipients = append(recipients, address.Address)
+			}
+		}
+	}
+	return recipients
+}
+
+// Validate checks the addresses of the email and that it has a sender, a recipient and a body.
+func (self Email) Validate() error {
+	collector := NewErrorCollector().Status(400)
+	if self.From == "" {
+		collector.Add("from", CodeRequiredFieldError, "Field is required")
+	}
+	if len(self.To)+len(self.Cc)+len(self.Bcc) == 0 {
+		collector.Add("to", CodeRequiredFieldError, "Field is required")
+	}
+	if self.Text == "" && self.HTML == "" {
+		collector.Add("text", CodeRequiredFieldError, "Field is required")
+	}
+	for key, list := range map[string][]string{"from": {self.From}, "to": self.To, "cc": self.Cc, "bcc": self.Bcc, "reply_to": {self.ReplyTo}} {
+		for _, value := range list {
+			if _, err := mail.ParseAddress(value); value != "" && err != nil {
+				collector.Add(key, CodeTypeError, "Invalid email address", value)
+			}
+		}
+	}
+	return collector.Err()
+}
+
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+func quotedPrintablePart(contentType string, text string) mimePart {
+	var buffer bytes.Buffer
+	encoder := quotedprintable.NewWriter(&buffer)
+	io.WriteString(encoder, text)
+	encoder.Close()
+	return mimePart{textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}, buffer.Bytes()}
+}
+
+// base64Part wraps the encoding at 76 characters as MIME requires.
+func base64Part(header textproto.MIMEHeader, data []byte) mimePart {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var buffer bytes.Buffer
+	for len(encoded) > 76 {
+		buffer.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buffer.WriteString(encoded)
+	header.Set("Content-Transfer-Encoding", "base64")
+	return mimePart{header, buffer.Bytes()}
+}
+
+func multipartPart(subtype string, parts []mimePart) (mimePart, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	for _, part := range parts {
+		w, err := writer.CreatePart(part.header)
+		if err != nil {
+			return mimePart{}, err
+		}
+		if _, err := w.Write(part.body); err != nil {
+			return mimePart{}, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return mimePart{}, err
+	}
+	contentType := mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": writer.Boundary()})
+	return mimePart{textproto.MIMEHeader{"Content-Type": {contentType}}, buffer.Bytes()}, nil
+}
+
+func (self Email) mimeBody() (mimePart, error) {
+	var body mimePart
+	var err error
+	switch {
+	case self.Text != "" && self.HTML != "":
+		body, err = multipartPart("alternative", []mimePart{
+			quotedPrintablePart("text/plain", self.Text), quotedPrintablePart("text/html", self.HTML)})
+		if err != nil {
+			return body, err
+		}
+	case self.HTML != "":
+		body = quotedPrintablePart("text/html", self.HTML)
+	default:
+		body = quotedPrintablePart("text/plain", self.Text)
+	}
+	if len(self.Attachments) == 0 {
+		return body, nil
+	}
+	parts := []mimePart{body}
+	for _, attachment := range self.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = http.DetectContentType(attachment.Data)
+		}
+		parts = append(parts, base64Part(textproto.MIMEHeader{
+			"Content-Type":        {contentType},
+			"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		}, attachment.Data))
+	}
+	return multipartPart("mixed", parts)
+}
+
+// Message encodes the email as a MIME message. Bcc recipients are left out of the headers.
+func (self Email) Message() ([]byte, error) {
+	body, err := self.mimeBody()
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	header := func(name string, value string) {
+		if value != "" {
+			fmt.Fprintf(&buffer, "%s: %s\r\n", name, value)
+		}
+	}
+	domain := "localhost"
+	if address, err := mail.ParseAddress(self.From); err == nil {
+		if _, host, ok := strings.Cut(address.Address, "@"); ok {
+			domain = host
+		}
+	}
+	header("From", self.From)
+	header("To", strings.Join(self.To, ", "))
+	header("Cc", strings.Join(self.Cc, ", "))
+	header("Reply-To", self.ReplyTo)
+	header("Subject", mime.QEncoding.Encode("utf-8", self.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+SecureHex(16)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	for name, value := range self.Headers {
+		header(textproto.CanonicalMIMEHeaderKey(name), mime.QEncoding.Encode("utf-8", value))
+	}
+	for name, values := range body.header {
+		header(name, values[0])
+	}
+	buffer.WriteString("\r\n")
+	buffer.Write(body.body)
+	return buffer.Bytes(), nil
+}
+
+// SMTPMailer sends through an SMTP server, upgrading the connection with STARTTLS when the
+// server offers it. Rejections with a 5xx reply are permanent.
+type SMTPMailer struct {
+	// Addr is the host and port of the server.
+	Addr string
+	Auth smtp.Auth
+	// From is the sender of emails that have none.
+	From    string
+	Timeout time.Duration
+	// ImplicitTLS connects with TLS from the start, as servers on port 465 expect.
+	ImplicitTLS bool
+	TLSConfig   *tls.Config
+}
+
+func NewSMTPMailer(addr string, username string, password string, from string) *SMTPMailer {
+	host, _, _ := net.SplitHostPort(addr)
+	return &SMTPMailer{Addr: addr, Auth: smtp.PlainAuth("", username, password, host), From: from, Timeout: 30 * time.Second}
+}
+
+func smtpError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
+
+func (self *SMTPMailer) Send(ctx context.Context, email Email) error {
+	if email.From == "" {
+		email.From = self.From
+	}
+	message, err := email.Message()
+	if err != nil {
+		return Permanent(err)
+	}
+	host, _, err := net.SplitHostPort(self.Addr)
+	if err != nil {
+		return Permanent(err)
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+	if self.TLSConfig != nil {
+		tlsConfig = self.TLSConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+	}
+	dialer := net.Dialer{Timeout: self.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", self.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if self.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(self.Timeout))
+	}
+	if self.ImplicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && !self.ImplicitTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if ok, _ := client.Extension("AUTH"); ok && self.Auth != nil {
+		if err := client.Auth(self.Auth); err != nil {
+			return smtpError(err)
+		}
+	}
+	sender, err := mail.ParseAddress(email.From)
+	if err != nil {
+		return Permanent(err)
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return smtpError(err)
+	}
+	for _, recipient := range email.Recipients() {
+		if err := client.Rcpt(recipient); err != nil {
+			return smtpError(err)
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := data.Write(message); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return smtpError(err)
+	}
+	return client.Quit()
+}
+
+// SendGridMailer sends through the SendGrid v3 API. Rejections with a 4xx status other than
+// 429 are permanent.
+type SendGridMailer struct {
+	APIKey string
+	From   string
+	// Endpoint is the mail send URL, the public API when empty.
+	Endpoint string
+	Client   *http.Client
+}
+
+func NewSendGridMailer(apiKey string, from string) *SendGridMailer {
+	return &SendGridMailer{APIKey: apiKey, From: from, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+func sendGridAddresses(values []string) []sendGridAddress {
+	var addresses []sendGridAddress
+	for _, value := range values {
+		if address, err := mail.ParseAddress(value); err == nil {
+			addresses = append(addresses, sendGridAddress{address.Address, address.Name})
+		}
+	}
+	return addresses
+}
+
+func (self *SendGridMailer) Send(ctx context.Context, email Email) error {
+	if email.From == "" {
+		email.From = self.From
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	type attachment struct {
+		Content  string `json:"content"`
+		Filename string `json:"filename"`
+		Type     string `json:"type,omitempty"`
+	}
+	payload := struct {
+		Personalizations []map[string][]sendGridAddress `json:"personalizations"`
+		From             sendGridAddress                `json:"from"`
+		ReplyTo          *sendGridAddress               `json:"reply_to,omitempty"`
+		Subject          string                         `json:"subject"`
+		Content          []content                      `json:"content"`
+		Attachments      []attachment                   `json:"attachments,omitempty"`
+		Headers          map[string]string              `json:"headers,omitempty"`
+	}{Subject: email.Subject, Headers: email.Headers}
+	personalization := map[string][]sendGridAddress{}
+	for key, values := range map[string][]string{"to": email.To, "cc": email.Cc, "bcc": email.Bcc} {
+		if addresses := sendGridAddresses(values); len(addresses) > 0 {
+			personalization[key] = addresses
+		}
+	}
+	payload.Personalizations = []map[string][]sendGridAddress{personalization}
+	if from := sendGridAddresses([]string{email.From}); len(from) > 0 {
+		payload.From = from[0]
+	}
+	if replyTo := sendGridAddresses([]string{email.ReplyTo}); len(replyTo) > 0 {
+		payload.ReplyTo = &replyTo[0]
+	}
+	if email.Text != "" {
+		payload.Content = append(payload.Content, content{"text/plain", email.Text})
+	}
+	if email.HTML != "" {
+		payload.Content = append(payload.Content, content{"text/html", email.HTML})
+	}
+	for _, item := range email.Attachments {
+		payload.Attachments = append(payload.Attachments, attachment{base64.StdEncoding.EncodeToString(item.Data), item.Filename, item.ContentType})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Permanent(err)
+	}
+	endpoint := self.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.sendgrid.com/v3/mail/send"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+self.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	client := self.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	err = fmt.Errorf("sendgrid answered %d: %s", response.StatusCode, strings.TrimSpace(string(detail)))
+	if response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// EmailTemplates renders emails from templates named after the email: the HTML body is page
+// "<name>.html" of HTML and the text body "<name>.txt" of Text, a text/template file whose
+// "subject" template, when defined, is the subject. Either may be missing.
+type EmailTemplates struct {
+	HTML  *Templates
+	Text  fs.FS
+	Funcs template.FuncMap
+}
+
+func (self *EmailTemplates) Render(name string, data interface{}) (Email, error) {
+	var email Email
+	if self.Text != nil {
+		if _, err := fs.Stat(self.Text, name+".txt"); err == nil {
+			t, err := template.New(name+".txt").Funcs(self.Funcs).ParseFS(self.Text, name+".txt")
+			if err != nil {
+				return email, err
+			}
+			var buffer bytes.Buffer
+			if err := t.Execute(&buffer, data); err != nil {
+				return email, err
+			}
+			email.Text = strings.TrimSpace(buffer.String())
+			if subject := t.Lookup("subject"); subject != nil {
+				buffer.Reset()
+				if err := subject.Execute(&buffer, data); err != nil {
+					return email, err
+				}
+				email.Subject = strings.TrimSpace(buffer.String())
+			}
+		}
+	}
+	if self.HTML != nil {
+		if _, err := fs.Stat(self.HTML.FS, name+".html"); err == nil {
+			body, err := self.HTML.Render(name+".html", data)
+			if err != nil {
+				return email, err
+			}
+			email.HTML = string(body)
+		}
+	}
+	if email.Text == "" && email.HTML == "" {
+		return email, fmt.Errorf("no template for email %s", name)
+	}
+	return email, nil
+}
+
+// withSender fills the sender of email from the mailers that have one.
+func withSender(mailer Mailer, email Email) Email {
+	if email.From == "" {
+		switch typed := mailer.(type) {
+		case *SMTPMailer:
+			email.From = typed.From
+		case *SendGridMailer:
+			email.From = typed.From
+		}
+	}
+	return email
+}
+
+// SendEmail validates and sends email with mailer, retrying transient failures with
+// DefaultRetryPolicy. Invalid emails are answered with a 400 and failed deliveries with a 502
+// wrapping the cause, which is logged with the request logger of ctx.
+func SendEmail(ctx context.Context, mailer Mailer, email Email) error {
+	email = withSender(mailer, email)
+	if err := email.Validate(); err != nil {
+		return err
+	}
+	t1 := time.Now()
+	err := Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+		return mailer.Send(ctx, email)
+	})
+	if err != nil {
+		LoggerFromContext(ctx).Log(ErrorLevel, "email delivery failed", Fields{"error": err.Error(),
+			"recipients": len(email.Recipients()), "duration": time.Since(t1).String()})
+		return HTTP502().Wrap(err)
+	}
+	LoggerFromContext(ctx).Log(DebugLevel, "email sent", Fields{"recipients": len(email.Recipients()),
+		"duration": time.Since(t1).String()})
+	return nil
+}
+
+// EnqueueEmail validates email and sends it with SendEmail on runner, whose logs report
+// failed deliveries. It fails only when the email is invalid or the runner does not take it.
+func EnqueueEmail(runner *JobRunner, mailer Mailer, email Email) error {
+	email = withSender(mailer, email)
+	if err := email.Validate(); err != nil {
+		return err
+	}
+	return runner.Enqueue("email", func(ctx context.Context) error {
+		return SendEmail(ctx, mailer, email)
+	})
+}
@@ -0,0 +1,225 @@
+package httputils
+
+import (
+	"context"
+	"encoding/hex"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+)
+
+// ModelHook runs with the document a Model writes. Before-save hooks may change it and abort
+// the write by returning an error.
+type ModelHook func(ctx context.Context, doc map[string]interface{}) error
+
+// Model ties a collection to its validation, hooks and the fields clients see, and implements
+// the Resource* interfaces so Router.Resource serves it. Updates record the previous document
+// for AuditMiddlewareFactory.
+type Model struct {
+	Name         string
+	Store        Store
+	CreateFields VMap
+	UpdateFields VMap
+	CreateChecks CVMap
+	UpdateChecks CVMap
+	// Fields lists the dotted fields written to clients, all when empty. Hidden fields, such as
+	// password hashes, are never written.
+	Fields     []string
+	Hidden     []string
+	Pagination PaginationConfig
+	// NewID returns the _id of created documents, generated for DefaultIDType when nil.
+	NewID      func() interface{}
+	beforeSave []ModelHook
+	afterSave  []ModelHook
+}
+
+// NewModel registers store under name for UniqueValidator and ExistsValidator.
+func NewModel(name string, store Store) *Model {
+	RegisterCollection(name, store)
+	return &Model{Name: name, Store: store, Pagination: DefaultPaginationConfig}
+}
+
+// BeforeSave adds a hook run before inserts, with the whole document, and updates, with the
+// changed fields.
+func (self *Model) BeforeSave(hook ModelHook) *Model {
+	self.beforeSave = append(self.beforeSave, hook)
+	return self
+}
+
+// AfterSave adds a hook run with the saved document.
+func (self *Model) AfterSave(hook ModelHook) *Model {
+	self.afterSave = append(self.afterSave, hook)
+	return self
+}
+
+func runModelHooks(ctx context.Context, hooks []ModelHook, doc map[string]interface{}) error {
+	for _, hook := range hooks {
+		if err := hook(ctx, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newID() interface{} {
+	switch DefaultIDType.(type) {
+	case ObjectIDType:
+		return bson.NewObjectId()
+	case UUIDType:
+		b := SecureBytes(16)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		s := hex.EncodeToString(b)
+		return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+	}
+	return SecureHex(12)
+}
+
+// Project returns doc with only the fields clients may see.
+func (self *Model) Project(doc map[string]interface{}) map[string]interface{} {
+	projected := deepCopy(doc).(map[string]interface{})
+	if len(self.Fields) > 0 {
+		projected = parseFields(strings.Join(self.Fields, ",")).prune(projected).(map[string]interface{})
+	}
+	for _, field := range self.Hidden {
+		parts := strings.Split(field, ".")
+		node := projected
+		for _, part := range parts[:len(parts)-1] {
+			if node, _ = asDocument(node[part]); node == nil {
+				break
+			}
+		}
+		if node != nil {
+			delete(node, parts[len(parts)-1])
+		}
+	}
+	return projected
+}
+
+func (self *Model) CreateVMap() VMap {
+	return self.CreateFields
+}
+
+func (self *Model) UpdateVMap() VMap {
+	return self.UpdateFields
+}
+
+func (self *Model) CreateCVMap() CVMap {
+	return self.CreateChecks
+}
+
+func (self *Model) UpdateCVMap() CVMap {
+	return self.UpdateChecks
+}
+
+func (self *Model) PaginationConfig() PaginationConfig {
+	return self.Pagination
+}
+
+func (self *Model) find(ctx context.Context, id interface{}) (map[string]interface{}, error) {
+	var doc bson.M
+	err := self.Store.Find(ctx, bson.M{"_id": id}).One(&doc)
+	if err == ErrNotFound {
+		return nil, HTTP404(DefaultIDType.Format(id))
+	}
+	if err != nil {
+		return nil, Internal(err)
+	}
+	return doc, nil
+}
+
+func (self *Model) List(r *http.Request, pagination Pagination) (Page, error) {
+	page, err := Paginate(r.Context(), self.Store, bson.M{}, pagination)
+	if err != nil {
+		return page, err
+	}
+	docs := page.Data.([]bson.M)
+	projected := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		projected[i] = self.Project(doc)
+	}
+	page.Data = projected
+	return page, nil
+}
+
+func (self *Model) Get(r *http.Request, id interface{}) (interface{}, error) {
+	doc, err := self.find(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	return self.Project(doc), nil
+}
+
+// validatedFields returns the keys of body that validatorMap checks, leaving out those clients
+// must not write, such as roles, owners or password hashes.
+func validatedFields(body map[string]interface{}, validatorMap VMap) map[string]interface{} {
+	fields := make(map[string]interface{}, len(validatorMap))
+	for key := range validatorMap {
+		if value, ok := body[key]; ok {
+			fields[key] = deepCopy(value)
+		}
+	}
+	return fields
+}
+
+// Create inserts the fields of body that CreateFields validates.
+func (self *Model) Create(r *http.Request, body map[string]interface{}) (interface{}, error) {
+	ctx := r.Context()
+	doc := validatedFields(body, self.CreateFields)
+	if self.NewID != nil {
+		doc["_id"] = self.NewID()
+	} else {
+		doc["_id"] = newID()
+	}
+	if err := runModelHooks(ctx, self.beforeSave, doc); err != nil {
+		return nil, err
+	}
+	if err := self.Store.Insert(ctx, doc); err != nil {
+		return nil, MongoError(err, nil)
+	}
+	if entry := AuditFromContext(ctx); entry != nil {
+		entry.ResourceID = DefaultIDType.Format(doc["_id"])
+	}
+	if err := runModelHooks(ctx, self.afterSave, doc); err != nil {
+		return nil, err
+	}
+	return self.Project(doc), nil
+}
+
+// Update sets only the fields of body that UpdateFields validates and that differ from the stored
+// document.
+func (self *Model) Update(r *http.Request, id interface{}, body map[string]interface{}) (interface{}, error) {
+	ctx := r.Context()
+	current, err := self.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	SetAuditBefore(r, current)
+	changes := map[string]interface{}(Diff(current, validatedFields(body, self.UpdateFields)).Set())
+	delete(changes, "_id")
+	if err := runModelHooks(ctx, self.beforeSave, changes); err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		if err := self.Store.Update(ctx, bson.M{"_id": id}, bson.M{"$set": changes}); err != nil {
+			return nil, MongoError(err, DefaultIDType.Format(id))
+		}
+	}
+	doc, err := self.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := runModelHooks(ctx, self.afterSave, doc); err != nil {
+		return nil, err
+	}
+	return self.Project(doc), nil
+}
+
+func (self *Model) Delete(r *http.Request, id interface{}) error {
+	return MongoError(self.Store.Remove(r.Context(), bson.M{"_id": id}), DefaultIDType.Format(id))
+}
+
+// Resource serves the model under path with Router.Resource.
+func (self *Model) Resource(router *Router, path string, mws ...func(http.Handler) http.Handler) {
+	router.Resource(path, self, mws...)
+}
@@ -0,0 +1,92 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func HTTP409(key string) ServerError {
+	return ServerError{409, Errors{[]Error{Error{Key: key, Description: "Value already exists", Code: CodeDuplicateValueError}}}}
+}
+
+// MongoError translates mongo-driver errors into ServerErrors: missing documents into a 404,
+// duplicate keys into a 409 and expired contexts into a 504. Anything else becomes a 500 with
+// err kept as its cause.
+func MongoError(err error, id interface{}) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments), errors.Is(err, ErrNotFound):
+		return HTTP404(fmt.Sprintf("%v", id)).Wrap(err)
+	case mongo.IsDuplicateKeyError(err):
+		return HTTP409("undefined").Wrap(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return HTTP504().Wrap(err)
+	}
+	var serverError ServerError
+	if errors.As(err, &serverError) {
+		return err
+	}
+	return Internal(err)
+}
+
+// MongoFind decodes the matching documents into results and returns the total number of
+// documents matching filter, ignoring skip and limit.
+func MongoFind(ctx context.Context, collection *mongo.Collection, filter interface{}, results interface{}, opts FindOptions) (int, error) {
+	count, err := FindInto(ctx, NewMongoStore(collection), filter, results, opts)
+	return count, MongoError(err, nil)
+}
+
+func MongoFindOne(ctx context.Context, collection *mongo.Collection, filter interface{}, result interface{}) error {
+	err := collection.FindOne(ctx, driverFilter(filter)).Decode(result)
+	return MongoError(err, filterID(filter))
+}
+
+func MongoInsert(ctx context.Context, collection *mongo.Collection, doc interface{}) (interface{}, error) {
+	result, err := collection.InsertOne(ctx, toDriver(doc))
+	if err != nil {
+		return nil, MongoError(err, nil)
+	}
+	return result.InsertedID, nil
+}
+
+func MongoUpdate(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}) error {
+	result, err := collection.UpdateOne(ctx, driverFilter(filter), toDriver(update))
+	if err == nil && result.MatchedCount == 0 {
+		err = mongo.ErrNoDocuments
+	}
+	return MongoError(err, filterID(filter))
+}
+
+func MongoDelete(ctx context.Context, collection *mongo.Collection, filter interface{}) error {
+	result, err := collection.DeleteOne(ctx, driverFilter(filter), options.Delete())
+	if err == nil && result.DeletedCount == 0 {
+		err = mongo.ErrNoDocuments
+	}
+	return MongoError(err, filterID(filter))
+}
+
+func MongoPaginate(ctx context.Context, collection *mongo.Collection, filter map[string]interface{}, pagination Pagination) (Page, error) {
+	page, err := Paginate(ctx, NewMongoStore(collection), filter, pagination)
+	return page, MongoError(err, nil)
+}
+
+func MongoChecker(client *mongo.Client) Checker {
+	return NewChecker("mongo", func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	})
+}
+
+// filterID returns the _id a filter selects, for 404 error arguments.
+func filterID(filter interface{}) interface{} {
+	if m, ok := filter.(map[string]interface{}); ok {
+		return m["_id"]
+	}
+	if m, ok := driverFilter(filter).(map[string]interface{}); ok {
+		return m["_id"]
+	}
+	return nil
+}
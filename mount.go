@@ -0,0 +1,34 @@
+package httputils
+
+import (
+	"net/http"
+	"strings"
+)
+
+var mountMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// Mount dispatches every request under prefix to handler with the prefix stripped from the
+// path, so /admin/users reaches handler as /users. No other routes may be registered below prefix.
+func (self *Router) Mount(prefix string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	full := joinPath(self.prefix, prefix)
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, full)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		u := *r.URL
+		u.Path = path
+		u.RawPath = ""
+		req := r.Clone(r.Context())
+		req.URL = &u
+		handler.ServeHTTP(w, req)
+	}
+	for _, method := range mountMethods {
+		if prefix != "" {
+			self.handle(method, prefix, http.HandlerFunc(fn), mws)
+		}
+		self.handle(method, prefix+"/*mountpath", http.HandlerFunc(fn), mws)
+	}
+}
@@ -0,0 +1,68 @@
+package httputils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func (self *Router) HandleNamed(name string, method string, path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	root := self.rootRouter()
+	if _, ok := root.names[name]; ok {
+		panic(fmt.Sprintf("httputils: route name %q is already registered", name))
+	}
+	self.handle(method, path, handler, mws)
+	if root.names == nil {
+		root.names = make(map[string]string)
+	}
+	root.names[name] = joinPath(self.prefix, path)
+	root.routes[len(root.routes)-1].Name = name
+}
+
+func (self *Router) GetNamed(name string, path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.HandleNamed(name, http.MethodGet, path, handler, mws...)
+}
+
+func (self *Router) PostNamed(name string, path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.HandleNamed(name, http.MethodPost, path, handler, mws...)
+}
+
+// URLFor builds the path of the named route, substituting :name and *name segments from
+// params. Params that are not part of the pattern are appended as the query string.
+func (self *Router) URLFor(name string, params map[string]string) (string, error) {
+	pattern, ok := self.rootRouter().names[name]
+	if !ok {
+		return "", fmt.Errorf("httputils: unknown route %q", name)
+	}
+	used := make(map[string]bool)
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if len(segment) == 0 || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		key := segment[1:]
+		value, ok := params[key]
+		if !ok {
+			return "", fmt.Errorf("httputils: missing parameter %q for route %q", key, name)
+		}
+		used[key] = true
+		if segment[0] == '*' {
+			segments[i] = strings.TrimPrefix(value, "/")
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	path := strings.Join(segments, "/")
+
+	query := url.Values{}
+	for key, value := range params {
+		if !used[key] {
+			query.Set(key, value)
+		}
+	}
+	if len(query) == 0 {
+		return path, nil
+	}
+	return path + "?" + query.Encode(), nil
+}
@@ -0,0 +1,565 @@
+package httputils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// OIDCProvider is an OpenID Connect issuer read from its discovery document. Its signing keys
+// are cached for KeysTTL and fetched again early when a token names an unknown key, so key
+// rotation needs no restart.
+type OIDCProvider struct {
+	Issuer                string        `json:"issuer"`
+	AuthorizationEndpoint string        `json:"authorization_endpoint"`
+	TokenEndpoint         string        `json:"token_endpoint"`
+	UserinfoEndpoint      string        `json:"userinfo_endpoint"`
+	JWKSURI               string        `json:"jwks_uri"`
+	EndSessionEndpoint    string        `json:"end_session_endpoint"`
+	Client                *http.Client  `json:"-"`
+	KeysTTL               time.Duration `json:"-"`
+	// Leeway tolerates clock skew when checking token times.
+	Leeway  time.Duration `json:"-"`
+	mutex   sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// DiscoverOIDC reads the discovery document of issuer.
+func DiscoverOIDC(ctx context.Context, issuer string) (*OIDCProvider, error) {
+	provider := &OIDCProvider{Client: &http.Client{Timeout: 10 * time.Second}, KeysTTL: time.Hour, Leeway: time.Minute}
+	if err := provider.getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("discovery document is for issuer %q", provider.Issuer)
+	}
+	return provider, nil
+}
+
+func (self *OIDCProvider) client() *http.Client {
+	if self.Client == nil {
+		return http.DefaultClient
+	}
+	return self.Client
+}
+
+func (self *OIDCProvider) getJSON(ctx context.Context, url string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := self.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", url, response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(dest)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (self jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(value string) *big.Int {
+		data, _ := base64.RawURLEncoding.DecodeString(value)
+		return new(big.Int).SetBytes(data)
+	}
+	switch self.Kty {
+	case "RSA":
+		if self.N == "" || self.E == "" {
+			return nil, errors.New("rsa key without modulus or exponent")
+		}
+		return &rsa.PublicKey{N: decode(self.N), E: int(decode(self.E).Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[self.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", self.Crv)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: decode(self.X), Y: decode(self.Y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("ec key is not on its curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", self.Kty)
+}
+
+func (self *OIDCProvider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := self.getJSON(ctx, self.JWKSURI, &document); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(document.Keys))
+	for _, item := range document.Keys {
+		if item.Use == "enc" {
+			continue
+		}
+		if key, err := item.publicKey(); err == nil {
+			keys[item.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// key returns the signing key named kid. Unknown ids fetch the keys again at most once a
+// minute, so tokens naming made-up keys cannot flood the provider.
+func (self *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	key, ok := self.keys[kid]
+	ttl := self.KeysTTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	age := time.Since(self.fetched)
+	if age > ttl || (!ok && age > time.Minute) {
+		keys, err := self.fetchKeys(ctx)
+		if err != nil {
+			if ok {
+				DefaultLogger.Log(WarnLevel, "oidc keys refresh failed", Fields{"error": err.Error()})
+				return key, nil
+			}
+			return nil, err
+		}
+		self.keys, self.fetched = keys, time.Now()
+		key, ok = keys[kid]
+	}
+	if !ok && kid == "" && len(self.keys) == 1 {
+		for _, only := range self.keys {
+			return only, nil
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+var jwtHashes = map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	hash, ok := jwtHashes[strings.TrimLeft(alg, "RSEP")]
+	if !ok || len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	digest := hash.New()
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+	switch typed := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			return rsa.VerifyPKCS1v15(typed, hash, sum, signature)
+		}
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(typed, hash, sum, signature, nil)
+		}
+	case *ecdsa.PublicKey:
+		size := (typed.Curve.Params().BitSize + 7) / 8
+		if strings.HasPrefix(alg, "ES") && len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if ecdsa.Verify(typed, sum, r, s) {
+				return nil
+			}
+			return errors.New("invalid signature")
+		}
+	}
+	return fmt.Errorf("algorithm %q does not match the key", alg)
+}
+
+// claimTime reads a NumericDate claim.
+func claimTime(claims map[string]interface{}, name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// VerifyToken checks the signature, issuer and times of a JWT issued by the provider and, when
+// audience is not empty, that it is meant for audience. It returns the token's claims.
+func (self *OIDCProvider) VerifyToken(ctx context.Context, token string, audience string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil {
+		return nil, errors.New("malformed token header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	key, err := self.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	data, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(data, &claims) != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	if issuer, _ := claims["iss"].(string); issuer != self.Issuer {
+		return nil, fmt.Errorf("token issued by %q", issuer)
+	}
+	if audience != "" {
+		found := false
+		switch value := claims["aud"].(type) {
+		case string:
+			found = value == audience
+		case []interface{}:
+			for _, item := range value {
+				found = found || item == audience
+			}
+		}
+		if !found {
+			return nil, errors.New("token is meant for another audience")
+		}
+	}
+	now := time.Now()
+	if expires, ok := claimTime(claims, "exp"); !ok || now.After(expires.Add(self.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if notBefore, ok := claimTime(claims, "nbf"); ok && now.Add(self.Leeway).Before(notBefore) {
+		return nil, errors.New("token is not valid yet")
+	}
+	return claims, nil
+}
+
+func claimStrings(value interface{}) []string {
+	switch typed := value.(type) {
+	case string:
+		return strings.Fields(typed)
+	case []interface{}:
+		values := []string{}
+		for _, item := range typed {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	}
+	return []string{}
+}
+
+// OIDCIdentity maps the subject to the identity id, the "roles" claim to roles and the
+// "permissions" claim, or else the scopes, to permissions.
+func OIDCIdentity(claims map[string]interface{}) *Identity {
+	subject, _ := claims["sub"].(string)
+	permissions := claimStrings(claims["permissions"])
+	if len(permissions) == 0 {
+		permissions = claimStrings(claims["scope"])
+	}
+	return &Identity{ID: subject, Roles: claimStrings(claims["roles"]), Permissions: permissions}
+}
+
+// OIDC signs users in with the authorization code flow and PKCE, keeping the identity in the
+// session, which SessionMiddlewareFactory must provide, and authenticates API calls carrying a
+// bearer token issued by Provider.
+type OIDC struct {
+	Provider     *OIDCProvider
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are requested at login, "openid profile email" when empty.
+	Scopes []string
+	// Audience is required of bearer tokens, ClientID when empty.
+	Audience              string
+	PostLogoutRedirectURL string
+	// Identity maps token claims to the request identity, OIDCIdentity when nil.
+	Identity func(claims map[string]interface{}) *Identity
+}
+
+const (
+	oidcStateKey    = "oidc_state"
+	oidcNonceKey    = "oidc_nonce"
+	oidcVerifierKey = "oidc_verifier"
+	oidcReturnKey   = "oidc_return_to"
+	oidcIdentityKey = "oidc_identity"
+	oidcIDTokenKey  = "oidc_id_token"
+)
+
+func (self *OIDC) identity(claims map[string]interface{}) *Identity {
+	if self.Identity != nil {
+		return self.Identity(claims)
+	}
+	return OIDCIdentity(claims)
+}
+
+// localPath accepts only paths of this site as return targets, against open redirects. Control
+// characters are refused as browsers strip them, turning "/\t/host" into "//host".
+func localPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	if strings.IndexFunc(path, unicode.IsControl) >= 0 {
+		return "/"
+	}
+	if parsed, err := url.Parse(path); err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return "/"
+	}
+	return path
+}
+
+func oidcSession(w http.ResponseWriter, r *http.Request) *Session {
+	session := GetSession(r)
+	if session == nil {
+		WriteError(w, errors.New("oidc handlers need SessionMiddlewareFactory"))
+	}
+	return session
+}
+
+// LoginHandler redirects to the provider, coming back after the callback to the local path of
+// the "return_to" query parameter.
+func (self *OIDC) LoginHandler() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		session := oidcSession(w, r)
+		if session == nil {
+			return
+		}
+		state, nonce, verifier := SecureBase64URL(16), SecureBase64URL(16), SecureBase64URL(32)
+		session.Set(oidcStateKey, state)
+		session.Set(oidcNonceKey, nonce)
+		session.Set(oidcVerifierKey, verifier)
+		session.Set(oidcReturnKey, localPath(r.URL.Query().Get("return_to")))
+		challenge := sha256.Sum256([]byte(verifier))
+		scopes := self.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "profile", "email"}
+		}
+		query := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {self.ClientID},
+			"redirect_uri":          {self.RedirectURL},
+			"scope":                 {strings.Join(scopes, " ")},
+			"state":                 {state},
+			"nonce":                 {nonce},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": {"S256"},
+		}
+		Redirect(w, r, self.Provider.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+type oidcTokens struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (self *OIDC) exchange(ctx context.Context, code string, verifier string) (oidcTokens, error) {
+	var tokens oidcTokens
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {self.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, self.Provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokens, err
+	}
+	req.SetBasicAuth(url.QueryEscape(self.ClientID), url.QueryEscape(self.ClientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := self.Provider.client().Do(req)
+	if err != nil {
+		return tokens, HTTP502().Wrap(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 500 {
+		return tokens, HTTP502().Wrap(fmt.Errorf("token endpoint answered %d", response.StatusCode))
+	}
+	if response.StatusCode != http.StatusOK {
+		var failure struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.NewDecoder(io.LimitReader(response.Body, 64*1024)).Decode(&failure)
+		return tokens, HTTP401().Wrap(fmt.Errorf("code exchange failed: %s %s", failure.Error, failure.Description))
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&tokens); err != nil {
+		return tokens, HTTP502().Wrap(err)
+	}
+	return tokens, nil
+}
+
+// CallbackHandler completes the login: it checks the state, exchanges the code, verifies the
+// ID token and its nonce, then stores the identity in a regenerated session. Failures are
+// answered with a 401, or a 502 when the provider is unavailable.
+func (self *OIDC) CallbackHandler() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		session := oidcSession(w, r)
+		if session == nil {
+			return
+		}
+		state, _ := session.GetString(oidcStateKey)
+		nonce, _ := session.GetString(oidcNonceKey)
+		verifier, _ := session.GetString(oidcVerifierKey)
+		returnTo, _ := session.GetString(oidcReturnKey)
+		for _, key := range []string{oidcStateKey, oidcNonceKey, oidcVerifierKey, oidcReturnKey} {
+			session.Delete(key)
+		}
+		query := r.URL.Query()
+		if failure := query.Get("error"); failure != "" {
+			LoggerFromContext(r.Context()).Log(WarnLevel, "oidc login refused", Fields{"error": failure})
+			HTTP401().Write(w)
+			return
+		}
+		if state == "" || !ConstantTimeEqual(state, query.Get("state")) {
+			HTTP401().Write(w)
+			return
+		}
+		tokens, err := self.exchange(r.Context(), query.Get("code"), verifier)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		claims, err := self.Provider.VerifyToken(r.Context(), tokens.IDToken, self.ClientID)
+		if err == nil && !ConstantTimeEqual(fmt.Sprint(claims["nonce"]), nonce) {
+			err = errors.New("id token nonce does not match")
+		}
+		if err != nil {
+			LoggerFromContext(r.Context()).Log(WarnLevel, "oidc id token rejected", Fields{"error": err.Error()})
+			HTTP401().Write(w)
+			return
+		}
+		session.Regenerate()
+		session.Set(oidcIdentityKey, self.identity(claims))
+		session.Set(oidcIDTokenKey, tokens.IDToken)
+		Redirect(w, r, localPath(returnTo), http.StatusFound)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// LogoutHandler destroys the session and ends the provider session when the provider supports
+// it, coming back to PostLogoutRedirectURL.
+func (self *OIDC) LogoutHandler() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		session := oidcSession(w, r)
+		if session == nil {
+			return
+		}
+		idToken, _ := session.GetString(oidcIDTokenKey)
+		session.Destroy()
+		target := self.PostLogoutRedirectURL
+		if self.Provider.EndSessionEndpoint != "" {
+			query := url.Values{"client_id": {self.ClientID}}
+			if idToken != "" {
+				query.Set("id_token_hint", idToken)
+			}
+			if target != "" {
+				query.Set("post_logout_redirect_uri", target)
+			}
+			target = self.Provider.EndSessionEndpoint + "?" + query.Encode()
+		}
+		if target == "" {
+			target = "/"
+		}
+		Redirect(w, r, target, http.StatusFound)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// sessionIdentity reads the identity stored by the callback, which comes back from session
+// storage as a map.
+func sessionIdentity(session *Session) *Identity {
+	value := session.Get(oidcIdentityKey)
+	if value == nil {
+		return nil
+	}
+	if identity, ok := value.(*Identity); ok {
+		return identity
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var identity Identity
+	if json.Unmarshal(data, &identity) != nil || identity.ID == "" {
+		return nil
+	}
+	return &identity
+}
+
+// MiddlewareFactory sets the request identity from a bearer token, answering 401 when the token
+// is invalid, or else from the session. Requests with neither pass through unauthenticated for
+// RequireRole and RequirePermission to reject.
+func (self *OIDC) MiddlewareFactory() func(http.Handler) http.Handler {
+	audience := self.Audience
+	if audience == "" {
+		audience = self.ClientID
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := BearerToken(r); ok {
+				claims, err := self.Provider.VerifyToken(r.Context(), token, audience)
+				if err != nil {
+					LoggerFromContext(r.Context()).Log(DebugLevel, "bearer token rejected", Fields{"error": err.Error()})
+					HTTP401().Write(w)
+					return
+				}
+				next.ServeHTTP(w, SetIdentity(self.identity(claims), r))
+				return
+			}
+			if session := GetSession(r); session != nil {
+				if identity := sessionIdentity(session); identity != nil {
+					r = SetIdentity(identity, r)
+				}
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// OIDC mounts the login, callback and logout handlers of oidc under prefix.
+func (self *Router) OIDC(prefix string, oidc *OIDC, mws ...func(http.Handler) http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	self.Get(prefix+"/login", oidc.LoginHandler(), mws...)
+	self.Get(prefix+"/callback", oidc.CallbackHandler(), mws...)
+	self.Get(prefix+"/logout", oidc.LogoutHandler(), mws...)
+	self.Post(prefix+"/logout", oidc.LogoutHandler(), mws...)
+}
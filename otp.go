@@ -0,0 +1,282 @@
+package httputils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SMSSender delivers text messages to phone numbers in E.164 form. Failures that sending again
+// cannot fix, such as an invalid number, are marked Permanent.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to string, message string) error
+}
+
+type SMSSenderFunc func(ctx context.Context, to string, message string) error
+
+func (self SMSSenderFunc) SendSMS(ctx context.Context, to string, message string) error {
+	return self(ctx, to, message)
+}
+
+// TwilioSMSSender sends through the Twilio Messages API.
+type TwilioSMSSender struct {
+	AccountSID string
+	AuthToken  string
+	From       string
+	// Endpoint is the API base URL, the public API when empty.
+	Endpoint string
+	Client   *http.Client
+}
+
+func (self *TwilioSMSSender) SendSMS(ctx context.Context, to string, message string) error {
+	endpoint := self.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.twilio.com"
+	}
+	form := url.Values{"To": {to}, "From": {self.From}, "Body": {message}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		endpoint+"/2010-04-01/Accounts/"+self.AccountSID+"/Messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.SetBasicAuth(self.AccountSID, self.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := self.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		return nil
+	}
+	err = fmt.Errorf("twilio answered %d: %s", response.StatusCode, strings.TrimSpace(string(detail)))
+	if response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+var phoneRegexp = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// PhoneValidator accepts phone numbers in E.164 form, such as "+14155550123".
+func PhoneValidator(key string) Validator {
+	return func(value interface{}) error {
+		stringValue, ok := value.(string)
+		if !ok {
+			return Error{Key: key, Description: " Should be string", Code: CodeTypeError, Args: []string{"string"}}
+		}
+		if !phoneRegexp.MatchString(stringValue) {
+			return Error{Key: key, Description: "Invalid phone number", Code: CodeInvalidPhoneError}
+		}
+		return nil
+	}
+}
+
+// GenerateOTP returns length random decimal digits from crypto/rand.
+func GenerateOTP(length int) string {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%0*s", length, n.String())
+}
+
+type otpRecord struct {
+	Hash    string    `json:"hash"`
+	Expires time.Time `json:"expires"`
+}
+
+// OTP issues one time codes sent by SMS and verifies them. Codes are kept hashed in Cache under
+// their purpose, such as "login" or "phone", and destination, so a new code replaces the last.
+type OTP struct {
+	Cache  Cache
+	Sender SMSSender
+	// SendLimiter and VerifyLimiter bound, by destination, how often codes are sent and checked.
+	// Either may be nil.
+	SendLimiter   RateLimiter
+	VerifyLimiter RateLimiter
+	// AttemptLimiter counts the guesses at the code of each purpose and destination, and should
+	// be reset by the RateLimitResetter it implements when a code is sent. The code is discarded
+	// once it refuses a guess. It may be nil when codes can be guessed at without limit.
+	AttemptLimiter RateLimiter
+	Length         int
+	TTL            time.Duration
+	// Message formats the SMS with the code.
+	Message string
+}
+
+// NewOTP sends 6 digit codes valid for 5 minutes and 5 attempts, limiting each destination to
+// 3 codes and 10 checks in 15 minutes. The limiters are kept in memory; use Redis ones to share
+// them between instances.
+func NewOTP(cache Cache, sender SMSSender) *OTP {
+	return &OTP{
+		Cache:          cache,
+		Sender:         sender,
+		SendLimiter:    NewMemorySlidingWindow(3, 15*time.Minute),
+		VerifyLimiter:  NewMemorySlidingWindow(10, 15*time.Minute),
+		AttemptLimiter: NewMemorySlidingWindow(5, 5*time.Minute),
+		Length:         6,
+		TTL:            5 * time.Minute,
+		Message:        "Your verification code is %s",
+	}
+}
+
+func (self *OTP) key(purpose string, destination string) string {
+	return "otp:" + purpose + ":" + destination
+}
+
+func (self *OTP) attemptsKey(purpose string, destination string) string {
+	return "otp:attempts:" + purpose + ":" + destination
+}
+
+func otpHash(purpose string, destination string, code string) string {
+	sum := sha256.Sum256([]byte(purpose + "\x00" + destination + "\x00" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// allow checks limiter. When the limiter fails, the call is let through unless strict.
+func (self *OTP) allow(ctx context.Context, limiter RateLimiter, key string, strict bool) error {
+	if limiter == nil {
+		return nil
+	}
+	result, err := limiter.Allow(key)
+	if err != nil && strict {
+		return Internal(err)
+	}
+	if err != nil {
+		LoggerFromContext(ctx).Log(ErrorLevel, "rate limiter failed", Fields{"error": err.Error()})
+		return nil
+	}
+	if !result.Allowed {
+		return HTTP429()
+	}
+	return nil
+}
+
+// Send issues a code for purpose and sends it to destination, a phone number. It fails with a
+// 429 when destination was sent too many codes and with a 502 when the SMS could not be sent.
+func (self *OTP) Send(ctx context.Context, purpose string, destination string) error {
+	if err := self.allow(ctx, self.SendLimiter, "otp:send:"+destination, false); err != nil {
+		return err
+	}
+	code := GenerateOTP(self.Length)
+	record := otpRecord{Hash: otpHash(purpose, destination, code), Expires: time.Now().Add(self.TTL)}
+	if err := SetJSON(ctx, self.Cache, self.key(purpose, destination), record, self.TTL); err != nil {
+		return err
+	}
+	if resetter, ok := self.AttemptLimiter.(RateLimitResetter); ok {
+		if err := resetter.Reset(self.attemptsKey(purpose, destination)); err != nil {
+			self.Cache.Delete(ctx, self.key(purpose, destination))
+			return err
+		}
+	}
+	err := Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+		return self.Sender.SendSMS(ctx, destination, fmt.Sprintf(self.Message, code))
+	})
+	if err != nil {
+		self.Cache.Delete(ctx, self.key(purpose, destination))
+		LoggerFromContext(ctx).Log(ErrorLevel, "otp delivery failed", Fields{"purpose": purpose, "error": err.Error()})
+		return HTTP502().Wrap(err)
+	}
+	return nil
+}
+
+// Verify checks code against the last one sent to destination for purpose and consumes it on
+// success. Missing and expired codes fail with CodeExpiredOTPError, wrong ones with
+// CodeInvalidOTPError and the attempts left in Meta, both as a 400 keyed "code"; too many checks
+// fail with a 429. Every guess counts against AttemptLimiter, concurrent ones included, and
+// none is checked when it or VerifyLimiter fails.
+func (self *OTP) Verify(ctx context.Context, purpose string, destination string, code string) error {
+	if err := self.allow(ctx, self.VerifyLimiter, "otp:verify:"+destination, true); err != nil {
+		return err
+	}
+	key := self.key(purpose, destination)
+	var record otpRecord
+	err := GetJSON(ctx, self.Cache, key, &record)
+	if err == ErrCacheMiss || (err == nil && time.Now().After(record.Expires)) {
+		return ServerError{400, Errors{[]Error{{Key: "code", Description: "Code expired", Code: CodeExpiredOTPError}}}}
+	}
+	if err != nil {
+		return err
+	}
+	remaining := -1
+	if self.AttemptLimiter != nil {
+		result, err := self.AttemptLimiter.Allow(self.attemptsKey(purpose, destination))
+		if err != nil {
+			return Internal(err)
+		}
+		if !result.Allowed {
+			self.Cache.Delete(ctx, key)
+			return HTTP429()
+		}
+		remaining = result.Remaining
+	}
+	if ConstantTimeEqual(record.Hash, otpHash(purpose, destination, code)) {
+		return self.Cache.Delete(ctx, key)
+	}
+	if remaining == 0 {
+		self.Cache.Delete(ctx, key)
+	}
+	if remaining < 0 {
+		return ServerError{400, Errors{[]Error{{Key: "code", Description: "Invalid code", Code: CodeInvalidOTPError}}}}
+	}
+	return ServerError{400, Errors{[]Error{Error{Key: "code", Description: "Invalid code", Code: CodeInvalidOTPError,
+		Meta: map[string]interface{}{"remaining_attempts": remaining}}}}}
+}
+
+// SendOTPHandler sends a code for purpose to the "phone" of the JSON body and answers 202 with
+// the seconds it expires in.
+func SendOTPHandler(otp *OTP, purpose string) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		body, err := GetValidatedBody(r, VMap{"phone": RequiredStringValidators("phone", PhoneValidator("phone"))})
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		if err := otp.Send(r.Context(), purpose, body["phone"].(string)); err != nil {
+			WriteError(w, err)
+			return
+		}
+		JSON(w, map[string]interface{}{"expires_in": int(otp.TTL.Seconds())}, http.StatusAccepted)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// VerifyOTPHandler verifies the "code" sent for purpose to the "phone" of the JSON body and
+// calls verified, which answers the request, for example by signing the user in.
+func VerifyOTPHandler(otp *OTP, purpose string, verified func(w http.ResponseWriter, r *http.Request, phone string)) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		body, err := GetValidatedBody(r, VMap{
+			"phone": RequiredStringValidators("phone", PhoneValidator("phone")),
+			"code":  RequiredStringValidators("code"),
+		})
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		phone := body["phone"].(string)
+		if err := otp.Verify(r.Context(), purpose, phone, body["code"].(string)); err != nil {
+			WriteError(w, err)
+			return
+		}
+		verified(w, r, phone)
+	}
+
+	return http.HandlerFunc(fn)
+}
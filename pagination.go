@@ -0,0 +1,204 @@
+package httputils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strconv"
+)
+
+type PaginationConfig struct {
+	DefaultLimit int
+	MaxLimit     int
+	// Keyset starts requests without a cursor on the first _id ordered page instead of offset 0.
+	Keyset bool
+}
+
+var DefaultPaginationConfig = PaginationConfig{DefaultLimit: 20, MaxLimit: 100}
+
+// Pagination is either offset based or, when After or Before is set, keyset based on _id.
+type Pagination struct {
+	Limit  int
+	Offset int
+	After  string
+	Before string
+	// keyset is set for the first page of a keyset paginated request, which has no cursor yet.
+	keyset bool
+}
+
+type cursor struct {
+	Offset *int   `json:"o,omitempty"`
+	After  string `json:"a,omitempty"`
+	Before string `json:"b,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (cursor, bool) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return c, false
+	}
+	if (c.After != "" && !bson.IsObjectIdHex(c.After)) || (c.Before != "" && !bson.IsObjectIdHex(c.Before)) {
+		return c, false
+	}
+	if c.Offset != nil && *c.Offset < 0 {
+		return c, false
+	}
+	return c, true
+}
+
+func (self Pagination) Keyset() bool {
+	return self.keyset || self.After != "" || self.Before != ""
+}
+
+// GetPagination reads limit, offset and cursor from the request, answering 400 for invalid values.
+func GetPagination(r *http.Request, config PaginationConfig) (Pagination, error) {
+	errs := NewErrorCollector()
+	pagination := Pagination{Limit: config.DefaultLimit}
+	if value := GetValueFromURLInRequest(r, "limit"); value != nil {
+		limit, err := strconv.Atoi(*value)
+		if err != nil {
+			errs.AddErrors(Error{Key: "limit", Description: " Should be int", Code: CodeTypeError, Args: []string{"int"}})
+		} else if limit < 1 || limit > config.MaxLimit {
+			errs.AddErrors(Error{Key: "limit", Description: "Invalid int", Code: CodeIntRangeError,
+				Meta: map[string]interface{}{"min": 1, "max": config.MaxLimit, "actual": limit}})
+		} else {
+			pagination.Limit = limit
+		}
+	}
+	if value := GetValueFromURLInRequest(r, "offset"); value != nil {
+		offset, err := strconv.Atoi(*value)
+		if err != nil {
+			errs.AddErrors(Error{Key: "offset", Description: " Should be int", Code: CodeTypeError, Args: []string{"int"}})
+		} else if offset < 0 {
+			errs.AddErrors(Error{Key: "offset", Description: "Invalid int", Code: CodeIntRangeError,
+				Meta: map[string]interface{}{"min": 0, "actual": offset}})
+		} else {
+			pagination.Offset = offset
+		}
+	}
+	if value := GetValueFromURLInRequest(r, "cursor"); value != nil {
+		c, ok := decodeCursor(*value)
+		if !ok {
+			errs.AddErrors(Error{Key: "cursor", Description: "Invalid cursor", Code: CodeInvalidCursor})
+		} else {
+			pagination.After = c.After
+			pagination.Before = c.Before
+			if c.Offset != nil {
+				pagination.Offset = *c.Offset
+			}
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return pagination, err
+	}
+	if config.Keyset && !pagination.Keyset() {
+		pagination.keyset = true
+	}
+	return pagination, nil
+}
+
+type Page struct {
+	Data       interface{} `json:"data"`
+	Total      *int        `json:"total,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
+	Links      Links       `json:"links,omitempty"`
+}
+
+// Paginate runs q on collection. Offset pages include the total count; keyset pages are ordered
+// by _id and skip the count.
+func Paginate(ctx context.Context, store Store, q bson.M, pagination Pagination) (Page, error) {
+	if pagination.Keyset() {
+		return paginateKeyset(ctx, store, q, pagination)
+	}
+	total, err := store.Find(ctx, q).Count()
+	if err != nil {
+		return Page{}, Internal(err)
+	}
+	results := []bson.M{}
+	err = store.Find(ctx, q).Skip(pagination.Offset).Limit(pagination.Limit).All(&results)
+	if err != nil {
+		return Page{}, Internal(err)
+	}
+	page := Page{Data: results, Total: &total}
+	if next := pagination.Offset + pagination.Limit; next < total {
+		page.NextCursor = encodeCursor(cursor{Offset: &next})
+	}
+	if pagination.Offset > 0 {
+		prev := pagination.Offset - pagination.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.PrevCursor = encodeCursor(cursor{Offset: &prev})
+	}
+	return page, nil
+}
+
+func paginateKeyset(ctx context.Context, store Store, q bson.M, pagination Pagination) (Page, error) {
+	selector := q
+	sort := "_id"
+	var bound bson.M
+	switch {
+	case pagination.Before != "":
+		bound = bson.M{"_id": bson.M{"$lt": bson.ObjectIdHex(pagination.Before)}}
+		sort = "-_id"
+	case pagination.After != "":
+		bound = bson.M{"_id": bson.M{"$gt": bson.ObjectIdHex(pagination.After)}}
+	}
+	if bound != nil && len(q) > 0 {
+		selector = bson.M{"$and": []bson.M{q, bound}}
+	} else if bound != nil {
+		selector = bound
+	}
+
+	results := []bson.M{}
+	err := store.Find(ctx, selector).Sort(sort).Limit(pagination.Limit + 1).All(&results)
+	if err != nil {
+		return Page{}, Internal(err)
+	}
+	more := len(results) > pagination.Limit
+	if more {
+		results = results[:pagination.Limit]
+	}
+	if pagination.Before != "" {
+		for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+			results[i], results[j] = results[j], results[i]
+		}
+	}
+
+	page := Page{Data: results}
+	if len(results) == 0 {
+		return page, nil
+	}
+	first := ObjectIDType{}.Format(results[0]["_id"])
+	last := ObjectIDType{}.Format(results[len(results)-1]["_id"])
+	if more || pagination.Before != "" {
+		page.NextCursor = encodeCursor(cursor{After: last})
+	}
+	if (more && pagination.Before != "") || pagination.After != "" {
+		page.PrevCursor = encodeCursor(cursor{Before: first})
+	}
+	return page, nil
+}
+
+// WritePage writes page as is, or its data with the pagination fields as metadata when an
+// envelope is configured.
+func WritePage(w http.ResponseWriter, page Page, err error) {
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if envelopeFor(w) == nil {
+		JSON(w, page, http.StatusOK)
+		return
+	}
+	Respond(w, http.StatusOK, page.Data, PageMeta(page))
+}
@@ -0,0 +1,84 @@
+package httputils
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var uuidRegexp = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+func IsUUID(value string) bool {
+	return uuidRegexp.MatchString(value)
+}
+
+// Params returns the path parameters matched by the router, or an empty map outside of a route.
+func Params(r *http.Request) map[string]string {
+	return ParamsFromContext(r.Context())
+}
+
+func ParamString(r *http.Request, key string) (string, error) {
+	value, ok := Params(r)[key]
+	if !ok || len(value) == 0 {
+		return "", Error{Key: key, Description: "Field is required", Code: CodeRequiredFieldError}.AsServerError(400)
+	}
+	return value, nil
+}
+
+func ParamInt(r *http.Request, key string) (int, error) {
+	value, err := ParamString(r, key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, Error{Key: key, Description: " Should be int", Code: CodeTypeError, Args: []string{"int"}}.AsServerError(400)
+	}
+	return i, nil
+}
+
+func ParamObjectID(r *http.Request, key string) (bson.ObjectId, error) {
+	value, err := ParamString(r, key)
+	if err != nil {
+		return "", err
+	}
+	if !bson.IsObjectIdHex(value) {
+		return "", HTTP404(value)
+	}
+	return bson.ObjectIdHex(value), nil
+}
+
+func ParamUUID(r *http.Request, key string) (string, error) {
+	value, err := ParamString(r, key)
+	if err != nil {
+		return "", err
+	}
+	if !IsUUID(value) {
+		return "", HTTP404(value)
+	}
+	return strings.ToLower(value), nil
+}
+
+// WithParams validates path parameters before the handler runs, answering 400 on failure.
+func WithParams(validatorMap VMap) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			values := make(map[string]interface{})
+			for key, value := range Params(r) {
+				values[key] = value
+			}
+			errs := ValidateMap(values, validatorMap)
+			if len(errs) > 0 {
+				ServerError{400, Errors{Errors: errs}}.Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return describe(http.HandlerFunc(fn), func(route *Route) {
+			route.addValidators("params", validatorMap)
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package httputils
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	JSONPatchContentType  = "application/json-patch+json"
+	MergePatchContentType = "application/merge-patch+json"
+)
+
+func HTTP415() ServerError {
+	return ServerError{415, Errors{[]Error{UndefinedKeyError(CodeUnsupportedMediaType, "Unsupported media type")}}}
+}
+
+func patchError(status int, op JSONPatchOperation, description string) error {
+	return Error{Key: op.Path, Description: description, Code: CodeInvalidPatchError, Args: []string{op.Op},
+		Meta: map[string]interface{}{"op": op.Op, "path": op.Path}}.AsServerError(status)
+}
+
+// JSONPatchOperation is one operation of an RFC 6902 JSON Patch.
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	// hasValue tells an explicit null value from a missing one.
+	hasValue bool
+}
+
+func (self *JSONPatchOperation) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, target := range map[string]*string{"op": &self.Op, "path": &self.Path, "from": &self.From} {
+		if raw, ok := fields[key]; ok {
+			if err := json.Unmarshal(raw, target); err != nil {
+				return err
+			}
+		}
+	}
+	raw, ok := fields["value"]
+	self.hasValue = ok
+	if ok {
+		return json.Unmarshal(raw, &self.Value)
+	}
+	return nil
+}
+
+type JSONPatch []JSONPatchOperation
+
+// ParseJSONPatch decodes and checks the shape of a JSON Patch, answering 400 when it is
+// malformed.
+func ParseJSONPatch(data []byte) (JSONPatch, error) {
+	var patch JSONPatch
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, HTTP400()
+	}
+	for _, op := range patch {
+		if _, err := pointerTokens(op.Path); err != nil {
+			return nil, patchError(400, op, "Invalid path")
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			if !op.hasValue {
+				return nil, patchError(400, op, "Value is required")
+			}
+		case "move", "copy":
+			if _, err := pointerTokens(op.From); err != nil {
+				return nil, patchError(400, op, "Invalid from")
+			}
+		case "remove":
+		default:
+			return nil, patchError(400, op, "Unknown operation")
+		}
+	}
+	return patch, nil
+}
+
+var errPatchPath = errors.New("httputils: patch path does not exist")
+
+func pointerTokens(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errPatchPath
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i, token := range tokens {
+		tokens[i] = unescape.Replace(token)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if token == "-" && end {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || token != strconv.Itoa(index) {
+		return 0, errPatchPath
+	}
+	if index > length || index == length && !end {
+		return 0, errPatchPath
+	}
+	return index, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	}
+	if document, ok := asDocument(value); ok {
+		return deepCopy(document)
+	}
+	return value
+}
+
+func pointerGet(node interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, errPatchPath
+			}
+			node = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			node = container[index]
+		default:
+			return nil, errPatchPath
+		}
+	}
+	return node, nil
+}
+
+// pointerUpdate calls fn with the parent of the location tokens point at and the last token,
+// storing the parent fn returns in its place.
+func pointerUpdate(node interface{}, tokens []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	switch container := node.(type) {
+	case map[string]interface{}:
+		child, ok := container[tokens[0]]
+		if !ok {
+			return nil, errPatchPath
+		}
+		child, err := pointerUpdate(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[tokens[0]] = child
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(tokens[0], len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := pointerUpdate(container[index], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = child
+		return container, nil
+	}
+	return nil, errPatchPath
+}
+
+func pointerAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		return nil, errPatchPath
+	})
+}
+
+func pointerRemove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, errPatchPath
+	}
+	return pointerUpdate(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, errPatchPath
+			}
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:index], container[index+1:]...), nil
+		}
+		return nil, errPatchPath
+	})
+}
+
+func (self JSONPatch) applyOperation(doc interface{}, op JSONPatchOperation) (interface{}, error) {
+	path, _ := pointerTokens(op.Path)
+	from, _ := pointerTokens(op.From)
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, deepCopy(op.Value))
+	case "remove":
+		return pointerRemove(doc, path)
+	case "replace":
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		doc, _ = pointerRemove(doc, path)
+		return pointerAdd(doc, path, deepCopy(op.Value))
+	case "move":
+		if op.Path != op.From && strings.HasPrefix(op.Path+"/", op.From+"/") {
+			return nil, errPatchPath
+		}
+		value, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = pointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "copy":
+		value, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, deepCopy(value))
+	case "test":
+		value, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !valuesEqual(value, op.Value) {
+			return nil, patchError(409, op, "Test failed")
+		}
+		return doc, nil
+	}
+	return nil, patchError(400, op, "Unknown operation")
+}
+
+// Apply runs the operations in order on a copy of doc, leaving doc unchanged. It answers 409 when
+// a test fails or a path does not exist, as nothing is applied unless every operation succeeds.
+func (self JSONPatch) Apply(doc map[string]interface{}) (map[string]interface{}, error) {
+	var result interface{} = deepCopy(doc)
+	for _, op := range self {
+		var err error
+		if op.Path == "" && op.Op == "replace" {
+			result = deepCopy(op.Value)
+			continue
+		}
+		if result, err = self.applyOperation(result, op); err != nil {
+			if err == errPatchPath {
+				return nil, patchError(409, op, "Path does not exist")
+			}
+			return nil, err
+		}
+	}
+	patched, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, patchError(409, JSONPatchOperation{Op: "replace"}, "Document must be an object")
+	}
+	return patched, nil
+}
+
+// MergePatch applies an RFC 7386 merge patch to target: objects are merged recursively, null
+// removes a member and any other value replaces it. target is not modified.
+func MergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopy(patch)
+	}
+	result, ok := deepCopy(target).(map[string]interface{})
+	if !ok {
+		result = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = MergePatch(result[key], value)
+		}
+	}
+	return result
+}
+
+// ToDocument converts a struct, or any other value encoding to a JSON object, to the map form
+// patches apply to. Maps go through JSON too, so values such as ObjectIds, times and integers
+// read from Mongo take the same form as those of the patch.
+func ToDocument(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	return doc, json.Unmarshal(data, &doc)
+}
+
+// IsPatchRequest reports whether the request body is a JSON Patch or a Merge Patch.
+func IsPatchRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == JSONPatchContentType || mediaType == MergePatchContentType
+}
+
+// GetPatchedDocument applies the JSON Patch or Merge Patch of the request body, chosen by its
+// Content-Type, to current and returns the result. Other content types are answered with 415.
+func GetPatchedDocument(r *http.Request, current interface{}) (map[string]interface{}, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != JSONPatchContentType && mediaType != MergePatchContentType {
+		return nil, HTTP415()
+	}
+	defer r.Body.Close()
+	var raw json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&raw)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, HTTP413()
+	}
+	if err != nil {
+		return nil, HTTP400()
+	}
+	doc, err := ToDocument(current)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType == MergePatchContentType {
+		var patch interface{}
+		json.Unmarshal(raw, &patch)
+		patched, ok := MergePatch(doc, patch).(map[string]interface{})
+		if !ok {
+			return nil, HTTP400()
+		}
+		return patched, nil
+	}
+	patch, err := ParseJSONPatch(raw)
+	if err != nil {
+		return nil, err
+	}
+	return patch.Apply(doc)
+}
+
+// GetPatchedBody is GetPatchedDocument followed by ValidateBody, so the whole patched document,
+// not only the patched keys, is checked. It returns only the keys of validatorMap the patch
+// changed: the others went through JSON, which turns ObjectIds and times into strings, and must
+// not be written back.
+func GetPatchedBody(r *http.Request, current interface{}, validatorMap VMap) (map[string]interface{}, error) {
+	original, err := ToDocument(current)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := GetPatchedDocument(r, current)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ValidateBody(doc, validatorMap); err != nil {
+		return nil, err
+	}
+	changed := map[string]interface{}{}
+	for key := range validatorMap {
+		value, ok := doc[key]
+		if previous, existed := original[key]; ok && (!existed || !valuesEqual(previous, value)) {
+			changed[key] = value
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,96 @@
+package httputils
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Payload is a file sent inline in a JSON body, as base64 or a data URI.
+type Payload struct {
+	Data []byte
+	// MIME is the type sniffed from Data, not the one the client declared.
+	MIME string
+}
+
+func decodeBase64(value string) ([]byte, error) {
+	value = strings.TrimRight(value, "=")
+	if strings.ContainsAny(value, "-_") {
+		return base64.RawURLEncoding.DecodeString(value)
+	}
+	return base64.RawStdEncoding.DecodeString(value)
+}
+
+func mimeAllowed(mediaType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		if pattern == mediaType || strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodePayload reads value, standard or URL-safe base64 with optional padding or a
+// "data:<type>;base64," URI, under key. Sizes are checked before decoding so oversized values are
+// refused cheaply. The type is sniffed with http.DetectContentType and must match allowedMIMEs,
+// which may hold wildcards such as "image/*", and the type a data URI declares.
+func DecodePayload(key string, value interface{}, maxDecodedBytes int, allowedMIMEs []string) (Payload, error) {
+	stringValue, ok := value.(string)
+	if !ok {
+		return Payload{}, Error{Key: key, Description: " Should be string", Code: CodeTypeError, Args: []string{"string"}}
+	}
+	invalid := Error{Key: key, Description: "Invalid base64", Code: CodeInvalidBase64Error}
+	declared := ""
+	if strings.HasPrefix(stringValue, "data:") {
+		header, data, found := strings.Cut(stringValue[len("data:"):], ",")
+		if !found || !strings.HasSuffix(header, ";base64") {
+			return Payload{}, invalid
+		}
+		if header = strings.TrimSuffix(header, ";base64"); header != "" {
+			mediaType, _, err := mime.ParseMediaType(header)
+			if err != nil {
+				return Payload{}, invalid
+			}
+			declared = mediaType
+		}
+		stringValue = data
+	}
+	if maxDecodedBytes > 0 && base64.RawStdEncoding.DecodedLen(len(strings.TrimRight(stringValue, "="))) > maxDecodedBytes {
+		return Payload{}, Error{Key: key, Description: "File is too large", Code: CodeFileTooLargeError, Args: []string{strconv.Itoa(maxDecodedBytes)},
+			Meta: map[string]interface{}{"max": maxDecodedBytes}}
+	}
+	data, err := decodeBase64(stringValue)
+	if err != nil || len(data) == 0 {
+		return Payload{}, invalid
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if declared != "" && mediaType != "application/octet-stream" && declared != mediaType {
+		return Payload{}, Error{Key: key, Description: "File type does not match", Code: CodeInvalidFileTypeError, Args: []string{mediaType},
+			Meta: map[string]interface{}{"declared": declared, "actual": mediaType}}
+	}
+	if !mimeAllowed(mediaType, allowedMIMEs) {
+		return Payload{}, Error{Key: key, Description: "File type is not allowed", Code: CodeInvalidFileTypeError, Args: []string{mediaType},
+			Meta: map[string]interface{}{"allowed": allowedMIMEs, "actual": mediaType}}
+	}
+	return Payload{data, mediaType}, nil
+}
+
+// Base64Validator accepts the inline files DecodePayload reads. A maxDecodedBytes of 0 means
+// no limit and empty allowedMIMEs allow any type.
+func Base64Validator(key string, maxDecodedBytes int, allowedMIMEs []string) Validator {
+	return func(value interface{}) error {
+		_, err := DecodePayload(key, value, maxDecodedBytes, allowedMIMEs)
+		return err
+	}
+}
+
+// BodyPayload returns the decoded file at key of the body validated by WithBody with a
+// Base64Validator.
+func BodyPayload(r *http.Request, key string) (Payload, error) {
+	return DecodePayload(key, ValidatedBody(r)[key], 0, nil)
+}
@@ -0,0 +1,294 @@
+package httputils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// PDFRenderer renders template with data as a PDF document written to w.
+type PDFRenderer interface {
+	RenderPDF(w io.Writer, template string, data interface{}) error
+}
+
+// DefaultPDFRenderer is used by PDF and must be set before rendering.
+var DefaultPDFRenderer PDFRenderer
+
+type PDFOptions struct {
+	// Renderer renders the document, DefaultPDFRenderer when nil.
+	Renderer PDFRenderer
+	// Filename names the document for browsers and download managers.
+	Filename string
+	// Attachment asks browsers to download the document instead of displaying it.
+	Attachment bool
+}
+
+// pdfResponseWriter sends the headers with the first bytes of the document, so a renderer
+// failing before it writes anything can still be answered with an error.
+type pdfResponseWriter struct {
+	w       http.ResponseWriter
+	options PDFOptions
+	started bool
+}
+
+func (self *pdfResponseWriter) Write(p []byte) (int, error) {
+	if !self.started {
+		self.started = true
+		disposition := "inline"
+		if self.options.Attachment {
+			disposition = "attachment"
+		}
+		params := map[string]string{}
+		if self.options.Filename != "" {
+			params["filename"] = self.options.Filename
+		}
+		self.w.Header().Set("Content-Type", "application/pdf")
+		self.w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, params))
+		self.w.WriteHeader(http.StatusOK)
+	}
+	return self.w.Write(p)
+}
+
+// Write streams template rendered with data. Errors before the document starts are answered
+// with a 500; later ones can only end the response early. Both are logged and returned.
+func (self PDFOptions) Write(w http.ResponseWriter, template string, data interface{}) error {
+	renderer := self.Renderer
+	if renderer == nil {
+		renderer = DefaultPDFRenderer
+	}
+	if renderer == nil {
+		err := errors.New("DefaultPDFRenderer is not set")
+		DefaultLogger.Log(ErrorLevel, "pdf rendering failed", Fields{"template": template, "error": err.Error()})
+		raise500(w, nil)
+		return err
+	}
+	writer := &pdfResponseWriter{w: w, options: self}
+	buffered := bufio.NewWriterSize(writer, 32*1024)
+	err := renderer.RenderPDF(buffered, template, data)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		DefaultLogger.Log(ErrorLevel, "pdf rendering failed", Fields{"template": template, "error": err.Error()})
+		if !writer.started {
+			raise500(w, nil)
+		}
+	}
+	return err
+}
+
+// PDF streams template rendered with data by DefaultPDFRenderer for display in the browser.
+func PDF(w http.ResponseWriter, template string, data interface{}) error {
+	return PDFOptions{}.Write(w, template, data)
+}
+
+// TextPDFRenderer is the built-in renderer. It lays out the output of text/template files of
+// FS as lines of Courier, suited to receipts and plain invoices where columns align. Long lines
+// wrap, a form feed starts a new page, and characters outside Windows-1252 print as "?".
+type TextPDFRenderer struct {
+	FS    fs.FS
+	Funcs template.FuncMap
+	// Width and Height are the page size in points, A4 by default.
+	Width    float64
+	Height   float64
+	Margin   float64
+	FontSize float64
+	mutex    sync.RWMutex
+	cache    map[string]*template.Template
+}
+
+func NewTextPDFRenderer(fsys fs.FS) *TextPDFRenderer {
+	return &TextPDFRenderer{FS: fsys, Width: 595, Height: 842, Margin: 50, FontSize: 10,
+		cache: make(map[string]*template.Template)}
+}
+
+func (self *TextPDFRenderer) lookup(name string) (*template.Template, error) {
+	self.mutex.RLock()
+	t, ok := self.cache[name]
+	self.mutex.RUnlock()
+	if ok {
+		return t, nil
+	}
+	t, err := template.New(name).Funcs(self.Funcs).ParseFS(self.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	self.mutex.Lock()
+	if self.cache == nil {
+		self.cache = make(map[string]*template.Template)
+	}
+	self.cache[name] = t
+	self.mutex.Unlock()
+	return t, nil
+}
+
+// pdfPages splits text into pages of lines at most columns wide.
+func pdfPages(text string, columns int, rows int) [][]string {
+	var pages [][]string
+	for _, page := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\f") {
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSuffix(page, "\n"), "\n") {
+			runes := []rune(strings.ReplaceAll(line, "\t", "    "))
+			for len(runes) > columns {
+				lines = append(lines, string(runes[:columns]))
+				runes = runes[columns:]
+			}
+			lines = append(lines, string(runes))
+		}
+		for len(lines) > rows {
+			pages = append(pages, lines[:rows])
+			lines = lines[rows:]
+		}
+		pages = append(pages, lines)
+	}
+	return pages
+}
+
+// pdfString encodes line as a PDF literal string in Windows-1252.
+func pdfString(line string) string {
+	var builder strings.Builder
+	builder.WriteByte('(')
+	for _, r := range line {
+		c, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok {
+			c = '?'
+		}
+		if c == '(' || c == ')' || c == '\\' {
+			builder.WriteByte('\\')
+		}
+		builder.WriteByte(c)
+	}
+	builder.WriteByte(')')
+	return builder.String()
+}
+
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (self *countingWriter) Write(p []byte) (int, error) {
+	n, err := self.w.Write(p)
+	self.count += int64(n)
+	return n, err
+}
+
+// RenderPDF executes template into memory, then writes the document page by page.
+func (self *TextPDFRenderer) RenderPDF(w io.Writer, name string, data interface{}) error {
+	t, err := self.lookup(name)
+	if err != nil {
+		return err
+	}
+	var text bytes.Buffer
+	if err := t.Execute(&text, data); err != nil {
+		return err
+	}
+	leading := self.FontSize * 1.3
+	// Courier glyphs are 0.6 em wide.
+	columns := int((self.Width - 2*self.Margin) / (self.FontSize * 0.6))
+	rows := int((self.Height - 2*self.Margin) / leading)
+	if columns < 1 || rows < 1 {
+		return fmt.Errorf("page of %gx%g points has no room for text", self.Width, self.Height)
+	}
+	pages := pdfPages(text.String(), columns, rows)
+
+	out := &countingWriter{w: w}
+	// Objects 1 and 2 are the catalog and the page tree, written last once the pages are known,
+	// 3 the font, and each page a content stream and a page object.
+	offsets := map[int]int64{}
+	object := func(number int, body string) error {
+		offsets[number] = out.count
+		_, err := fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", number, body)
+		return err
+	}
+	if _, err := io.WriteString(out, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"); err != nil {
+		return err
+	}
+	if err := object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>"); err != nil {
+		return err
+	}
+	kids := make([]string, len(pages))
+	for i, lines := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT\n/F1 %g Tf\n%g TL\n%g %g Td\n", self.FontSize, leading, self.Margin, self.Height-self.Margin-self.FontSize)
+		for _, line := range lines {
+			content.WriteString(pdfString(line) + " Tj T*\n")
+		}
+		content.WriteString("ET")
+		contents, page := 4+2*i, 5+2*i
+		if err := object(contents, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String())); err != nil {
+			return err
+		}
+		if err := object(page, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			self.Width, self.Height, contents)); err != nil {
+			return err
+		}
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	if err := object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))); err != nil {
+		return err
+	}
+	if err := object(1, "<< /Type /Catalog /Pages 2 0 R >>"); err != nil {
+		return err
+	}
+	size := 4 + 2*len(pages)
+	xref := out.count
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for number := 1; number < size; number++ {
+		fmt.Fprintf(out, "%010d 00000 n \n", offsets[number])
+	}
+	_, err = fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, xref)
+	return err
+}
+
+// CommandPDFRenderer renders HTML pages of Templates and converts them with an external
+// command reading HTML on stdin and writing PDF on stdout, such as wkhtmltopdf. The output is
+// streamed as the command produces it.
+type CommandPDFRenderer struct {
+	Templates *Templates
+	Command   string
+	Args      []string
+	// Timeout kills the command when it runs longer, unbounded when zero.
+	Timeout time.Duration
+}
+
+// NewWkhtmltopdfRenderer converts pages of templates with wkhtmltopdf found in PATH, within 30
+// seconds.
+func NewWkhtmltopdfRenderer(templates *Templates) *CommandPDFRenderer {
+	return &CommandPDFRenderer{Templates: templates, Command: "wkhtmltopdf", Args: []string{"--quiet", "-", "-"},
+		Timeout: 30 * time.Second}
+}
+
+func (self *CommandPDFRenderer) RenderPDF(w io.Writer, name string, data interface{}) error {
+	page, err := self.Templates.Render(name, data)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if self.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, self.Timeout)
+		defer cancel()
+	}
+	var stderr bytes.Buffer
+	command := exec.CommandContext(ctx, self.Command, self.Args...)
+	command.Stdin = bytes.NewReader(page)
+	command.Stdout = w
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", self.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package httputils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type ErrorSerializer func(w http.ResponseWriter, serverError ServerError)
+
+// DefaultErrorSerializer writes errors for routers that do not configure their own.
+var DefaultErrorSerializer ErrorSerializer = JSONErrorSerializer
+
+func JSONErrorSerializer(w http.ResponseWriter, serverError ServerError) {
+	requestID := w.Header().Get(RequestIDHeader)
+	bytes, err := json.Marshal(errorsPayload{serverError.Errors, requestID})
+	if err != nil {
+		serverError = HTTP500()
+		bytes, _ = json.Marshal(errorsPayload{serverError.Errors, requestID})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(serverError.StatusCode)
+	w.Write(bytes)
+}
+
+type Problem struct {
+	Type      string  `json:"type"`
+	Title     string  `json:"title"`
+	Status    int     `json:"status"`
+	Detail    string  `json:"detail,omitempty"`
+	Instance  string  `json:"instance,omitempty"`
+	Code      string  `json:"code,omitempty"`
+	Errors    []Error `json:"errors,omitempty"`
+	RequestID string  `json:"request_id,omitempty"`
+}
+
+func NewProblem(serverError ServerError, typeBase string, requestID string) Problem {
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(serverError.StatusCode),
+		Status:    serverError.StatusCode,
+		Errors:    serverError.Errors.Errors,
+		RequestID: requestID,
+	}
+	if len(serverError.Errors.Errors) > 0 {
+		first := serverError.Errors.Errors[0]
+		problem.Code = first.Code
+		problem.Detail = first.Description
+		if typeBase != "" {
+			problem.Type = strings.TrimSuffix(typeBase, "/") + "/" + strings.ToLower(first.Code)
+		}
+	}
+	if requestID != "" {
+		problem.Instance = "urn:request:" + requestID
+	}
+	return problem
+}
+
+// ProblemSerializer writes errors as RFC 7807 application/problem+json. When typeBase is set the
+// problem type is typeBase followed by the lowercased error code, otherwise about:blank.
+func ProblemSerializer(typeBase string) ErrorSerializer {
+	return func(w http.ResponseWriter, serverError ServerError) {
+		problem := NewProblem(serverError, typeBase, w.Header().Get(RequestIDHeader))
+		bytes, err := json.Marshal(problem)
+		if err != nil {
+			problem = NewProblem(HTTP500(), typeBase, problem.RequestID)
+			bytes, _ = json.Marshal(problem)
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(problem.Status)
+		w.Write(bytes)
+	}
+}
+
+type errorSerializerCarrier interface {
+	errorSerializer() ErrorSerializer
+}
+
+type serializerResponseWriter struct {
+	http.ResponseWriter
+	serializer ErrorSerializer
+}
+
+func (self serializerResponseWriter) errorSerializer() ErrorSerializer {
+	return self.serializer
+}
+
+func (self serializerResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+func errorSerializerFor(w http.ResponseWriter) ErrorSerializer {
+	for {
+		if carrier, ok := w.(errorSerializerCarrier); ok {
+			return carrier.errorSerializer()
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return DefaultErrorSerializer
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// ErrorSerializerMiddlewareFactory makes ServerError.Write use serializer for the wrapped handlers.
+func ErrorSerializerMiddlewareFactory(serializer ErrorSerializer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(serializerResponseWriter{w, serializer}, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// WithErrorSerializer selects how the router writes errors, including its 404 and 405 responses.
+func WithErrorSerializer(serializer ErrorSerializer) RouterOption {
+	return func(router *Router) {
+		router.errorSerializer = serializer
+	}
+}
@@ -0,0 +1,146 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+)
+
+func HTTP502() ServerError {
+	return ServerError{502, Errors{[]Error{UndefinedKeyError(CodeBadGateway, "Upstream service failed")}}}
+}
+
+type ProxyConfig struct {
+	Target *url.URL
+	// Rewrite maps the incoming path, after any Mount prefix is stripped, before it is joined to
+	// Target's path.
+	Rewrite func(path string) string
+	// Headers are set on every upstream request, e.g. service credentials.
+	Headers http.Header
+	// Timeout bounds the whole upstream exchange including retries.
+	Timeout time.Duration
+	// Retries is how many more times idempotent requests without a body are sent after a
+	// connection error or a 502, 503 or 504 from the upstream.
+	Retries      int
+	RetryBackoff time.Duration
+	Transport    http.RoundTripper
+	// Breakers guards the upstream with a circuit breaker; a default one is used when nil.
+	Breakers *CircuitBreakers
+}
+
+// Proxy forwards requests to config.Target. The request id is passed on in X-Request-ID and
+// trace headers such as traceparent are forwarded untouched. Unreachable or failing upstreams
+// are answered with the package's JSON errors: 504 on timeout, 503 while the circuit is open,
+// 502 otherwise, including upstream 5xx responses that are not JSON.
+func Proxy(config ProxyConfig) http.Handler {
+	transport := config.Transport
+	breakers := config.Breakers
+	if breakers == nil {
+		breakers = NewCircuitBreakers(DefaultBreakerConfig)
+	}
+	transport = BreakerTransport(transport, breakers)
+	if config.Retries > 0 {
+		policy := DefaultRetryPolicy
+		policy.Attempts, policy.Backoff = config.Retries+1, config.RetryBackoff
+		transport = retryTransport{transport, policy}
+	}
+	proxy := &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(request *httputil.ProxyRequest) {
+			if config.Rewrite != nil {
+				u := *request.Out.URL
+				u.Path = config.Rewrite(u.Path)
+				u.RawPath = ""
+				request.Out.URL = &u
+			}
+			request.SetURL(config.Target)
+			request.SetXForwarded()
+			for key, values := range config.Headers {
+				request.Out.Header[key] = append([]string(nil), values...)
+			}
+			if id := GetRequestID(request.In); id != "" {
+				request.Out.Header.Set(RequestIDHeader, id)
+			}
+		},
+		ModifyResponse: func(response *http.Response) error {
+			if response.StatusCode < 500 {
+				return nil
+			}
+			mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+			if mediaType == "application/json" || mediaType == "application/problem+json" {
+				return nil
+			}
+			response.Body.Close()
+			return HTTP502()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, context.DeadlineExceeded) {
+				HTTP504().Write(w)
+				return
+			}
+			if errors.Is(err, ErrCircuitOpen) {
+				WriteError(w, err)
+				return
+			}
+			if r.Context().Err() != nil {
+				return
+			}
+			WriteError(w, HTTP502().Wrap(err))
+		},
+	}
+	if config.Timeout <= 0 {
+		return proxy
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), config.Timeout)
+		defer cancel()
+		proxy.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Proxy mounts config.Target under prefix.
+func (self *Router) Proxy(prefix string, config ProxyConfig, mws ...func(http.Handler) http.Handler) {
+	self.Mount(prefix, Proxy(config), mws...)
+}
+
+type retryTransport struct {
+	transport http.RoundTripper
+	policy    RetryPolicy
+}
+
+func (self retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := self.policy
+	if req.Body != nil && req.Body != http.NoBody {
+		policy.Attempts = 1
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		policy.Attempts = 1
+	}
+	// The failing response of the last attempt is passed on to the client.
+	var response *http.Response
+	err := Retry(req.Context(), policy, func(ctx context.Context) error {
+		if response != nil {
+			response.Body.Close()
+		}
+		var err error
+		response, err = self.transport.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		switch response.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return HTTP502()
+		}
+		return nil
+	})
+	if response != nil && errors.Is(err, HTTP502()) {
+		return response, nil
+	}
+	return response, err
+}
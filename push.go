@@ -0,0 +1,431 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	PushFCM  = "fcm"
+	PushAPNs = "apns"
+)
+
+// ErrPushTokenUnregistered is returned for device tokens the provider no longer accepts, which
+// should be removed.
+var ErrPushTokenUnregistered = errors.New("httputils: push token is unregistered")
+
+type PushNotification struct {
+	Title string
+	Body  string
+	Data  map[string]string
+	// Badge sets the app icon badge on iOS when not nil.
+	Badge *int
+	Sound string
+	// TTL is how long the provider keeps the notification for offline devices, its default when zero.
+	TTL time.Duration
+	// CollapseKey replaces an undelivered notification with the same key.
+	CollapseKey string
+}
+
+// PushProvider delivers a notification to one device token and returns the provider's message id.
+type PushProvider interface {
+	Send(ctx context.Context, token string, notification PushNotification) (string, error)
+}
+
+var (
+	fcmTokenRegexp  = regexp.MustCompile(`^[A-Za-z0-9_-]+:[A-Za-z0-9_-]+$`)
+	apnsTokenRegexp = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+// IsFCMToken reports whether token has the "<instance id>:<token>" form of FCM registration tokens.
+func IsFCMToken(token string) bool {
+	return len(token) >= 100 && len(token) <= 4096 && fcmTokenRegexp.MatchString(token)
+}
+
+// IsAPNsToken reports whether token is an APNs device token, 32 hex encoded bytes.
+func IsAPNsToken(token string) bool {
+	return apnsTokenRegexp.MatchString(token)
+}
+
+func deviceTokenValidator(key string, platform string, valid func(string) bool) Validator {
+	return func(value interface{}) error {
+		stringValue, ok := value.(string)
+		if !ok {
+			return Error{Key: key, Description: " Should be string", Code: CodeTypeError, Args: []string{"string"}}
+		}
+		if !valid(stringValue) {
+			return Error{Key: key, Description: "Invalid device token", Code: CodeInvalidDeviceTokenError, Args: []string{platform},
+				Meta: map[string]interface{}{"platform": platform}}
+		}
+		return nil
+	}
+}
+
+func FCMTokenValidator(key string) Validator {
+	return deviceTokenValidator(key, PushFCM, IsFCMToken)
+}
+
+func APNsTokenValidator(key string) Validator {
+	return deviceTokenValidator(key, PushAPNs, IsAPNsToken)
+}
+
+// DeviceTokenValidator checks tokens of platform, rejecting every token of unknown platforms.
+func DeviceTokenValidator(key string, platform string) Validator {
+	switch platform {
+	case PushFCM:
+		return FCMTokenValidator(key)
+	case PushAPNs:
+		return APNsTokenValidator(key)
+	}
+	return func(value interface{}) error {
+		return Error{Key: key, Description: "Invalid device token", Code: CodeInvalidDeviceTokenError, Args: []string{platform},
+			Meta: map[string]interface{}{"platform": platform}}
+	}
+}
+
+// pushError classifies a provider rejection: unregistered tokens wrap ErrPushTokenUnregistered,
+// and they and other rejections with a 4xx status but 429 are permanent.
+func pushError(provider string, status int, reason string, unregistered bool) error {
+	if unregistered {
+		return Permanent(fmt.Errorf("%s: %w: %s", provider, ErrPushTokenUnregistered, reason))
+	}
+	err := fmt.Errorf("%s answered %d: %s", provider, status, reason)
+	if status < 500 && status != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// FCMProvider sends through the Firebase Cloud Messaging HTTP v1 API.
+type FCMProvider struct {
+	ProjectID string
+	// AccessToken returns an OAuth2 token of a service account with the firebase.messaging
+	// scope, such as the one of a golang.org/x/oauth2/google token source.
+	AccessToken func(ctx context.Context) (string, error)
+	// Endpoint is the API base URL, the public API when empty.
+	Endpoint string
+	Client   *http.Client
+}
+
+func (self *FCMProvider) Send(ctx context.Context, token string, notification PushNotification) (string, error) {
+	accessToken, err := self.AccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	message := map[string]interface{}{
+		"token":        token,
+		"notification": map[string]string{"title": notification.Title, "body": notification.Body},
+	}
+	if len(notification.Data) > 0 {
+		message["data"] = notification.Data
+	}
+	android := map[string]interface{}{}
+	if notification.CollapseKey != "" {
+		android["collapse_key"] = notification.CollapseKey
+	}
+	if notification.TTL > 0 {
+		android["ttl"] = strconv.FormatInt(int64(notification.TTL/time.Second), 10) + "s"
+	}
+	if notification.Sound != "" {
+		android["notification"] = map[string]string{"sound": notification.Sound}
+	}
+	if len(android) > 0 {
+		message["android"] = android
+	}
+	if notification.Badge != nil || notification.Sound != "" {
+		aps := map[string]interface{}{}
+		if notification.Badge != nil {
+			aps["badge"] = *notification.Badge
+		}
+		if notification.Sound != "" {
+			aps["sound"] = notification.Sound
+		}
+		message["apns"] = map[string]interface{}{"payload": map[string]interface{}{"aps": aps}}
+	}
+	body, err := json.Marshal(map[string]interface{}{"message": message})
+	if err != nil {
+		return "", Permanent(err)
+	}
+	endpoint := self.Endpoint
+	if endpoint == "" {
+		endpoint = "https://fcm.googleapis.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		endpoint+"/v1/projects/"+self.ProjectID+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return "", Permanent(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	client := self.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	var result struct {
+		Name  string `json:"name"`
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(response.Body, 64*1024)).Decode(&result)
+	if response.StatusCode == http.StatusOK {
+		return result.Name, nil
+	}
+	unregistered := false
+	for _, detail := range result.Error.Details {
+		unregistered = unregistered || detail.ErrorCode == "UNREGISTERED"
+	}
+	return "", pushError("fcm", response.StatusCode, result.Error.Message, unregistered)
+}
+
+// APNsProvider sends through the Apple Push Notification service with token based
+// authentication. Tokens are signed with Key and reused for 50 minutes, as Apple expects.
+type APNsProvider struct {
+	// Topic is the bundle id of the app.
+	Topic  string
+	KeyID  string
+	TeamID string
+	Key    *ecdsa.PrivateKey
+	// Sandbox sends to development builds.
+	Sandbox bool
+	// Endpoint overrides the production and sandbox URLs.
+	Endpoint string
+	Client   *http.Client
+	mutex    sync.Mutex
+	jwt      string
+	issued   time.Time
+}
+
+// ParseAPNsKey reads the PEM encoded .p8 key downloaded from Apple.
+func ParseAPNsKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("apns key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("apns key is not an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+func (self *APNsProvider) token() (string, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.jwt != "" && time.Since(self.issued) < 50*time.Minute {
+		return self.jwt, nil
+	}
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": self.KeyID})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": self.TeamID, "iat": now.Unix()})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, self.Key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	self.jwt, self.issued = unsigned+"."+base64.RawURLEncoding.EncodeToString(signature), now
+	return self.jwt, nil
+}
+
+func (self *APNsProvider) Send(ctx context.Context, token string, notification PushNotification) (string, error) {
+	jwt, err := self.token()
+	if err != nil {
+		return "", Permanent(err)
+	}
+	aps := map[string]interface{}{"alert": map[string]string{"title": notification.Title, "body": notification.Body}}
+	if notification.Badge != nil {
+		aps["badge"] = *notification.Badge
+	}
+	if notification.Sound != "" {
+		aps["sound"] = notification.Sound
+	}
+	payload := map[string]interface{}{"aps": aps}
+	for key, value := range notification.Data {
+		if key != "aps" {
+			payload[key] = value
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", Permanent(err)
+	}
+	endpoint := self.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.push.apple.com"
+		if self.Sandbox {
+			endpoint = "https://api.sandbox.push.apple.com"
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/3/device/"+token, bytes.NewReader(body))
+	if err != nil {
+		return "", Permanent(err)
+	}
+	req.Header.Set("Authorization", "bearer "+jwt)
+	req.Header.Set("Apns-Topic", self.Topic)
+	req.Header.Set("Apns-Push-Type", "alert")
+	req.Header.Set("Content-Type", "application/json")
+	if notification.TTL > 0 {
+		req.Header.Set("Apns-Expiration", strconv.FormatInt(time.Now().Add(notification.TTL).Unix(), 10))
+	}
+	if notification.CollapseKey != "" {
+		req.Header.Set("Apns-Collapse-Id", notification.CollapseKey)
+	}
+	client := self.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, response.Body)
+		return response.Header.Get("Apns-Id"), nil
+	}
+	var result struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(response.Body, 64*1024)).Decode(&result)
+	unregistered := response.StatusCode == http.StatusGone || result.Reason == "BadDeviceToken" ||
+		result.Reason == "Unregistered"
+	return "", pushError("apns", response.StatusCode, result.Reason, unregistered)
+}
+
+type PushTarget struct {
+	Platform string `json:"platform" bson:"platform"`
+	Token    string `json:"token" bson:"token"`
+}
+
+// PushDelivery is the outcome of sending to one target.
+type PushDelivery struct {
+	Time         time.Time `json:"time" bson:"time"`
+	Platform     string    `json:"platform" bson:"platform"`
+	Token        string    `json:"token" bson:"token"`
+	MessageID    string    `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	Error        string    `json:"error,omitempty" bson:"error,omitempty"`
+	Unregistered bool      `json:"unregistered,omitempty" bson:"unregistered,omitempty"`
+	Duration     string    `json:"duration" bson:"duration"`
+}
+
+// PushDispatcher sends notifications through the provider of each target's platform.
+type PushDispatcher struct {
+	Providers map[string]PushProvider
+	// Runner runs the batches of Dispatch.
+	Runner *JobRunner
+	// BatchSize is the number of targets of each job, 500 when zero.
+	BatchSize int
+	// Results receives the deliveries of each batch, for example to store them for audit or to
+	// remove unregistered tokens.
+	Results func(ctx context.Context, deliveries []PushDelivery)
+}
+
+// ValidatePushTargets checks the platform and token format of each target. Errors are returned
+// together as a 400, each with the target's index in its Meta.
+func (self *PushDispatcher) ValidatePushTargets(targets []PushTarget) error {
+	collector := NewErrorCollector().Status(400)
+	for i, target := range targets {
+		if _, ok := self.Providers[target.Platform]; !ok {
+			collector.AddErrors(Error{Key: "platform", Description: "Invalid platform", Code: CodeInvalidRequest, Args: []string{target.Platform},
+				Meta: map[string]interface{}{"index": i}})
+			continue
+		}
+		if err := DeviceTokenValidator("token", target.Platform)(target.Token); err != nil {
+			collector.AddErrors(err.(Error).WithMeta("index", i))
+		}
+	}
+	return collector.Err()
+}
+
+// Send delivers notification to targets one after another, retrying transient failures with
+// DefaultRetryPolicy, and returns a delivery per target in order.
+func (self *PushDispatcher) Send(ctx context.Context, targets []PushTarget, notification PushNotification) []PushDelivery {
+	deliveries := make([]PushDelivery, len(targets))
+	for i, target := range targets {
+		t1 := time.Now()
+		delivery := PushDelivery{Time: t1, Platform: target.Platform, Token: target.Token}
+		provider, ok := self.Providers[target.Platform]
+		err := fmt.Errorf("no push provider for %q", target.Platform)
+		if ok {
+			err = Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+				id, err := provider.Send(ctx, target.Token, notification)
+				delivery.MessageID = id
+				return err
+			})
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+			delivery.Unregistered = errors.Is(err, ErrPushTokenUnregistered)
+		}
+		delivery.Duration = time.Since(t1).String()
+		deliveries[i] = delivery
+	}
+	if self.Results != nil {
+		self.Results(ctx, deliveries)
+	}
+	return deliveries
+}
+
+// Dispatch validates targets and enqueues them on Runner in batches of BatchSize. A batch job
+// fails, and is logged by the runner, when a delivery failed for another reason than an
+// unregistered token. Dispatch fails when targets are invalid or a batch could not be queued.
+func (self *PushDispatcher) Dispatch(targets []PushTarget, notification PushNotification) error {
+	if err := self.ValidatePushTargets(targets); err != nil {
+		return err
+	}
+	size := self.BatchSize
+	if size <= 0 {
+		size = 500
+	}
+	for start := 0; start < len(targets); start += size {
+		batch := targets[start:min(start+size, len(targets))]
+		err := self.Runner.Enqueue("push", func(ctx context.Context) error {
+			failed := 0
+			for _, delivery := range self.Send(ctx, batch, notification) {
+				if delivery.Error != "" && !delivery.Unregistered {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d push deliveries failed", failed, len(batch))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package httputils
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+const (
+	OpEq  = "eq"
+	OpNe  = "ne"
+	OpGt  = "gt"
+	OpGte = "gte"
+	OpLt  = "lt"
+	OpLte = "lte"
+	OpIn  = "in"
+)
+
+type Filter struct {
+	Field    string
+	Operator string
+	Value    interface{}
+}
+
+// ListQuery is the backend-agnostic result of parsing sort and filter query parameters.
+type ListQuery struct {
+	Sort    []SortField
+	Filters []Filter
+}
+
+type FieldType int
+
+const (
+	StringField FieldType = iota
+	IntField
+	FloatField
+	BoolField
+	ObjectIDField
+	TimeField
+)
+
+type FilterField struct {
+	Type FieldType
+	// Operators allowed for the field, only OpEq when empty.
+	Operators  []string
+	Validators []Validator
+}
+
+type QuerySchema struct {
+	Sort    []string
+	Filters map[string]FilterField
+}
+
+var filterParamRegexp = regexp.MustCompile(`^filter\[([A-Za-z0-9_.]+)\](?:\[([a-z]+)\])?$`)
+
+func parseFieldValue(fieldType FieldType, value string) (interface{}, bool) {
+	switch fieldType {
+	case IntField:
+		i, err := strconv.ParseInt(value, 10, 64)
+		return i, err == nil
+	case FloatField:
+		f, err := strconv.ParseFloat(value, 64)
+		return f, err == nil
+	case BoolField:
+		b, err := strconv.ParseBool(value)
+		return b, err == nil
+	case ObjectIDField:
+		if !bson.IsObjectIdHex(value) {
+			return nil, false
+		}
+		return bson.ObjectIdHex(value), true
+	case TimeField:
+		t, err := time.Parse(time.RFC3339, value)
+		return t, err == nil
+	}
+	return value, true
+}
+
+// ParseListQuery parses ?sort=-created_at,name and ?filter[field][op]=value parameters, accepting
+// only the fields and operators allowed by schema.
+func ParseListQuery(r *http.Request, schema QuerySchema) (ListQuery, error) {
+	query := ListQuery{}
+	errs := NewErrorCollector()
+	values := r.URL.Query()
+
+	if value := values.Get("sort"); value != "" {
+		for _, item := range strings.Split(value, ",") {
+			field := SortField{Field: strings.TrimPrefix(item, "-"), Descending: strings.HasPrefix(item, "-")}
+			if !contains(schema.Sort, field.Field) {
+				errs.AddErrors(Error{Key: "sort", Description: fmt.Sprintf("Sorting by %s is not allowed", field.Field),
+					Code: CodeInvalidQueryError, Args: []string{field.Field},
+					Meta: map[string]interface{}{"allowed": schema.Sort}})
+				continue
+			}
+			query.Sort = append(query.Sort, field)
+		}
+	}
+
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		paramValues := values[param]
+		match := filterParamRegexp.FindStringSubmatch(param)
+		if match == nil {
+			continue
+		}
+		name, operator := match[1], match[2]
+		if operator == "" {
+			operator = OpEq
+		}
+		field, ok := schema.Filters[name]
+		if !ok {
+			errs.AddErrors(Error{Key: param, Description: fmt.Sprintf("Filtering by %s is not allowed", name),
+				Code: CodeInvalidQueryError, Args: []string{name}})
+			continue
+		}
+		operators := field.Operators
+		if len(operators) == 0 {
+			operators = []string{OpEq}
+		}
+		if !contains(operators, operator) {
+			errs.AddErrors(Error{Key: param, Description: fmt.Sprintf("Operator %s is not allowed", operator),
+				Code: CodeInvalidQueryError, Args: []string{operator},
+				Meta: map[string]interface{}{"allowed": operators}})
+			continue
+		}
+
+		raw := []string{paramValues[0]}
+		if operator == OpIn {
+			raw = strings.Split(paramValues[0], ",")
+		}
+		parsed := []interface{}{}
+		for _, item := range raw {
+			value, ok := parseFieldValue(field.Type, item)
+			if !ok {
+				errs.AddErrors(Error{Key: param, Description: "Invalid filter value", Code: CodeTypeError, Args: []string{item}})
+				break
+			}
+			if fieldErrs := ValidateValue(value, field.Validators); len(fieldErrs) > 0 {
+				for _, err := range fieldErrs {
+					err.Key = param
+					errs.AddErrors(err)
+				}
+				break
+			}
+			parsed = append(parsed, value)
+		}
+		if len(parsed) != len(raw) {
+			continue
+		}
+		filter := Filter{Field: name, Operator: operator, Value: parsed[0]}
+		if operator == OpIn {
+			filter.Value = parsed
+		}
+		query.Filters = append(query.Filters, filter)
+	}
+
+	return query, errs.Err()
+}
+
+// BSON translates the filters into a Mongo selector.
+func (self ListQuery) BSON() bson.M {
+	selector := bson.M{}
+	for _, filter := range self.Filters {
+		condition, ok := selector[filter.Field].(bson.M)
+		if filter.Operator == OpEq && !ok {
+			selector[filter.Field] = filter.Value
+			continue
+		}
+		if !ok {
+			condition = bson.M{}
+			if value, exists := selector[filter.Field]; exists {
+				condition["$eq"] = value
+			}
+			selector[filter.Field] = condition
+		}
+		condition["$"+filter.Operator] = filter.Value
+	}
+	return selector
+}
+
+// SortFields returns the sort in the "-field" form accepted by mgo's Query.Sort.
+func (self ListQuery) SortFields() []string {
+	fields := make([]string, len(self.Sort))
+	for i, field := range self.Sort {
+		fields[i] = field.Field
+		if field.Descending {
+			fields[i] = "-" + field.Field
+		}
+	}
+	return fields
+}
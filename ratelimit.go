@@ -0,0 +1,187 @@
+package httputils
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+type RateLimiter interface {
+	Allow(key string) (RateLimitResult, error)
+}
+
+// RateLimitResetter is implemented by limiters that can forget a key, such as the failure
+// counts of a user who then logged in.
+type RateLimitResetter interface {
+	Reset(key string) error
+}
+
+type KeyFunc func(r *http.Request) string
+
+// IPKey keys limits by ClientIP, so behind a load balancer RealIPMiddlewareFactory must run first.
+func IPKey(r *http.Request) string {
+	return ClientIP(r)
+}
+
+// HeaderKey keys requests by the value of header, or by ClientIP for requests without it so
+// that they do not all share one bucket.
+func HeaderKey(header string) KeyFunc {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(header); value != "" {
+			return "key:" + value
+		}
+		return "ip:" + ClientIP(r)
+	}
+}
+
+// APIKey is HeaderKey of X-API-Key.
+func APIKey(r *http.Request) string {
+	return HeaderKey("X-API-Key")(r)
+}
+
+func HTTP429() ServerError {
+	return ServerError{429, Errors{[]Error{UndefinedKeyError(CodeTooManyRequests, "Too many requests")}}}
+}
+
+func RateLimitMiddlewareFactory(limiter RateLimiter, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			result, err := limiter.Allow(key(r))
+			if err != nil {
+				LoggerFromContext(r.Context()).Log(ErrorLevel, "rate limiter failed", Fields{"error": err.Error()})
+				next.ServeHTTP(w, r)
+				return
+			}
+			reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("X-RateLimit-Reset", reset)
+			if !result.Allowed {
+				w.Header().Set("Retry-After", reset)
+				HTTP429().Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type MemoryTokenBucket struct {
+	mutex     sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryTokenBucket allows rate requests per second with bursts of up to burst requests.
+func NewMemoryTokenBucket(rate float64, burst int) *MemoryTokenBucket {
+	return &MemoryTokenBucket{rate: rate, burst: burst, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (self *MemoryTokenBucket) Allow(key string) (RateLimitResult, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := time.Now()
+	fill := time.Duration(float64(self.burst) / self.rate * float64(time.Second))
+	if now.Sub(self.lastSweep) > fill {
+		for k, b := range self.buckets {
+			if now.Sub(b.last) > fill {
+				delete(self.buckets, k)
+			}
+		}
+		self.lastSweep = now
+	}
+
+	b, ok := self.buckets[key]
+	if !ok {
+		b = &bucket{float64(self.burst), now}
+		self.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(self.burst), b.tokens+now.Sub(b.last).Seconds()*self.rate)
+	b.last = now
+
+	result := RateLimitResult{Limit: self.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((1 - math.Min(1, b.tokens)) / self.rate * float64(time.Second))
+	return result, nil
+}
+
+func (self *MemoryTokenBucket) Reset(key string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.buckets, key)
+	return nil
+}
+
+type MemorySlidingWindow struct {
+	mutex     sync.Mutex
+	limit     int
+	window    time.Duration
+	requests  map[string][]time.Time
+	lastSweep time.Time
+}
+
+func NewMemorySlidingWindow(limit int, window time.Duration) *MemorySlidingWindow {
+	return &MemorySlidingWindow{limit: limit, window: window, requests: make(map[string][]time.Time), lastSweep: time.Now()}
+}
+
+func (self *MemorySlidingWindow) Allow(key string) (RateLimitResult, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(self.lastSweep) > self.window {
+		for k, times := range self.requests {
+			if len(times) == 0 || now.Sub(times[len(times)-1]) > self.window {
+				delete(self.requests, k)
+			}
+		}
+		self.lastSweep = now
+	}
+
+	times := self.requests[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > self.window {
+		i++
+	}
+	times = times[i:]
+
+	result := RateLimitResult{Limit: self.limit}
+	if len(times) < self.limit {
+		times = append(times, now)
+		result.Allowed = true
+	}
+	self.requests[key] = times
+	result.Remaining = self.limit - len(times)
+	if len(times) > 0 {
+		result.Reset = self.window - now.Sub(times[0])
+	}
+	return result, nil
+}
+
+func (self *MemorySlidingWindow) Reset(key string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.requests, key)
+	return nil
+}
@@ -0,0 +1,110 @@
+package httputils
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"math"
+	"strconv"
+	"time"
+)
+
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1]) or burst
+local ts = tonumber(data[2]) or now
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, math.floor(tokens * 1000)}
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], 0, now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], window)
+local reset = window
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`)
+
+type RedisTokenBucket struct {
+	client redis.UniversalClient
+	prefix string
+	rate   float64
+	burst  int
+}
+
+func NewRedisTokenBucket(client redis.UniversalClient, prefix string, rate float64, burst int) *RedisTokenBucket {
+	return &RedisTokenBucket{client, prefix, rate, burst}
+}
+
+func (self *RedisTokenBucket) Allow(key string) (RateLimitResult, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	values, err := tokenBucketScript.Run(context.Background(), self.client, []string{self.prefix + key},
+		self.rate, self.burst, now).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	tokens := float64(values[1]) / 1000
+	return RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     self.burst,
+		Remaining: int(tokens),
+		Reset:     time.Duration((1 - math.Min(1, tokens)) / self.rate * float64(time.Second)),
+	}, nil
+}
+
+func (self *RedisTokenBucket) Reset(key string) error {
+	return self.client.Del(context.Background(), self.prefix+key).Err()
+}
+
+type RedisSlidingWindow struct {
+	client redis.UniversalClient
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+func NewRedisSlidingWindow(client redis.UniversalClient, prefix string, limit int, window time.Duration) *RedisSlidingWindow {
+	return &RedisSlidingWindow{client, prefix, limit, window}
+}
+
+func (self *RedisSlidingWindow) Allow(key string) (RateLimitResult, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	member := strconv.FormatInt(now, 10) + "-" + SecureHex(8)
+	values, err := slidingWindowScript.Run(context.Background(), self.client, []string{self.prefix + key},
+		self.limit, self.window.Milliseconds(), now, member).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     self.limit,
+		Remaining: int(values[1]),
+		Reset:     time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+func (self *RedisSlidingWindow) Reset(key string) error {
+	return self.client.Del(context.Background(), self.prefix+key).Err()
+}
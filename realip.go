@@ -0,0 +1,129 @@
+package httputils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ClientIPKey).(string)
+	return ip
+}
+
+// ClientIP returns the address resolved by RealIPMiddlewareFactory, falling back to the
+// connection's peer address.
+func ClientIP(r *http.Request) string {
+	if ip := ClientIPFromContext(r.Context()); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ParseCIDRs parses networks such as "10.0.0.0/8"; bare addresses are taken as single hosts.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RealIPMiddlewareFactory resolves the client address from the Forwarded, X-Forwarded-For or
+// X-Real-IP headers, in that order, but only when the peer is one of the trusted proxies given
+// as CIDRs. Forwarding chains are read from the right, skipping trusted hops, so a client cannot
+// spoof its address by sending the headers itself. The result is read with ClientIP and used by
+// IPKey and the logging middleware, which must therefore run inside this one. It panics on an
+// invalid CIDR.
+func RealIPMiddlewareFactory(trustedProxies ...string) func(http.Handler) http.Handler {
+	trusted, err := ParseCIDRs(trustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			peer := ClientIP(r)
+			ip := peer
+			if containsIP(trusted, peer) {
+				if forwarded := forwardedChain(r); len(forwarded) > 0 {
+					ip = forwarded[0]
+					for i := len(forwarded) - 1; i >= 0; i-- {
+						if !containsIP(trusted, forwarded[i]) {
+							ip = forwarded[i]
+							break
+						}
+					}
+				}
+			}
+			next.ServeHTTP(w, SetInContext(ip, ClientIPKey, r))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// forwardedChain lists the addresses recorded by proxies, client first. Entries that are not IP
+// addresses, such as obfuscated identifiers, are dropped.
+func forwardedChain(r *http.Request) []string {
+	var chain []string
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+					chain = appendIP(chain, pair[4:])
+				}
+			}
+		}
+		return chain
+	}
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, value := range strings.Split(strings.Join(values, ","), ",") {
+			chain = appendIP(chain, value)
+		}
+		return chain
+	}
+	return appendIP(chain, r.Header.Get("X-Real-IP"))
+}
+
+func appendIP(chain []string, value string) []string {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.Trim(value, "[]")
+	if net.ParseIP(value) == nil {
+		return chain
+	}
+	return append(chain, value)
+}
@@ -0,0 +1,74 @@
+package httputils
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ResponseRecorder tracks the status code and body size written through it while passing
+// everything to the wrapped writer.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	Status  int
+	Size    int
+	written bool
+}
+
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	if recorder, ok := w.(*ResponseRecorder); ok {
+		return recorder
+	}
+	return &ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (self *ResponseRecorder) WriteHeader(code int) {
+	if self.written {
+		return
+	}
+	self.Status = code
+	self.written = true
+	self.ResponseWriter.WriteHeader(code)
+}
+
+func (self *ResponseRecorder) Write(data []byte) (int, error) {
+	if !self.written {
+		self.WriteHeader(http.StatusOK)
+	}
+	n, err := self.ResponseWriter.Write(data)
+	self.Size += n
+	return n, err
+}
+
+func (self *ResponseRecorder) Written() bool {
+	return self.written
+}
+
+func (self *ResponseRecorder) Flush() {
+	if flusher, ok := self.ResponseWriter.(http.Flusher); ok {
+		self.written = true
+		flusher.Flush()
+	}
+}
+
+func (self *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := self.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("httputils: underlying ResponseWriter does not support hijacking")
+	}
+	self.written = true
+	return hijacker.Hijack()
+}
+
+func (self *ResponseRecorder) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := self.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+func (self *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
@@ -0,0 +1,59 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+)
+
+type PanicReporter func(ctx context.Context, err interface{}, stack []byte)
+
+type RecoverConfig struct {
+	Logger Logger
+	// Production hides the panic value from the client and only reports it through Logger and Reporters.
+	Production bool
+	Reporters  []PanicReporter
+}
+
+func RecoverMiddlewareFactory(config RecoverConfig) func(http.Handler) http.Handler {
+	if config.Logger == nil {
+		config.Logger = DefaultLogger
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			recorder := NewResponseRecorder(w)
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				stack := debug.Stack()
+				config.Logger.Log(ErrorLevel, "panic", Fields{
+					"error":      redactedArg(err),
+					"stack":      string(stack),
+					"method":     r.Method,
+					"path":       DefaultRedaction.URL(r.URL),
+					"request_id": GetRequestID(r),
+				})
+				for _, reporter := range config.Reporters {
+					reporter(r.Context(), err, stack)
+				}
+				if recorder.Written() {
+					return
+				}
+				if config.Production {
+					raise500(recorder, nil)
+				} else {
+					raise500(recorder, err)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,183 @@
+package httputils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var RedactedValue = "[REDACTED]"
+
+// Redaction decides which values must never reach logs, audit entries or error payloads: those
+// under field names matching Fields, and card numbers and bearer tokens inside any string.
+type Redaction struct {
+	Fields []*regexp.Regexp
+}
+
+// NewRedaction builds a Redaction from regular expressions matched case-insensitively against
+// field names, so "token" covers access_token and refresh_token as well.
+func NewRedaction(patterns ...string) *Redaction {
+	redaction := &Redaction{}
+	for _, pattern := range patterns {
+		redaction.Fields = append(redaction.Fields, regexp.MustCompile("(?i)"+pattern))
+	}
+	return redaction
+}
+
+// DefaultRedaction is applied by the logging and recover middlewares, the audit log and 500
+// responses. Add to it with With or replace it at startup.
+var DefaultRedaction = NewRedaction("passw(or)?d", "secret", "token", `api[_-]?key`, "authorization",
+	"cookie", `card[_-]?(number|no)`, "cvv", "cvc", "ssn")
+
+// With returns a copy of the Redaction that also redacts the exact field names given, alone or
+// ending a dotted path.
+func (self *Redaction) With(fields ...string) *Redaction {
+	redaction := &Redaction{Fields: append([]*regexp.Regexp{}, self.Fields...)}
+	for _, field := range fields {
+		redaction.Fields = append(redaction.Fields, regexp.MustCompile(`(?i)(^|\.)`+regexp.QuoteMeta(field)+"$"))
+	}
+	return redaction
+}
+
+// Field reports whether values under name are redacted.
+func (self *Redaction) Field(name string) bool {
+	for _, pattern := range self.Fields {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// Card numbers are 13 to 16 digits in a row, or written in groups: 4-4-4-4 up to 19 digits,
+	// or 4-6-5. Longer runs of digits, such as nanosecond timestamps, are left alone.
+	cardNumberRegexp  = regexp.MustCompile(`\b(?:\d{13,16}|\d{4}[ -]\d{4}[ -]\d{4}[ -]\d{1,7}|\d{4}[ -]\d{6}[ -]\d{5})\b`)
+	bearerTokenRegexp = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)
+)
+
+func luhn(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// String replaces card numbers and bearer tokens found in value.
+func (self *Redaction) String(value string) string {
+	value = bearerTokenRegexp.ReplaceAllString(value, "Bearer "+RedactedValue)
+	return cardNumberRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		digits := strings.NewReplacer(" ", "", "-", "").Replace(match)
+		if luhn(digits) {
+			return RedactedValue
+		}
+		return match
+	})
+}
+
+var (
+	jsonPairRegexp  = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[^\s,}\]]+)`)
+	fieldPairRegexp = regexp.MustCompile(`([\w.\-\[\]]+)(=|:[ \t]*)([^&\s;,"\]]*)`)
+)
+
+// Text redacts the values of redacted fields written in value as JSON "key": value pairs, as
+// key=value pairs or as the key:value pairs of formatted Go maps, then scrubs it with String. It
+// is meant for text that could not be parsed, such as truncated bodies and error messages.
+func (self *Redaction) Text(value string) string {
+	value = jsonPairRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		parts := jsonPairRegexp.FindStringSubmatch(match)
+		if !self.Field(parts[1]) {
+			return match
+		}
+		return `"` + parts[1] + `"` + parts[2] + `"` + RedactedValue + `"`
+	})
+	value = fieldPairRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		parts := fieldPairRegexp.FindStringSubmatch(match)
+		if !self.Field(parts[1]) || parts[3] == "" {
+			return match
+		}
+		return parts[1] + parts[2] + RedactedValue
+	})
+	return self.String(value)
+}
+
+// Value returns a copy of value with redacted fields replaced at any depth of maps and slices
+// and strings scrubbed with String.
+func (self *Redaction) Value(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			if self.Field(key) {
+				redacted[key] = RedactedValue
+			} else {
+				redacted[key] = self.Value(item)
+			}
+		}
+		return redacted
+	case Fields:
+		return Fields(self.Value(map[string]interface{}(typed)).(map[string]interface{}))
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for i, item := range typed {
+			redacted[i] = self.Value(item)
+		}
+		return redacted
+	case string:
+		return self.String(typed)
+	case error:
+		return self.String(typed.Error())
+	}
+	return value
+}
+
+// URL formats u with the values of redacted query parameters replaced.
+func (self *Redaction) URL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return self.String(u.String())
+	}
+	query := u.Query()
+	for key := range query {
+		if self.Field(key) {
+			query[key] = []string{RedactedValue}
+		}
+	}
+	clone := *u
+	clone.RawQuery = query.Encode()
+	return self.String(clone.String())
+}
+
+type redactingLogger struct {
+	logger    Logger
+	redaction *Redaction
+}
+
+func (self redactingLogger) Log(level Level, message string, fields Fields) {
+	if fields != nil {
+		fields = self.redaction.Value(fields).(Fields)
+	}
+	self.logger.Log(level, message, fields)
+}
+
+// RedactingLogger returns a logger that redacts fields with redaction before passing them on.
+func RedactingLogger(logger Logger, redaction *Redaction) Logger {
+	if _, ok := logger.(redactingLogger); ok {
+		return logger
+	}
+	return redactingLogger{logger, redaction}
+}
+
+func redactedArg(err interface{}) string {
+	return DefaultRedaction.Text(fmt.Sprintf("%v", err))
+}
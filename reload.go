@@ -0,0 +1,149 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ConfigWatcher keeps the current Config of a file and the environment, reloading it when the
+// file changes or the process receives SIGHUP.
+type ConfigWatcher struct {
+	// Interval is how often the file's modification time is checked, 5 seconds by default.
+	Interval  time.Duration
+	path      string
+	envPrefix string
+	value     atomic.Value
+	modTime   time.Time
+	mutex     sync.Mutex
+	listeners []func(config Config) (func(), error)
+}
+
+// NewConfigWatcher loads the config like LoadConfig, or from the environment alone when path is
+// empty.
+func NewConfigWatcher(path string, envPrefix string) (*ConfigWatcher, error) {
+	watcher := &ConfigWatcher{Interval: 5 * time.Second, path: path, envPrefix: envPrefix}
+	config, err := watcher.load()
+	if err != nil {
+		return nil, err
+	}
+	watcher.value.Store(config)
+	return watcher, nil
+}
+
+func (self *ConfigWatcher) load() (Config, error) {
+	if self.path == "" {
+		var config Config
+		return config, ConfigFromEnv(self.envPrefix, &config)
+	}
+	if info, err := os.Stat(self.path); err == nil {
+		self.modTime = info.ModTime()
+	}
+	return LoadConfig(self.path, self.envPrefix)
+}
+
+// Config returns the current config.
+func (self *ConfigWatcher) Config() Config {
+	return self.value.Load().(Config)
+}
+
+// OnChange registers fn to be called with every reloaded config. fn prepares what depends on the
+// config without using it yet and returns apply, which swaps it in. A reload is rejected and the
+// previous config kept when any fn fails; otherwise every apply runs.
+func (self *ConfigWatcher) OnChange(fn func(config Config) (apply func(), err error)) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.listeners = append(self.listeners, fn)
+}
+
+// Reload reads the config again and swaps it in.
+func (self *ConfigWatcher) Reload() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	config, err := self.load()
+	if err != nil {
+		return err
+	}
+	applies := make([]func(), 0, len(self.listeners))
+	for _, listener := range self.listeners {
+		apply, err := listener(config)
+		if err != nil {
+			return err
+		}
+		applies = append(applies, apply)
+	}
+	for _, apply := range applies {
+		apply()
+	}
+	self.value.Store(config)
+	return nil
+}
+
+// changed reports whether the file was modified since it was last loaded.
+func (self *ConfigWatcher) changed() bool {
+	info, err := os.Stat(self.path)
+	if err != nil {
+		return false
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return !info.ModTime().Equal(self.modTime)
+}
+
+// Watch reloads the config until ctx is done. Failed reloads are logged and keep the previous
+// config.
+func (self *ConfigWatcher) Watch(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	ticker := time.NewTicker(self.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		case <-ticker.C:
+			if self.path == "" || !self.changed() {
+				continue
+			}
+		}
+		if err := self.Reload(); err != nil {
+			DefaultLogger.Log(ErrorLevel, "config reload failed", Fields{"error": err.Error()})
+			continue
+		}
+		DefaultLogger.Log(InfoLevel, "config reloaded", nil)
+	}
+}
+
+// Middleware applies the stack of BuildMiddlewares for the current config, rebuilding it on
+// every reload so rate limits, log level, CORS origins and maintenance mode change without a
+// restart. Rate limit counters start over when the stack is rebuilt.
+func (self *ConfigWatcher) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		var current atomic.Value
+		build := func(config Config) (func(), error) {
+			mw, err := BuildMiddlewares(config)
+			if err != nil {
+				return nil, err
+			}
+			return func() { current.Store(mw(next)) }, nil
+		}
+		apply, err := build(self.Config())
+		if err != nil {
+			panic(err)
+		}
+		apply()
+		self.OnChange(build)
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			current.Load().(http.Handler).ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
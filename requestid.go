@@ -0,0 +1,40 @@
+package httputils
+
+import (
+	"net/http"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+func NewRequestID() string {
+	return SecureHex(16)
+}
+
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func GetRequestID(r *http.Request) string {
+	return RequestIDFromContext(r.Context())
+}
+
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, SetInContext(id, RequestIDKey, r))
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,199 @@
+package httputils
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type ResourceLister interface {
+	List(r *http.Request, pagination Pagination) (Page, error)
+}
+
+type ResourceGetter interface {
+	Get(r *http.Request, id interface{}) (interface{}, error)
+}
+
+type ResourceCreator interface {
+	CreateVMap() VMap
+	Create(r *http.Request, body map[string]interface{}) (interface{}, error)
+}
+
+type ResourceUpdater interface {
+	UpdateVMap() VMap
+	Update(r *http.Request, id interface{}, body map[string]interface{}) (interface{}, error)
+}
+
+// ResourceCreateChecker adds checks, such as UniqueValidator, that run once CreateVMap passes.
+type ResourceCreateChecker interface {
+	CreateCVMap() CVMap
+}
+
+type ResourceUpdateChecker interface {
+	UpdateCVMap() CVMap
+}
+
+type ResourceDeleter interface {
+	Delete(r *http.Request, id interface{}) error
+}
+
+type ResourcePaginator interface {
+	PaginationConfig() PaginationConfig
+}
+
+// partialVMap keeps only the validators of keys present in body, for PATCH requests.
+func partialVMap(validatorMap VMap, body map[string]interface{}) VMap {
+	partial := VMap{}
+	for key, validators := range validatorMap {
+		if _, ok := body[key]; ok {
+			partial[key] = validators
+		}
+	}
+	return partial
+}
+
+// Resource registers the CRUD routes for whichever of the Resource* interfaces controller
+// implements: GET path, POST path, GET path/:id, PUT and PATCH path/:id and DELETE path/:id.
+// PATCH only validates the keys present in the body, unless it is a JSON Patch or Merge Patch and
+// controller is a ResourceGetter: the patch is then applied to the current item, the whole result
+// is validated and the keys of UpdateVMap it changed are passed to Update. With DryRun, writes
+// stop once their validation, and the lookup of the item when controller is a ResourceGetter,
+// passed.
+func (self *Router) Resource(path string, controller interface{}, mws ...func(http.Handler) http.Handler) {
+	registered := false
+	item := joinPath(path, "/:id")
+
+	if lister, ok := controller.(ResourceLister); ok {
+		config := DefaultPaginationConfig
+		if paginator, ok := controller.(ResourcePaginator); ok {
+			config = paginator.PaginationConfig()
+		}
+		self.Get(path, ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+			pagination, err := GetPagination(r, config)
+			if err != nil {
+				return err
+			}
+			page, err := lister.List(r, pagination)
+			if err != nil {
+				return err
+			}
+			WriteLinkedPage(w, r, page, nil)
+			return nil
+		}), mws...)
+		registered = true
+	}
+
+	if getter, ok := controller.(ResourceGetter); ok {
+		self.Get(item, ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+			id, err := ParamID(r, "id")
+			if err != nil {
+				return err
+			}
+			response, err := getter.Get(r, id)
+			WriteResponseOrError(w, http.StatusOK, response, err)
+			return nil
+		}), mws...)
+		registered = true
+	}
+
+	if creator, ok := controller.(ResourceCreator); ok {
+		self.Post(path, dryRunHandler{ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+			body, err := GetValidatedBody(r, creator.CreateVMap())
+			if err != nil {
+				return err
+			}
+			if checker, ok := controller.(ResourceCreateChecker); ok {
+				if err := ValidateBodyContext(r.Context(), body, checker.CreateCVMap()); err != nil {
+					return err
+				}
+			}
+			if DryRunFromContext(r.Context()) {
+				writeDryRunValid(w)
+				return nil
+			}
+			response, err := creator.Create(r, body)
+			WriteResponseOrError(w, http.StatusCreated, response, err)
+			return nil
+		})}, mws...)
+		registered = true
+	}
+
+	if updater, ok := controller.(ResourceUpdater); ok {
+		update := func(partial bool) http.Handler {
+			return dryRunHandler{ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+				id, err := ParamID(r, "id")
+				if err != nil {
+					return err
+				}
+				var body map[string]interface{}
+				if getter, ok := controller.(ResourceGetter); ok && partial && IsPatchRequest(r) {
+					current, err := getter.Get(r, id)
+					if err != nil {
+						return err
+					}
+					if body, err = GetPatchedBody(r, current, updater.UpdateVMap()); err != nil {
+						return err
+					}
+				} else {
+					if body, err = GetBody(r); err != nil {
+						return err
+					}
+					validatorMap := updater.UpdateVMap()
+					if partial {
+						validatorMap = partialVMap(validatorMap, body)
+					}
+					if body, err = ValidateBody(body, validatorMap); err != nil {
+						return err
+					}
+				}
+				if checker, ok := controller.(ResourceUpdateChecker); ok {
+					if err := ValidateBodyContext(r.Context(), body, checker.UpdateCVMap()); err != nil {
+						return err
+					}
+				}
+				if DryRunFromContext(r.Context()) {
+					if getter, ok := controller.(ResourceGetter); ok && !(partial && IsPatchRequest(r)) {
+						if _, err := getter.Get(r, id); err != nil {
+							return err
+						}
+					}
+					writeDryRunValid(w)
+					return nil
+				}
+				response, err := updater.Update(r, id, body)
+				WriteResponseOrError(w, http.StatusOK, response, err)
+				return nil
+			})}
+		}
+		self.Put(item, update(false), mws...)
+		self.Patch(item, update(true), mws...)
+		registered = true
+	}
+
+	if deleter, ok := controller.(ResourceDeleter); ok {
+		self.Delete(item, dryRunHandler{ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+			id, err := ParamID(r, "id")
+			if err != nil {
+				return err
+			}
+			if DryRunFromContext(r.Context()) {
+				if getter, ok := controller.(ResourceGetter); ok {
+					if _, err := getter.Get(r, id); err != nil {
+						return err
+					}
+				}
+				writeDryRunValid(w)
+				return nil
+			}
+			if err := deleter.Delete(r, id); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		})}, mws...)
+		registered = true
+	}
+
+	if !registered {
+		panic(fmt.Sprintf("httputils: %T implements none of the resource interfaces", controller))
+	}
+}
@@ -0,0 +1,155 @@
+package httputils
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// PrettyQueryParam names the query parameter that makes WriteJSON indent its output, for
+// reading responses in a browser or with curl.
+var PrettyQueryParam = "pretty"
+
+var ErrResponseWritten = errors.New("httputils: response was already written")
+
+// ResponseWritten reports whether a status was already sent through w, looking through
+// wrapping writers for one that tracks it such as ResponseRecorder. Writers that do not track
+// it are reported as unwritten.
+func ResponseWritten(w http.ResponseWriter) bool {
+	for w != nil {
+		if tracker, ok := w.(interface{ Written() bool }); ok {
+			return tracker.Written()
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = unwrapper.Unwrap()
+	}
+	return false
+}
+
+// WriteJSON writes value with status code, returning instead of panicking when value cannot be
+// encoded, in which case nothing is written. It writes nothing either when the client has gone
+// away or a response was already started, and returns the error of the write itself. The
+// output is indented when the request has ?pretty=1.
+func WriteJSON(w http.ResponseWriter, r *http.Request, value interface{}, code int) error {
+	if err := r.Context().Err(); err != nil {
+		return err
+	}
+	if ResponseWritten(w) {
+		return ErrResponseWritten
+	}
+	var data []byte
+	var err error
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get(PrettyQueryParam)); pretty {
+		data, err = json.MarshalIndent(value, "", "  ")
+	} else {
+		data, err = json.Marshal(value)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, err = w.Write(data)
+	return err
+}
+
+// JSONIndent writes value indented with two spaces.
+func JSONIndent(w http.ResponseWriter, value interface{}, code int) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		writeMarshalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func writeMarshalError(w http.ResponseWriter, err error) {
+	DefaultLogger.Log(ErrorLevel, "response encoding failed", Fields{"error": err.Error()})
+	raise500(w, nil)
+}
+
+var jsonpCallbackRegexp = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// JSONP writes value as a call to callback, answering 400 when callback is not a plain
+// JavaScript identifier path such as "cb" or "app.handlers.cb".
+func JSONP(w http.ResponseWriter, callback string, value interface{}) {
+	if len(callback) > 128 || !jsonpCallbackRegexp.MatchString(callback) {
+		HTTP400().Write(w)
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		writeMarshalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("/**/" + callback + "("))
+	w.Write(data)
+	w.Write([]byte(");"))
+}
+
+// Blob writes data as is with contentType.
+func Blob(w http.ResponseWriter, contentType string, data []byte, code int) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// Redirect sends the client to url. Codes outside 3xx are replaced with 302 Found.
+func Redirect(w http.ResponseWriter, r *http.Request, url string, code int) {
+	if code < 300 || code > 399 {
+		code = http.StatusFound
+	}
+	http.Redirect(w, r, url, code)
+}
+
+// File serves the file at path with Range and conditional request support. Missing files and
+// directories are answered with a JSON 404.
+func File(w http.ResponseWriter, r *http.Request, path string) {
+	serveLocalFile(w, r, path, "")
+}
+
+// Attachment serves the file at path like File, asking browsers to download it as filename.
+func Attachment(w http.ResponseWriter, r *http.Request, path string, filename string) {
+	serveLocalFile(w, r, path, filename)
+}
+
+func serveLocalFile(w http.ResponseWriter, r *http.Request, path string, filename string) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			HTTP404(filepath.Base(path)).Write(w)
+			return
+		}
+		WriteError(w, Internal(err))
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		WriteError(w, Internal(err))
+		return
+	}
+	if info.IsDir() {
+		HTTP404(filepath.Base(path)).Write(w)
+		return
+	}
+	if filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
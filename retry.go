@@ -0,0 +1,116 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+type RetryPolicy struct {
+	// Attempts is the total number of calls, including the first.
+	Attempts int
+	// Backoff is the wait after the first failure, multiplied by Multiplier after each further
+	// one up to MaxBackoff. Jitter spreads each wait randomly by up to that fraction of it.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+	Jitter     float64
+	// Retryable classifies errors, IsRetryable when nil.
+	Retryable func(err error) bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Backoff:    100 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Delay returns the wait before retry number attempt, counted from 1.
+func (self RetryPolicy) Delay(attempt int) time.Duration {
+	multiplier := self.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	delay := float64(self.Backoff) * math.Pow(multiplier, float64(attempt-1))
+	if self.MaxBackoff > 0 && delay > float64(self.MaxBackoff) {
+		delay = float64(self.MaxBackoff)
+	}
+	if self.Jitter > 0 {
+		delay += delay * self.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (self permanentError) Error() string {
+	return self.err.Error()
+}
+
+func (self permanentError) Unwrap() error {
+	return self.err
+}
+
+// Permanent marks err as not worth retrying; Retry returns err itself.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsRetryable reports whether a call that failed with err may succeed when made again: errors
+// marked Permanent, context errors, open circuits and ServerErrors other than 429, 502, 503 and
+// 504 are not, any other error, such as a connection failure, is.
+func IsRetryable(err error) bool {
+	var permanent permanentError
+	if errors.As(err, &permanent) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var serverError ServerError
+	if errors.As(err, &serverError) {
+		switch serverError.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// Retry calls fn until it succeeds, fails with an error that is not retryable, policy.Attempts
+// calls were made or ctx is done, and returns the last error.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if attempt >= policy.Attempts || !retryable(err) {
+			return err
+		}
+		timer := time.NewTimer(policy.Delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
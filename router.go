@@ -3,32 +3,247 @@ package httputils
 import (
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"strings"
 )
 
 type Router struct {
-	router *httprouter.Router
+	router      *httprouter.Router
+	root        *Router
+	prefix      string
+	middlewares []func(http.Handler) http.Handler
+	handler     http.Handler
+
+	methodNotAllowed    http.Handler
+	names               map[string]string
+	routes              []Route
+	ignoreTrailingSlash bool
+	errorSerializer     ErrorSerializer
+	envelope            Envelope
+}
+
+type RouterOption func(*Router)
+
+// RedirectTrailingSlash toggles the 301/308 redirect from /foo/ to /foo (and back) when only
+// the other form is registered. Enabled by default.
+func RedirectTrailingSlash(enabled bool) RouterOption {
+	return func(router *Router) {
+		router.router.RedirectTrailingSlash = enabled
+	}
+}
+
+// RedirectFixedPath toggles redirecting case-insensitive and uncleaned path matches such as
+// /FOO or /foo/../bar to the registered path. Enabled by default.
+func RedirectFixedPath(enabled bool) RouterOption {
+	return func(router *Router) {
+		router.router.RedirectFixedPath = enabled
+	}
+}
+
+// IgnoreTrailingSlash serves /foo/ with the /foo route (and back) directly instead of redirecting.
+func IgnoreTrailingSlash() RouterOption {
+	return func(router *Router) {
+		router.ignoreTrailingSlash = true
+	}
 }
 
-func (self *Router) Get(path string, handler http.Handler) {
-	self.router.GET(path, wrapHandler(handler))
+// Use adds middlewares in the order given. On the root router they run for every request,
+// including unmatched ones, before any per-route middleware. On a group they wrap the routes
+// registered on it afterwards.
+func (self *Router) Use(mws ...func(http.Handler) http.Handler) {
+	self.middlewares = append(self.middlewares, mws...)
+	if self.root == nil {
+		self.rebuild()
+	}
 }
 
-func (self *Router) Post(path string, handler http.Handler) {
-	self.router.POST(path, wrapHandler(handler))
+func (self *Router) rebuild() {
+	var handler http.Handler = self.router
+	if self.ignoreTrailingSlash {
+		handler = http.HandlerFunc(self.serveIgnoringTrailingSlash)
+	}
+	handler = chain(handler, self.middlewares)
+	if self.envelope != nil {
+		handler = EnvelopeMiddlewareFactory(self.envelope)(handler)
+	}
+	if self.errorSerializer != nil {
+		handler = ErrorSerializerMiddlewareFactory(self.errorSerializer)(handler)
+	}
+	self.handler = handler
 }
 
-func (self *Router) Put(path string, handler http.Handler) {
-	self.router.PUT(path, wrapHandler(handler))
+func (self *Router) serveIgnoringTrailingSlash(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if handle, _, tsr := self.router.Lookup(r.Method, path); handle == nil && tsr {
+		if strings.HasSuffix(path, "/") {
+			path = path[:len(path)-1]
+		} else {
+			path += "/"
+		}
+		u := *r.URL
+		u.Path = path
+		u.RawPath = ""
+		req := new(http.Request)
+		*req = *r
+		req.URL = &u
+		r = req
+	}
+	self.router.ServeHTTP(w, r)
 }
 
-func (self *Router) Delete(path string, handler http.Handler) {
-	self.router.DELETE(path, wrapHandler(handler))
+// Group returns a sub-router whose routes are registered under prefix and wrapped in the
+// middleware stack of the enclosing groups followed by mws.
+func (self *Router) Group(prefix string, mws ...func(http.Handler) http.Handler) *Router {
+	group := &Router{router: self.router, root: self, prefix: joinPath(self.prefix, prefix)}
+	if self.root != nil {
+		group.root = self.root
+		group.middlewares = append(group.middlewares, self.middlewares...)
+	}
+	group.middlewares = append(group.middlewares, mws...)
+	return group
+}
+
+func (self *Router) handle(method string, path string, handler http.Handler, mws []func(http.Handler) http.Handler) {
+	if self.root != nil {
+		mws = append(append([]func(http.Handler) http.Handler{}, self.middlewares...), mws...)
+	}
+	root := self.rootRouter()
+	route := Route{Method: method, Path: joinPath(self.prefix, path)}
+	self.router.Handle(method, route.Path, wrapHandler(describeChain(handler, mws, &route)))
+	root.routes = append(root.routes, route)
+}
+
+func (self *Router) Get(path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodGet, path, handler, mws)
+}
+
+func (self *Router) Post(path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodPost, path, handler, mws)
+}
+
+func (self *Router) Put(path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodPut, path, handler, mws)
+}
+
+func (self *Router) Delete(path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodDelete, path, handler, mws)
+}
+
+func (self *Router) Patch(path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodPatch, path, handler, mws)
+}
+
+func (self *Router) Head(path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodHead, path, handler, mws)
+}
+
+func (self *Router) Options(path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodOptions, path, handler, mws)
+}
+
+func (self *Router) Handle(method string, path string, handler http.Handler, mws ...func(http.Handler) http.Handler) {
+	self.handle(method, path, handler, mws)
+}
+
+func (self *Router) HandleFunc(method string, path string, fn func(http.ResponseWriter, *http.Request), mws ...func(http.Handler) http.Handler) {
+	self.handle(method, path, http.HandlerFunc(fn), mws)
+}
+
+func (self *Router) GetFunc(path string, fn func(http.ResponseWriter, *http.Request), mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodGet, path, http.HandlerFunc(fn), mws)
+}
+
+func (self *Router) PostFunc(path string, fn func(http.ResponseWriter, *http.Request), mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodPost, path, http.HandlerFunc(fn), mws)
+}
+
+func (self *Router) PutFunc(path string, fn func(http.ResponseWriter, *http.Request), mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodPut, path, http.HandlerFunc(fn), mws)
+}
+
+func (self *Router) PatchFunc(path string, fn func(http.ResponseWriter, *http.Request), mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodPatch, path, http.HandlerFunc(fn), mws)
+}
+
+func (self *Router) DeleteFunc(path string, fn func(http.ResponseWriter, *http.Request), mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodDelete, path, http.HandlerFunc(fn), mws)
+}
+
+func (self *Router) SetNotFoundHandler(handler http.Handler) {
+	self.rootRouter().router.NotFound = handler
+}
+
+// SetMethodNotAllowedHandler replaces the JSON 405 response. The Allow header is already set
+// when handler runs.
+func (self *Router) SetMethodNotAllowedHandler(handler http.Handler) {
+	self.rootRouter().methodNotAllowed = handler
+}
+
+func (self *Router) rootRouter() *Router {
+	if self.root != nil {
+		return self.root
+	}
+	return self
+}
+
+// serveMethodNotAllowed answers HEAD requests with the matching GET route, discarding the body.
+func (self *Router) serveMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		if handle, ps, _ := self.router.Lookup(http.MethodGet, r.URL.Path); handle != nil {
+			handle(headResponseWriter{w}, r, ps)
+			return
+		}
+	}
+	self.methodNotAllowed.ServeHTTP(w, r)
+}
+
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (self headResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (self headResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
 }
 
 func (self *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	self.router.ServeHTTP(w, req)
+	if self.root != nil {
+		self.root.ServeHTTP(w, req)
+		return
+	}
+	self.handler.ServeHTTP(w, req)
+}
+
+func joinPath(prefix string, path string) string {
+	if prefix == "" {
+		return path
+	}
+	return strings.TrimSuffix(prefix, "/") + path
 }
 
-func NewRouter() *Router {
-	return &Router{httprouter.New()}
-}
\ No newline at end of file
+// chain wraps handler so that mws run in the order given, the first one outermost.
+func chain(handler http.Handler, mws []func(http.Handler) http.Handler) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return handler
+}
+
+func NewRouter(options ...RouterOption) *Router {
+	router := httprouter.New()
+	self := &Router{router: router}
+	self.methodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HTTP405().Write(w)
+	})
+	router.MethodNotAllowed = http.HandlerFunc(self.serveMethodNotAllowed)
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServerError{404, Errors{[]Error{Error{Key: "undefined", Description: "Route not found", Code: CodeRouteNotFound, Args: []string{r.URL.Path}}}}}.Write(w)
+	})
+	for _, option := range options {
+		option(self)
+	}
+	self.rebuild()
+	return self
+}
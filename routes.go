@@ -0,0 +1,102 @@
+package httputils
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+type Route struct {
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	Name        string              `json:"name,omitempty"`
+	Handler     string              `json:"handler"`
+	Middlewares []string            `json:"middlewares,omitempty"`
+	Validators  map[string][]string `json:"validators,omitempty"`
+	Roles       []string            `json:"roles,omitempty"`
+	Permissions []string            `json:"permissions,omitempty"`
+	Cost        int                 `json:"cost,omitempty"`
+}
+
+// RouteDescriber is implemented by handlers returned from middlewares that want to expose
+// metadata, such as validated keys or required roles, through Router.Routes.
+type RouteDescriber interface {
+	DescribeRoute(route *Route)
+}
+
+type describedHandler struct {
+	http.Handler
+	describe func(route *Route)
+}
+
+func (self describedHandler) DescribeRoute(route *Route) {
+	self.describe(route)
+}
+
+func describe(handler http.Handler, fn func(route *Route)) http.Handler {
+	return describedHandler{handler, fn}
+}
+
+func (self *Route) addValidators(section string, validatorMap VMap) {
+	if self.Validators == nil {
+		self.Validators = make(map[string][]string)
+	}
+	keys := MapKeys(validatorMap)
+	sort.Strings(keys)
+	self.Validators[section] = append(self.Validators[section], keys...)
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+func funcName(fn interface{}) string {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", fn)
+	}
+	name := runtime.FuncForPC(value.Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	return strings.TrimSuffix(closureSuffix.ReplaceAllString(name, ""), "-fm")
+}
+
+func handlerName(handler http.Handler) string {
+	switch h := handler.(type) {
+	case http.HandlerFunc:
+		return funcName((func(http.ResponseWriter, *http.Request))(h))
+	case ErrorHandler:
+		return funcName((func(http.ResponseWriter, *http.Request) error)(h))
+	case dryRunHandler:
+		return handlerName(h.Handler)
+	}
+	return fmt.Sprintf("%T", handler)
+}
+
+// describeChain is chain that also records the route's middlewares and their metadata.
+func describeChain(handler http.Handler, mws []func(http.Handler) http.Handler, route *Route) http.Handler {
+	route.Handler = handlerName(handler)
+	for _, mw := range mws {
+		route.Middlewares = append(route.Middlewares, funcName(mw))
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+		if describer, ok := handler.(RouteDescriber); ok {
+			describer.DescribeRoute(route)
+		}
+	}
+	return handler
+}
+
+// Routes lists the registered routes in registration order.
+func (self *Router) Routes() []Route {
+	return append([]Route{}, self.rootRouter().routes...)
+}
+
+// DebugRoutes registers an endpoint rendering the routing table as JSON. Protect it with mws.
+func (self *Router) DebugRoutes(path string, mws ...func(http.Handler) http.Handler) {
+	self.GetFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		JSON(w, self.Routes(), http.StatusOK)
+	}, mws...)
+}
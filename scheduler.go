@@ -0,0 +1,326 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule computes when a task runs next after t.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+type everySchedule time.Duration
+
+func (self everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(self))
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	anyDOM, anyDOW                bool
+}
+
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a five field cron spec (minute hour day-of-month month day-of-week)
+// supporting *, lists, ranges and steps, the @hourly/@daily/@weekly/@monthly/@yearly aliases
+// and "@every <duration>".
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("httputils: invalid schedule %q", spec)
+		}
+		return everySchedule(d), nil
+	}
+	if alias, ok := cronAliases[spec]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("httputils: schedule %q must have 5 fields", spec)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var bits [5]uint64
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, bounds[i][0], bounds[i][1]); err != nil {
+			return nil, fmt.Errorf("httputils: invalid schedule %q: %v", spec, err)
+		}
+	}
+	// Sunday can be written as 0 or 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{bits[0], bits[1], bits[2], bits[3], bits[4], fields[2] == "*", fields[4] == "*"}, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("bad value in %q", part)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func (self *cronSchedule) dayMatches(t time.Time) bool {
+	dom := self.dom&(1<<uint(t.Day())) != 0
+	dow := self.dow&(1<<uint(t.Weekday())) != 0
+	if self.anyDOM || self.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// later returns next, or t plus step when next is a wall clock time repeated as clocks go back
+// that time.Date resolved to its first occurrence, before t.
+func later(t time.Time, next time.Time, step time.Duration) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(step)
+}
+
+// Next steps through wall clock times of t's location, so zones with offsets that are not whole
+// hours work, hours skipped by DST never match and hours repeated by DST match once.
+func (self *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case self.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !self.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case self.hour&(1<<uint(t.Hour())) == 0:
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()), time.Duration(60-t.Minute())*time.Minute)
+		case self.minute&(1<<uint(t.Minute())) == 0:
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location()), time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type TaskStatus struct {
+	Name      string        `json:"name"`
+	Spec      string        `json:"spec"`
+	LastRun   time.Time     `json:"last_run"`
+	NextRun   time.Time     `json:"next_run"`
+	Duration  time.Duration `json:"duration_ns"`
+	LastError string        `json:"last_error,omitempty"`
+	Runs      int64         `json:"runs"`
+	Failures  int64         `json:"failures"`
+}
+
+type scheduledTask struct {
+	schedule Schedule
+	run      Job
+	status   TaskStatus
+}
+
+// Scheduler runs registered tasks on their schedules. A task does not start again while its
+// previous run is still going.
+type Scheduler struct {
+	Logger  Logger
+	mutex   sync.Mutex
+	tasks   []*scheduledTask
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{Logger: DefaultLogger}
+}
+
+// Add registers task under name with a spec accepted by ParseSchedule. Tasks added after Start
+// are started right away.
+func (self *Scheduler) Add(name string, spec string, task Job) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, existing := range self.tasks {
+		if existing.status.Name == name {
+			return fmt.Errorf("httputils: task %q is already scheduled", name)
+		}
+	}
+	scheduled := &scheduledTask{schedule: schedule, run: task, status: TaskStatus{Name: name, Spec: spec}}
+	self.tasks = append(self.tasks, scheduled)
+	if self.started {
+		self.startTask(self.ctx, scheduled)
+	}
+	return nil
+}
+
+// Start runs the tasks until Stop is called.
+func (self *Scheduler) Start() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.started {
+		return
+	}
+	self.started = true
+	self.ctx, self.cancel = context.WithCancel(context.Background())
+	for _, task := range self.tasks {
+		self.startTask(self.ctx, task)
+	}
+}
+
+func (self *Scheduler) startTask(ctx context.Context, task *scheduledTask) {
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		for {
+			next := task.schedule.Next(time.Now())
+			if next.IsZero() {
+				self.Logger.Log(WarnLevel, "task has no next run", Fields{"task": task.status.Name})
+				return
+			}
+			self.mutex.Lock()
+			task.status.NextRun = next
+			self.mutex.Unlock()
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			self.runTask(ctx, task)
+		}
+	}()
+}
+
+func (self *Scheduler) runTask(ctx context.Context, task *scheduledTask) {
+	t1 := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("panic: %v", recovered)
+				self.Logger.Log(ErrorLevel, "task panicked", Fields{"task": task.status.Name, "stack": string(debug.Stack())})
+			}
+		}()
+		return task.run(ctx)
+	}()
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	task.status.LastRun = t1
+	task.status.Duration = time.Since(t1)
+	task.status.Runs++
+	task.status.LastError = ""
+	if err != nil {
+		task.status.Failures++
+		task.status.LastError = err.Error()
+		self.Logger.Log(ErrorLevel, "task failed", Fields{"task": task.status.Name, "error": err.Error()})
+	}
+}
+
+// Stop cancels the running tasks' context and waits for them to return or ctx to be done. It
+// can be registered with Server.Drain.
+func (self *Scheduler) Stop(ctx context.Context) error {
+	self.mutex.Lock()
+	if self.started {
+		self.started = false
+		self.cancel()
+	}
+	self.mutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		self.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (self *Scheduler) Status() []TaskStatus {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	statuses := make([]TaskStatus, len(self.tasks))
+	for i, task := range self.tasks {
+		statuses[i] = task.status
+	}
+	return statuses
+}
+
+// Checker fails while the last run of any task failed, for use with Router.Health.
+func (self *Scheduler) Checker() Checker {
+	return NewChecker("scheduler", func(ctx context.Context) error {
+		var failed []string
+		for _, status := range self.Status() {
+			if status.LastError != "" {
+				failed = append(failed, status.Name+": "+status.LastError)
+			}
+		}
+		if len(failed) > 0 {
+			return errors.New(strings.Join(failed, "; "))
+		}
+		return nil
+	})
+}
+
+// StatusHandler reports the Status of every task as JSON.
+func (self *Scheduler) StatusHandler() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		JSON(w, self.Status(), http.StatusOK)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,61 @@
+package httputils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	cases := []struct {
+		zone string
+		spec string
+		from string
+		want string
+	}{
+		// Offsets that are not whole hours.
+		{"Asia/Kolkata", "0 11 * * *", "2024-03-10 10:15", "2024-03-10 11:00"},
+		{"Asia/Kathmandu", "0 * * * *", "2024-03-10 10:15", "2024-03-10 11:00"},
+		{"America/St_Johns", "30 9 * * *", "2024-06-01 08:45", "2024-06-01 09:30"},
+		{"Australia/Adelaide", "0 0 * * *", "2024-06-01 23:15", "2024-06-02 00:00"},
+		// Clocks go forward at 2:00: the skipped hour never matches.
+		{"America/New_York", "30 2 * * *", "2024-03-10 01:00", "2024-03-11 02:30"},
+		{"America/New_York", "0 3 * * *", "2024-03-10 01:00", "2024-03-10 03:00"},
+		// Clocks go back at 2:00: the repeated hour matches once.
+		{"America/New_York", "30 1 * * *", "2024-11-03 00:45", "2024-11-03 01:30"},
+		{"America/New_York", "0 2 * * *", "2024-11-03 00:45", "2024-11-03 02:00"},
+		{"Australia/Adelaide", "0 * * * *", "2024-04-07 02:10", "2024-04-07 03:00"},
+	}
+	for _, c := range cases {
+		location, err := time.LoadLocation(c.zone)
+		if err != nil {
+			t.Skipf("no zone data: %v", err)
+		}
+		schedule, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, _ := time.ParseInLocation("2006-01-02 15:04", c.from, location)
+		want, _ := time.ParseInLocation("2006-01-02 15:04", c.want, location)
+		if got := schedule.Next(from); !got.Equal(want) {
+			t.Errorf("%s %q from %s: got %s, want %s", c.zone, c.spec, c.from, got, want)
+		}
+	}
+}
+
+func TestCronScheduleRunsOnceInRepeatedHour(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zone data: %v", err)
+	}
+	schedule, _ := ParseSchedule("30 1 * * *")
+	first := schedule.Next(time.Date(2024, 11, 3, 0, 45, 0, 0, location))
+	second := schedule.Next(first)
+	if want := first.Add(24*time.Hour + time.Hour); !second.Equal(want) {
+		t.Errorf("after %s got %s, want %s", first, second, want)
+	}
+	// Started during the second pass of the hour, the task still waits for the wall clock time.
+	repeated := first.Add(time.Hour - 20*time.Minute)
+	if got := schedule.Next(repeated); !got.Equal(first.Add(time.Hour)) {
+		t.Errorf("from %s got %s, want %s", repeated, got, first.Add(time.Hour))
+	}
+}
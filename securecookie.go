@@ -0,0 +1,101 @@
+package httputils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidCookie = errors.New("httputils: cookie value is invalid")
+	ErrExpiredCookie = errors.New("httputils: cookie value has expired")
+)
+
+// SecureCookie encodes values for cookies. They are always authenticated with HMAC-SHA256 and,
+// when a block key is given, encrypted with AES-CTR first. The cookie name and the time of
+// encoding are covered by the MAC so values cannot be moved between cookies or replayed past
+// their max age.
+type SecureCookie struct {
+	hashKey []byte
+	block   cipher.Block
+}
+
+// NewSecureCookie takes a hash key of at least 32 bytes and an optional AES block key of 16,
+// 24 or 32 bytes.
+func NewSecureCookie(hashKey []byte, blockKey []byte) (*SecureCookie, error) {
+	if len(hashKey) < 32 {
+		return nil, errors.New("httputils: hash key must be at least 32 bytes")
+	}
+	codec := &SecureCookie{hashKey: hashKey}
+	if blockKey != nil {
+		block, err := aes.NewCipher(blockKey)
+		if err != nil {
+			return nil, err
+		}
+		codec.block = block
+	}
+	return codec, nil
+}
+
+func (self *SecureCookie) mac(name string, data []byte) []byte {
+	mac := hmac.New(sha256.New, self.hashKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Encode serializes value as JSON and returns the cookie value for name.
+func (self *SecureCookie) Encode(name string, value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	if self.block != nil {
+		iv := make([]byte, self.block.BlockSize())
+		if _, err := rand.Read(iv); err != nil {
+			return "", err
+		}
+		cipher.NewCTR(self.block, iv).XORKeyStream(data, data)
+		data = append(iv, data...)
+	}
+	payload := make([]byte, 8, 8+len(data)+sha256.Size)
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().Unix()))
+	payload = append(payload, data...)
+	payload = append(payload, self.mac(name, payload)...)
+	return base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+// Decode verifies a value produced by Encode for name and unmarshals it into dst. Values older
+// than maxAge are rejected unless maxAge is zero.
+func (self *SecureCookie) Decode(name string, encoded string, dst interface{}, maxAge time.Duration) error {
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(payload) < 8+sha256.Size {
+		return ErrInvalidCookie
+	}
+	split := len(payload) - sha256.Size
+	if !hmac.Equal(payload[split:], self.mac(name, payload[:split])) {
+		return ErrInvalidCookie
+	}
+	created := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	if maxAge > 0 && time.Since(created) > maxAge {
+		return ErrExpiredCookie
+	}
+	data := append([]byte(nil), payload[8:split]...)
+	if self.block != nil {
+		size := self.block.BlockSize()
+		if len(data) < size {
+			return ErrInvalidCookie
+		}
+		cipher.NewCTR(self.block, data[:size]).XORKeyStream(data[size:], data[size:])
+		data = data[size:]
+	}
+	return json.Unmarshal(data, dst)
+}
@@ -0,0 +1,153 @@
+package httputils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type Server struct {
+	HTTPServer  *http.Server
+	GracePeriod time.Duration
+	CertFile    string
+	KeyFile     string
+	Logger      Logger
+	// HookTimeout bounds each OnStart and OnShutdown hook.
+	HookTimeout   time.Duration
+	stop          chan struct{}
+	startHooks    []serverHook
+	shutdownHooks []serverHook
+}
+
+type serverHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func NewServer(addr string, handler http.Handler) *Server {
+	return &Server{
+		HTTPServer: &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		GracePeriod: 15 * time.Second,
+		HookTimeout: 10 * time.Second,
+		Logger:      DefaultLogger,
+		stop:        make(chan struct{}, 1),
+	}
+}
+
+// ListenAndServe starts serving and blocks until SIGINT/SIGTERM or Stop, then drains open
+// connections for up to GracePeriod. Errors binding the address are returned immediately.
+func (self *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", self.HTTPServer.Addr)
+	if err != nil {
+		return err
+	}
+	return self.Serve(listener)
+}
+
+// Serve runs the OnStart hooks, then serves on listener like ListenAndServe. When a start hook
+// fails the server does not start; the OnShutdown hooks run and the error is returned. They also
+// run when serving fails, for example on a bad certificate.
+func (self *Server) Serve(listener net.Listener) error {
+	for _, hook := range self.startHooks {
+		if err := self.runHook("start", hook); err != nil {
+			listener.Close()
+			self.runShutdownHooks()
+			return err
+		}
+	}
+	errs := make(chan error, 1)
+	go func() {
+		var err error
+		if self.CertFile != "" || self.KeyFile != "" {
+			err = self.HTTPServer.ServeTLS(listener, self.CertFile, self.KeyFile)
+		} else {
+			err = self.HTTPServer.Serve(listener)
+		}
+		errs <- err
+	}()
+	self.Logger.Log(InfoLevel, "server started", Fields{"addr": listener.Addr().String()})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		self.runShutdownHooks()
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	case sig := <-signals:
+		self.Logger.Log(InfoLevel, "shutting down", Fields{"signal": sig.String()})
+	case <-self.stop:
+		self.Logger.Log(InfoLevel, "shutting down", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), self.GracePeriod)
+	defer cancel()
+	err := self.HTTPServer.Shutdown(ctx)
+	if err != nil {
+		self.HTTPServer.Close()
+	}
+	self.runShutdownHooks()
+	if err != nil {
+		return err
+	}
+	self.Logger.Log(InfoLevel, "server stopped", nil)
+	return nil
+}
+
+func (self *Server) runHook(stage string, hook serverHook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), self.HookTimeout)
+	defer cancel()
+	t1 := time.Now()
+	err := hook.fn(ctx)
+	fields := Fields{"hook": hook.name, "stage": stage, "duration": time.Since(t1).String()}
+	if err != nil {
+		fields["error"] = err.Error()
+		self.Logger.Log(ErrorLevel, "server hook failed", fields)
+		return err
+	}
+	self.Logger.Log(DebugLevel, "server hook done", fields)
+	return nil
+}
+
+func (self *Server) runShutdownHooks() {
+	for _, hook := range self.shutdownHooks {
+		self.runHook("shutdown", hook)
+	}
+}
+
+// OnStart registers fn to run before the server accepts connections, such as connecting to a
+// database or warming caches. Hooks run in registration order.
+func (self *Server) OnStart(name string, fn func(ctx context.Context) error) {
+	self.startHooks = append(self.startHooks, serverHook{name, fn})
+}
+
+// OnShutdown registers fn to run once open connections are drained, such as closing database
+// pools or stopping job workers. Hooks run in registration order and a failing hook does not
+// stop the following ones.
+func (self *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	self.shutdownHooks = append(self.shutdownHooks, serverHook{name, fn})
+}
+
+// Drain registers fn as an OnShutdown hook, such as JobRunner.Drain.
+func (self *Server) Drain(fn func(ctx context.Context) error) {
+	self.OnShutdown("drain", fn)
+}
+
+func (self *Server) Stop() {
+	select {
+	case self.stop <- struct{}{}:
+	default:
+	}
+}
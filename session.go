@@ -0,0 +1,323 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Session holds the values of one browser session. Changes are saved when the response starts.
+type Session struct {
+	ID        string
+	Values    map[string]interface{}
+	IsNew     bool
+	modified  bool
+	destroyed bool
+	previous  string
+}
+
+func (self *Session) Get(key string) interface{} {
+	return self.Values[key]
+}
+
+func (self *Session) Set(key string, value interface{}) {
+	self.Values[key] = value
+	self.modified = true
+}
+
+func (self *Session) Delete(key string) {
+	delete(self.Values, key)
+	self.modified = true
+}
+
+// GetString returns the string stored under key.
+func (self *Session) GetString(key string) (string, bool) {
+	value, ok := self.Values[key].(string)
+	return value, ok
+}
+
+// GetInt returns the integer stored under key, which comes back from storage as a float64.
+func (self *Session) GetInt(key string) (int, bool) {
+	switch value := self.Values[key].(type) {
+	case int:
+		return value, true
+	case float64:
+		return int(value), true
+	}
+	return 0, false
+}
+
+func (self *Session) GetBool(key string) (bool, bool) {
+	value, ok := self.Values[key].(bool)
+	return value, ok
+}
+
+// Regenerate moves the session to a new id, to be called on login against session fixation.
+func (self *Session) Regenerate() {
+	if self.previous == "" && !self.IsNew {
+		self.previous = self.ID
+	}
+	self.ID = newSessionID()
+	self.modified = true
+}
+
+// Destroy removes the session from the store and expires the cookie.
+func (self *Session) Destroy() {
+	self.Values = map[string]interface{}{}
+	self.destroyed = true
+}
+
+func newSessionID() string {
+	return SecureBase64URL(32)
+}
+
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(SessionKey).(*Session)
+	return session
+}
+
+func GetSession(r *http.Request) *Session {
+	return SessionFromContext(r.Context())
+}
+
+// SessionStore keeps session values on the server. Load returns nil values for unknown ids.
+type SessionStore interface {
+	Load(ctx context.Context, id string) (map[string]interface{}, error)
+	Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+// memorySweepInterval is how often MemorySessionStore drops expired sessions.
+const memorySweepInterval = time.Minute
+
+// MemorySessionStore keeps sessions in process memory; it suits tests and single instances.
+type MemorySessionStore struct {
+	mutex     sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession), lastSweep: time.Now()}
+}
+
+func (self *MemorySessionStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	self.mutex.Lock()
+	session, ok := self.sessions[id]
+	if ok && time.Now().After(session.expires) {
+		delete(self.sessions, id)
+		ok = false
+	}
+	self.mutex.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	var values map[string]interface{}
+	return values, json.Unmarshal(session.data, &values)
+}
+
+func (self *MemorySessionStore) Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(self.lastSweep) > memorySweepInterval {
+		for key, session := range self.sessions {
+			if now.After(session.expires) {
+				delete(self.sessions, key)
+			}
+		}
+		self.lastSweep = now
+	}
+	self.sessions[id] = memorySession{data, now.Add(ttl)}
+	return nil
+}
+
+func (self *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.sessions, id)
+	return nil
+}
+
+type RedisSessionStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisSessionStore(client redis.UniversalClient, prefix string) *RedisSessionStore {
+	return &RedisSessionStore{client, prefix}
+}
+
+func (self *RedisSessionStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	data, err := self.client.Get(ctx, self.prefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	return values, json.Unmarshal(data, &values)
+}
+
+func (self *RedisSessionStore) Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return self.client.Set(ctx, self.prefix+id, data, ttl).Err()
+}
+
+func (self *RedisSessionStore) Delete(ctx context.Context, id string) error {
+	return self.client.Del(ctx, self.prefix+id).Err()
+}
+
+type SessionConfig struct {
+	Codec *SecureCookie
+	// Store keeps values server side with only the id in the cookie. When nil the values
+	// themselves are kept in the cookie, which must then stay under 4KB.
+	Store      SessionStore
+	CookieName string
+	MaxAge     time.Duration
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+}
+
+// SessionMiddlewareFactory loads the session named by the request cookie, or starts a new one,
+// and stores it in the request context. A modified session is saved and its cookie set right
+// before the response starts. Cookies are always HttpOnly.
+func SessionMiddlewareFactory(config SessionConfig) func(http.Handler) http.Handler {
+	if config.CookieName == "" {
+		config.CookieName = "session"
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = 24 * time.Hour
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			session := loadSession(r, config)
+			writer := &sessionCookieWriter{ResponseWriter: w, session: session, config: config, r: r}
+			next.ServeHTTP(writer, SetInContext(session, SessionKey, r))
+			writer.save()
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func loadSession(r *http.Request, config SessionConfig) *Session {
+	if cookie, err := r.Cookie(config.CookieName); err == nil {
+		if config.Store == nil {
+			var values map[string]interface{}
+			if config.Codec.Decode(config.CookieName, cookie.Value, &values, config.MaxAge) == nil && values != nil {
+				return &Session{Values: values}
+			}
+		} else {
+			var id string
+			if config.Codec.Decode(config.CookieName, cookie.Value, &id, config.MaxAge) == nil {
+				values, err := config.Store.Load(r.Context(), id)
+				if err != nil {
+					LoggerFromContext(r.Context()).Log(ErrorLevel, "session load failed", Fields{"error": err.Error()})
+				}
+				if values != nil {
+					return &Session{ID: id, Values: values}
+				}
+			}
+		}
+	}
+	session := &Session{Values: map[string]interface{}{}, IsNew: true}
+	if config.Store != nil {
+		session.ID = newSessionID()
+	}
+	return session
+}
+
+type sessionCookieWriter struct {
+	http.ResponseWriter
+	session *Session
+	config  SessionConfig
+	r       *http.Request
+	saved   bool
+}
+
+func (self *sessionCookieWriter) save() {
+	if self.saved {
+		return
+	}
+	self.saved = true
+	session, config := self.session, self.config
+	ctx := self.r.Context()
+	if session.previous != "" && config.Store != nil {
+		config.Store.Delete(ctx, session.previous)
+	}
+	cookie := &http.Cookie{Name: config.CookieName, Path: config.Path, Domain: config.Domain,
+		Secure: config.Secure, HttpOnly: true, SameSite: config.SameSite}
+	if session.destroyed {
+		if config.Store != nil && !session.IsNew {
+			config.Store.Delete(ctx, session.ID)
+		}
+		cookie.MaxAge = -1
+		http.SetCookie(self.ResponseWriter, cookie)
+		return
+	}
+	if !session.modified {
+		return
+	}
+	var value interface{} = session.Values
+	if config.Store != nil {
+		if err := config.Store.Save(ctx, session.ID, session.Values, config.MaxAge); err != nil {
+			LoggerFromContext(ctx).Log(ErrorLevel, "session save failed", Fields{"error": err.Error()})
+			return
+		}
+		value = session.ID
+	}
+	encoded, err := config.Codec.Encode(config.CookieName, value)
+	if err != nil {
+		LoggerFromContext(ctx).Log(ErrorLevel, "session encode failed", Fields{"error": err.Error()})
+		return
+	}
+	cookie.Value = encoded
+	cookie.MaxAge = int(config.MaxAge.Seconds())
+	http.SetCookie(self.ResponseWriter, cookie)
+}
+
+func (self *sessionCookieWriter) WriteHeader(code int) {
+	self.save()
+	self.ResponseWriter.WriteHeader(code)
+}
+
+func (self *sessionCookieWriter) Write(data []byte) (int, error) {
+	self.save()
+	return self.ResponseWriter.Write(data)
+}
+
+func (self *sessionCookieWriter) Flush() {
+	self.save()
+	if flusher, ok := self.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (self *sessionCookieWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
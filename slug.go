@@ -0,0 +1,176 @@
+package httputils
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var slugReplacements = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+}
+
+// Slugify lowercases value, folds compatibility characters and Latin accents to their base
+// letters, and joins the remaining runs of letters and digits with "-". Letters of other scripts
+// are kept.
+func Slugify(value string) string {
+	var builder strings.Builder
+	dash, latin := false, false
+	for _, r := range norm.NFKD.String(strings.ToLower(value)) {
+		if unicode.Is(unicode.Mn, r) {
+			if !latin {
+				builder.WriteRune(r)
+			}
+			continue
+		}
+		replacement, ok := slugReplacements[r]
+		if !ok && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = true
+			continue
+		}
+		if dash && builder.Len() > 0 {
+			builder.WriteByte('-')
+		}
+		dash, latin = false, unicode.Is(unicode.Latin, r)
+		if ok {
+			builder.WriteString(replacement)
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(builder.String())
+}
+
+// confusables maps letters of other scripts to the Latin letters they are drawn like.
+var confusables = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'і': 'i', 'ј': 'j', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u',
+	'χ': 'x', 'ɡ': 'g', 'ɩ': 'i', 'ℓ': 'l',
+}
+
+// Skeleton folds value to the form Slugify gives it with confusable letters replaced by their
+// Latin look-alikes and 0 and 1 read as o and l. Identifiers with equal skeletons look the same,
+// so storing and comparing skeletons stops "pаypal" with a Cyrillic а from impersonating "paypal".
+func Skeleton(value string) string {
+	return strings.Map(func(r rune) rune {
+		if latin, ok := confusables[r]; ok {
+			return latin
+		}
+		switch r {
+		case '0':
+			return 'o'
+		case '1':
+			return 'l'
+		}
+		return r
+	}, Slugify(value))
+}
+
+// mixedScripts reports whether value has letters of more than one script, counting Japanese
+// kana with Han as one.
+func mixedScripts(value string) bool {
+	var script *unicode.RangeTable
+	for _, r := range value {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		var current *unicode.RangeTable
+		for _, table := range unicode.Scripts {
+			if unicode.Is(table, r) {
+				current = table
+				break
+			}
+		}
+		if current == unicode.Hiragana || current == unicode.Katakana {
+			current = unicode.Han
+		}
+		if script != nil && current != script {
+			return true
+		}
+		script = current
+	}
+	return false
+}
+
+// SlugValidator accepts strings that Slugify leaves unchanged and whose letters are of a single
+// script.
+func SlugValidator(key string) Validator {
+	return func(value interface{}) error {
+		stringValue, ok := value.(string)
+		if !ok {
+			return Error{Key: key, Description: " Should be string", Code: CodeTypeError, Args: []string{"string"}}
+		}
+		if stringValue == "" || Slugify(stringValue) != stringValue {
+			return Error{Key: key, Description: "Invalid slug", Code: CodeInvalidSlugError,
+				Meta: map[string]interface{}{"suggestion": Slugify(stringValue)}}
+		}
+		if mixedScripts(stringValue) {
+			return Error{Key: key, Description: "Slug mixes scripts", Code: CodeInvalidSlugError}
+		}
+		return nil
+	}
+}
+
+type UsernamePolicy struct {
+	MinLength int
+	MaxLength int
+	// Unicode allows letters and digits of any single script rather than ASCII only.
+	Unicode bool
+	// Punctuation lists the other characters allowed between letters, such as "._-".
+	Punctuation string
+	// Reserved names, such as "admin", are compared by Skeleton so look-alikes are refused too.
+	Reserved []string
+}
+
+var DefaultUsernamePolicy = UsernamePolicy{
+	MinLength:   3,
+	MaxLength:   32,
+	Punctuation: "._-",
+	Reserved:    []string{"admin", "administrator", "root", "support", "system", "api", "www"},
+}
+
+// NormalizeUsername returns value in NFKC form, lowercased, which is the form to store and look
+// usernames up by.
+func NormalizeUsername(value string) string {
+	return strings.ToLower(norm.NFKC.String(value))
+}
+
+// UsernameValidator checks usernames against policy after NormalizeUsername. Usernames must start
+// with a letter or digit, and must not mix scripts or look like a reserved name.
+func UsernameValidator(key string, policy UsernamePolicy) Validator {
+	reserved := make(map[string]bool)
+	for _, name := range policy.Reserved {
+		reserved[Skeleton(name)] = true
+	}
+	return func(value interface{}) error {
+		stringValue, ok := value.(string)
+		if !ok {
+			return Error{Key: key, Description: " Should be string", Code: CodeTypeError, Args: []string{"string"}}
+		}
+		username := NormalizeUsername(stringValue)
+		length := len([]rune(username))
+		if length < policy.MinLength || policy.MaxLength > 0 && length > policy.MaxLength {
+			return Error{Key: key, Description: "Invalid username length", Code: CodeStringLengthError,
+				Args: []string{key, strconv.Itoa(policy.MinLength)},
+				Meta: map[string]interface{}{"min": policy.MinLength, "max": policy.MaxLength, "actual": length}}
+		}
+		for i, r := range username {
+			allowed := unicode.IsLetter(r) || unicode.IsDigit(r)
+			if !policy.Unicode && r > unicode.MaxASCII {
+				allowed = false
+			}
+			if !allowed && (i == 0 || !strings.ContainsRune(policy.Punctuation, r)) {
+				return Error{Key: key, Description: "Invalid character in username", Code: CodeInvalidUsernameError, Args: []string{string(r)}}
+			}
+		}
+		if mixedScripts(username) {
+			return Error{Key: key, Description: "Username mixes scripts", Code: CodeInvalidUsernameError}
+		}
+		if reserved[Skeleton(username)] {
+			return Error{Key: key, Description: "Username is reserved", Code: CodeInvalidUsernameError}
+		}
+		return nil
+	}
+}
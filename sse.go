@@ -0,0 +1,139 @@
+package httputils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventStreamHeartbeat is how often an idle event stream sends a comment line to keep proxies
+// from closing the connection. Zero disables heartbeats.
+var EventStreamHeartbeat = 15 * time.Second
+
+var ErrEventStreamStopped = errors.New("httputils: event stream stopped")
+
+// Event attaches an id to the data sent on an event stream so that reconnecting clients resume
+// from it through the Last-Event-ID header.
+type Event struct {
+	ID   string
+	Data interface{}
+}
+
+// EventSender writes one event. Strings and byte slices are sent as is, anything else as JSON.
+// An empty event name sends an unnamed message event. It fails once the client has gone away.
+type EventSender func(event string, data interface{}) error
+
+// LastEventID returns the id of the last event a reconnecting client received.
+func LastEventID(r *http.Request) string {
+	return r.Header.Get("Last-Event-ID")
+}
+
+// EventStream starts a Server-Sent Events response. The returned stop function ends the
+// heartbeat and must be called before the handler returns:
+//
+//	send, stop, err := httputils.EventStream(w, r)
+//	if err != nil { ... }
+//	defer stop()
+func EventStream(w http.ResponseWriter, r *http.Request) (EventSender, func(), error) {
+	controller := http.NewResponseController(w)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return nil, nil, err
+	}
+	controller.SetWriteDeadline(time.Time{})
+
+	var mutex sync.Mutex
+	stopped := false
+	ctx := r.Context()
+	write := func(message string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if stopped {
+			return ErrEventStreamStopped
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(message)); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	done := make(chan struct{})
+	if EventStreamHeartbeat > 0 {
+		go func() {
+			ticker := time.NewTicker(EventStreamHeartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if write(": ping\n\n") != nil {
+						return
+					}
+				case <-ctx.Done():
+					return
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			mutex.Lock()
+			stopped = true
+			mutex.Unlock()
+			close(done)
+		})
+	}
+
+	send := func(event string, data interface{}) error {
+		message, err := formatEvent(event, data)
+		if err != nil {
+			return err
+		}
+		return write(message)
+	}
+	return send, stop, nil
+}
+
+func formatEvent(event string, data interface{}) (string, error) {
+	var builder strings.Builder
+	if value, ok := data.(Event); ok {
+		fmt.Fprintf(&builder, "id: %s\n", strings.Replace(value.ID, "\n", "", -1))
+		data = value.Data
+	}
+	if event != "" {
+		fmt.Fprintf(&builder, "event: %s\n", strings.Replace(event, "\n", "", -1))
+	}
+	var payload string
+	switch value := data.(type) {
+	case string:
+		payload = value
+	case []byte:
+		payload = string(value)
+	default:
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		payload = string(bytes)
+	}
+	for _, line := range strings.Split(payload, "\n") {
+		fmt.Fprintf(&builder, "data: %s\n", line)
+	}
+	builder.WriteString("\n")
+	return builder.String(), nil
+}
@@ -0,0 +1,135 @@
+package httputils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var StaticMaxAge = 24 * time.Hour
+
+// noListingFS hides directories so the file server never renders directory listings.
+type noListingFS struct {
+	fs fs.FS
+}
+
+func (self noListingFS) Open(name string) (fs.File, error) {
+	file, err := self.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, fs.ErrNotExist
+	}
+	return file, nil
+}
+
+func cacheControl(maxAge time.Duration, next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func serveFile(fileServer http.Handler, w http.ResponseWriter, r *http.Request, name string) {
+	req := r.Clone(r.Context())
+	req.URL.Path = "/" + name
+	req.URL.RawPath = ""
+	fileServer.ServeHTTP(w, req)
+}
+
+// cleanFilePath turns a request path into a name accepted by fs.FS, rejecting traversal.
+func cleanFilePath(value string) (string, bool) {
+	name := strings.TrimPrefix(path.Clean("/"+value), "/")
+	if name == "" {
+		return "", false
+	}
+	return name, fs.ValidPath(name)
+}
+
+func (self *Router) Static(prefix string, dir string, mws ...func(http.Handler) http.Handler) {
+	self.StaticFS(prefix, os.DirFS(dir), mws...)
+}
+
+// StaticFS serves files from fsys under prefix, for example an embed.FS.
+func (self *Router) StaticFS(prefix string, fsys fs.FS, mws ...func(http.Handler) http.Handler) {
+	fileServer := http.FileServer(http.FS(noListingFS{fsys}))
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		name, ok := cleanFilePath(Params(r)["filepath"])
+		if !ok {
+			self.rootRouter().router.NotFound.ServeHTTP(w, r)
+			return
+		}
+		serveFile(fileServer, w, r, name)
+	}
+	self.Get(strings.TrimSuffix(prefix, "/")+"/*filepath", cacheControl(StaticMaxAge, http.HandlerFunc(fn)), mws...)
+}
+
+func (self *Router) SPA(prefix string, indexFile string) {
+	self.SPAFS(prefix, os.DirFS(filepath.Dir(indexFile)), filepath.Base(indexFile))
+}
+
+// SPAFS serves files from fsys for unmatched GET requests under prefix and falls back to index
+// for requests accepting HTML, so client-side routes load the application. Other unmatched
+// requests keep getting the router's 404 response.
+func (self *Router) SPAFS(prefix string, fsys fs.FS, index string) {
+	root := self.rootRouter()
+	prefix = joinPath(self.prefix, prefix)
+	notFound := root.router.NotFound
+	fileServer := cacheControl(StaticMaxAge, http.FileServer(http.FS(noListingFS{fsys})))
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !strings.HasPrefix(r.URL.Path, prefix) {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		name, ok := cleanFilePath(strings.TrimPrefix(r.URL.Path, prefix))
+		if ok {
+			if info, err := fs.Stat(fsys, name); err == nil && !info.IsDir() {
+				serveFile(fileServer, w, r, name)
+				return
+			}
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		file, err := fsys.Open(index)
+		if err != nil {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		content, ok := file.(io.ReadSeeker)
+		if !ok {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				notFound.ServeHTTP(w, r)
+				return
+			}
+			content = bytes.NewReader(data)
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, r, index, info.ModTime(), content)
+	}
+	root.router.NotFound = http.HandlerFunc(fn)
+}
@@ -0,0 +1,188 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ti/mdb"
+	mgo "gopkg.in/mgo.v2"
+	"sync"
+)
+
+// ErrNotFound is returned by Store adapters when a query matched no document.
+var ErrNotFound = errors.New("httputils: document not found")
+
+// Query is the subset of a database query the package helpers rely on. Sort takes mgo-style
+// field names, "-field" meaning descending.
+type Query interface {
+	Sort(fields ...string) Query
+	Skip(n int) Query
+	Limit(n int) Query
+	Count() (int, error)
+	One(result interface{}) error
+	All(result interface{}) error
+}
+
+// Store is a collection of documents that the package helpers program against.
+type Store interface {
+	Find(ctx context.Context, filter interface{}) Query
+	Insert(ctx context.Context, docs ...interface{}) error
+	Update(ctx context.Context, selector interface{}, update interface{}) error
+	Remove(ctx context.Context, selector interface{}) error
+}
+
+func notFound(err error) error {
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+type mdbStore struct {
+	collection *mdb.Collection
+}
+
+func NewMdbStore(collection *mdb.Collection) Store {
+	return mdbStore{collection}
+}
+
+func (self mdbStore) Find(ctx context.Context, filter interface{}) Query {
+	return mdbQuery{self.collection.Find(filter)}
+}
+
+func (self mdbStore) Insert(ctx context.Context, docs ...interface{}) error {
+	return self.collection.Insert(docs...)
+}
+
+func (self mdbStore) Update(ctx context.Context, selector interface{}, update interface{}) error {
+	return notFound(self.collection.Update(selector, update))
+}
+
+func (self mdbStore) Remove(ctx context.Context, selector interface{}) error {
+	return notFound(self.collection.Remove(selector))
+}
+
+type mdbQuery struct {
+	query *mdb.Query
+}
+
+func (self mdbQuery) Sort(fields ...string) Query {
+	return mdbQuery{self.query.Sort(fields...)}
+}
+
+func (self mdbQuery) Skip(n int) Query {
+	return mdbQuery{self.query.Skip(n)}
+}
+
+func (self mdbQuery) Limit(n int) Query {
+	return mdbQuery{self.query.Limit(n)}
+}
+
+func (self mdbQuery) Count() (int, error) {
+	return self.query.Count()
+}
+
+func (self mdbQuery) One(result interface{}) error {
+	return notFound(self.query.One(result))
+}
+
+func (self mdbQuery) All(result interface{}) error {
+	return self.query.All(result)
+}
+
+type mgoStore struct {
+	collection *mgo.Collection
+}
+
+func NewMgoStore(collection *mgo.Collection) Store {
+	return mgoStore{collection}
+}
+
+func (self mgoStore) Find(ctx context.Context, filter interface{}) Query {
+	return mgoQuery{self.collection.Find(filter)}
+}
+
+func (self mgoStore) Insert(ctx context.Context, docs ...interface{}) error {
+	return self.collection.Insert(docs...)
+}
+
+func (self mgoStore) Update(ctx context.Context, selector interface{}, update interface{}) error {
+	return notFound(self.collection.Update(selector, update))
+}
+
+func (self mgoStore) Remove(ctx context.Context, selector interface{}) error {
+	return notFound(self.collection.Remove(selector))
+}
+
+type mgoQuery struct {
+	query *mgo.Query
+}
+
+func (self mgoQuery) Sort(fields ...string) Query {
+	return mgoQuery{self.query.Sort(fields...)}
+}
+
+func (self mgoQuery) Skip(n int) Query {
+	return mgoQuery{self.query.Skip(n)}
+}
+
+func (self mgoQuery) Limit(n int) Query {
+	return mgoQuery{self.query.Limit(n)}
+}
+
+func (self mgoQuery) Count() (int, error) {
+	return self.query.Count()
+}
+
+func (self mgoQuery) One(result interface{}) error {
+	return notFound(self.query.One(result))
+}
+
+func (self mgoQuery) All(result interface{}) error {
+	return self.query.All(result)
+}
+
+type FindOptions struct {
+	Skip  *int
+	Limit *int
+	Sort  []string
+	// SkipCount avoids counting matching documents, which is expensive on large collections.
+	SkipCount bool
+}
+
+func SkipLimit(query Query, skip *int, limit *int) Query {
+	if skip != nil {
+		query = query.Skip(*skip)
+	}
+	if limit != nil {
+		query = query.Limit(*limit)
+	}
+	return query
+}
+
+var (
+	collectionsMutex sync.RWMutex
+	collections      = make(map[string]Store)
+)
+
+// RegisterCollection names store so validators such as UniqueValidator can refer to it. It panics
+// if name is already registered.
+func RegisterCollection(name string, store Store) {
+	collectionsMutex.Lock()
+	defer collectionsMutex.Unlock()
+	if _, ok := collections[name]; ok {
+		panic(fmt.Sprintf("httputils: collection %q is already registered", name))
+	}
+	collections[name] = store
+}
+
+// CollectionStore returns the store registered as name.
+func CollectionStore(name string) (Store, error) {
+	collectionsMutex.RLock()
+	defer collectionsMutex.RUnlock()
+	store, ok := collections[name]
+	if !ok {
+		return nil, fmt.Errorf("httputils: unknown collection %q", name)
+	}
+	return store, nil
+}
@@ -0,0 +1,231 @@
+package httputils
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// toDriver converts mgo bson values in filters and documents into their mongo-driver
+// equivalents so the same bson.M and bson.D selectors work with both adapters. Structs are
+// marshalled with mgo's bson first, so their bson tags and ObjectId fields are honoured as well.
+func toDriver(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.ObjectId:
+		if !v.Valid() {
+			return string(v)
+		}
+		var id primitive.ObjectID
+		copy(id[:], []byte(v))
+		return id
+	case bson.M:
+		return toDriver(map[string]interface{}(v))
+	case bson.D:
+		d := primitive.D{}
+		for _, element := range v {
+			d = append(d, primitive.E{Key: element.Name, Value: toDriver(element.Value)})
+		}
+		return d
+	case []bson.D:
+		a := primitive.A{}
+		for _, item := range v {
+			a = append(a, toDriver(item))
+		}
+		return a
+	case map[string]interface{}:
+		m := primitive.M{}
+		for key, item := range v {
+			m[key] = toDriver(item)
+		}
+		return m
+	case []bson.M:
+		a := primitive.A{}
+		for _, item := range v {
+			a = append(a, toDriver(item))
+		}
+		return a
+	case []interface{}:
+		a := primitive.A{}
+		for _, item := range v {
+			a = append(a, toDriver(item))
+		}
+		return a
+	case []bson.ObjectId:
+		a := primitive.A{}
+		for _, item := range v {
+			a = append(a, toDriver(item))
+		}
+		return a
+	}
+	if document, ok := mgoDocument(value); ok {
+		return toDriver(document)
+	}
+	return value
+}
+
+// mgoDocument marshals a struct, or a pointer to one, defined outside the driver's packages
+// into a bson.M.
+func mgoDocument(value interface{}) (bson.M, bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || v.Type() == reflect.TypeOf(time.Time{}) ||
+		strings.HasPrefix(v.Type().PkgPath(), "go.mongodb.org/") {
+		return nil, false
+	}
+	data, err := bson.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	var document bson.M
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return nil, false
+	}
+	return document, true
+}
+
+func driverFilter(filter interface{}) interface{} {
+	if filter == nil {
+		return primitive.M{}
+	}
+	return toDriver(filter)
+}
+
+func driverSort(fields []string) primitive.D {
+	sort := primitive.D{}
+	for _, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			sort = append(sort, primitive.E{Key: field[1:], Value: -1})
+		} else {
+			sort = append(sort, primitive.E{Key: strings.TrimPrefix(field, "+"), Value: 1})
+		}
+	}
+	return sort
+}
+
+func driverNotFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+type mongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) Store {
+	return mongoStore{collection}
+}
+
+func (self mongoStore) Find(ctx context.Context, filter interface{}) Query {
+	return &mongoQuery{ctx: ctx, collection: self.collection, filter: driverFilter(filter)}
+}
+
+func (self mongoStore) Insert(ctx context.Context, docs ...interface{}) error {
+	converted := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		converted[i] = toDriver(doc)
+	}
+	_, err := self.collection.InsertMany(ctx, converted)
+	return err
+}
+
+func (self mongoStore) Update(ctx context.Context, selector interface{}, update interface{}) error {
+	result, err := self.collection.UpdateOne(ctx, driverFilter(selector), toDriver(update))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (self mongoStore) Remove(ctx context.Context, selector interface{}) error {
+	result, err := self.collection.DeleteOne(ctx, driverFilter(selector))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoQuery struct {
+	ctx        context.Context
+	collection *mongo.Collection
+	filter     interface{}
+	sort       []string
+	skip       *int64
+	limit      *int64
+}
+
+func (self *mongoQuery) Sort(fields ...string) Query {
+	query := *self
+	query.sort = fields
+	return &query
+}
+
+func (self *mongoQuery) Skip(n int) Query {
+	query := *self
+	skip := int64(n)
+	query.skip = &skip
+	return &query
+}
+
+func (self *mongoQuery) Limit(n int) Query {
+	query := *self
+	limit := int64(n)
+	query.limit = &limit
+	return &query
+}
+
+// Count counts the matching documents, honouring Skip and Limit like mgo does.
+func (self *mongoQuery) Count() (int, error) {
+	opts := options.Count()
+	if self.skip != nil {
+		opts.SetSkip(*self.skip)
+	}
+	if self.limit != nil && *self.limit > 0 {
+		opts.SetLimit(*self.limit)
+	}
+	count, err := self.collection.CountDocuments(self.ctx, self.filter, opts)
+	return int(count), err
+}
+
+func (self *mongoQuery) One(result interface{}) error {
+	opts := options.FindOne()
+	if len(self.sort) > 0 {
+		opts.SetSort(driverSort(self.sort))
+	}
+	if self.skip != nil {
+		opts.SetSkip(*self.skip)
+	}
+	return driverNotFound(self.collection.FindOne(self.ctx, self.filter, opts).Decode(result))
+}
+
+func (self *mongoQuery) All(result interface{}) error {
+	opts := options.Find()
+	if len(self.sort) > 0 {
+		opts.SetSort(driverSort(self.sort))
+	}
+	if self.skip != nil {
+		opts.SetSkip(*self.skip)
+	}
+	if self.limit != nil {
+		opts.SetLimit(*self.limit)
+	}
+	cursor, err := self.collection.Find(self.ctx, self.filter, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(self.ctx, result)
+}
@@ -0,0 +1,260 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+)
+
+type Tenant struct {
+	ID   string                 `json:"id"`
+	Name string                 `json:"name,omitempty"`
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+// TenantResolver looks a tenant up by the id found in the request, returning nil for unknown ids.
+type TenantResolver interface {
+	Resolve(ctx context.Context, id string) (*Tenant, error)
+}
+
+type TenantResolverFunc func(ctx context.Context, id string) (*Tenant, error)
+
+func (self TenantResolverFunc) Resolve(ctx context.Context, id string) (*Tenant, error) {
+	return self(ctx, id)
+}
+
+// StaticTenants resolves the tenants it holds by id.
+type StaticTenants map[string]*Tenant
+
+func (self StaticTenants) Resolve(ctx context.Context, id string) (*Tenant, error) {
+	return self[id], nil
+}
+
+// TenantSource extracts a tenant id from the request. It may return a changed request, as
+// TenantFromPathPrefix does, and an empty id when the request names no tenant.
+type TenantSource func(r *http.Request) (string, *http.Request)
+
+// TenantFromSubdomain takes the label in front of domain, so acme.example.com gives acme for
+// domain example.com.
+func TenantFromSubdomain(domain string) TenantSource {
+	suffix := "." + strings.TrimPrefix(strings.ToLower(domain), ".")
+	return func(r *http.Request) (string, *http.Request) {
+		host := strings.ToLower(r.Host)
+		if i := strings.LastIndex(host, ":"); i > strings.LastIndex(host, "]") {
+			host = host[:i]
+		}
+		id, ok := strings.CutSuffix(host, suffix)
+		if !ok || strings.Contains(id, ".") {
+			return "", r
+		}
+		return id, r
+	}
+}
+
+func TenantFromHeader(header string) TenantSource {
+	return func(r *http.Request) (string, *http.Request) {
+		return strings.TrimSpace(r.Header.Get(header)), r
+	}
+}
+
+// TenantFromPathPrefix takes the first path segment after prefix and strips both from the path,
+// so with prefix "/t" the request /t/acme/orders is routed as /orders. The middleware must then
+// wrap the router rather than be added to routes.
+func TenantFromPathPrefix(prefix string) TenantSource {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+	return func(r *http.Request) (string, *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, prefix+"/")
+		if !ok {
+			return "", r
+		}
+		id, path, _ := strings.Cut(rest, "/")
+		if id == "" {
+			return "", r
+		}
+		clone := r.Clone(r.Context())
+		clone.URL.Path = "/" + path
+		clone.URL.RawPath = ""
+		return id, clone
+	}
+}
+
+type TenantConfig struct {
+	// Sources are tried in order until one finds a tenant id.
+	Sources  []TenantSource
+	Resolver TenantResolver
+	// Optional lets requests without a tenant through; a tenant that is named but unknown is
+	// rejected either way.
+	Optional bool
+}
+
+func TenantFromContext(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(TenantKey).(*Tenant)
+	return tenant
+}
+
+func GetTenant(r *http.Request) *Tenant {
+	return TenantFromContext(r.Context())
+}
+
+// TenantMiddlewareFactory resolves the request's tenant and stores it for GetTenant and
+// TenantStore. Requests without a tenant get a 400 and unknown tenants a 404.
+func TenantMiddlewareFactory(config TenantConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			var id string
+			for _, source := range config.Sources {
+				var resolved *http.Request
+				if id, resolved = source(r); id != "" {
+					r = resolved
+					break
+				}
+			}
+			if id == "" {
+				if config.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				WriteError(w, Error{Key: "tenant", Description: "Field is required", Code: CodeRequiredFieldError}.AsServerError(400))
+				return
+			}
+			tenant, err := config.Resolver.Resolve(r.Context(), id)
+			if err != nil {
+				WriteError(w, Internal(err))
+				return
+			}
+			if tenant == nil {
+				HTTP404(id).Write(w)
+				return
+			}
+			logger := WithFields(LoggerFromContext(r.Context()), Fields{"tenant": tenant.ID})
+			next.ServeHTTP(w, SetLogger(logger, SetInContext(tenant, TenantKey, r)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// ErrNoTenant is returned by the writes of a TenantStore called without a tenant.
+var ErrNoTenant = errors.New("httputils: no tenant in context")
+
+type tenantStore struct {
+	store Store
+	field string
+}
+
+// TenantStore scopes store to the tenant in the context of each call: queries, updates and
+// removals only match documents whose field holds the tenant id, and copies of inserted and
+// replacement documents get it set, structs being converted to maps for that. Updates changing
+// field fail. Without a tenant queries match nothing and writes fail with ErrNoTenant.
+func TenantStore(store Store, field string) Store {
+	return tenantStore{store, field}
+}
+
+func (self tenantStore) tenantID(ctx context.Context) (string, bool) {
+	if tenant := TenantFromContext(ctx); tenant != nil && tenant.ID != "" {
+		return tenant.ID, true
+	}
+	return "", false
+}
+
+func (self tenantStore) scope(ctx context.Context, filter interface{}) interface{} {
+	id, ok := self.tenantID(ctx)
+	if !ok {
+		return scopeFilter(filter, self.field, bson.M{"$in": []interface{}{}})
+	}
+	return scopeFilter(filter, self.field, id)
+}
+
+func (self tenantStore) Find(ctx context.Context, filter interface{}) Query {
+	return self.store.Find(ctx, self.scope(ctx, filter))
+}
+
+func (self tenantStore) Insert(ctx context.Context, docs ...interface{}) error {
+	id, ok := self.tenantID(ctx)
+	if !ok {
+		return ErrNoTenant
+	}
+	stamped := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		stamped[i] = self.stamp(doc, id)
+	}
+	return self.store.Insert(ctx, stamped...)
+}
+
+// stamp returns a copy of a map or bson.D document, or a map of a struct one, with the tenant
+// set. Other documents are returned as they are.
+func (self tenantStore) stamp(doc interface{}, id string) interface{} {
+	if ordered, ok := doc.(bson.D); ok {
+		stamped := make(bson.D, 0, len(ordered)+1)
+		for _, element := range ordered {
+			if element.Name != self.field {
+				stamped = append(stamped, element)
+			}
+		}
+		return append(stamped, bson.DocElem{Name: self.field, Value: id})
+	}
+	values, ok := asDocument(doc)
+	if !ok {
+		if values, ok = mgoDocument(doc); !ok {
+			return doc
+		}
+	}
+	stamped := make(bson.M, len(values)+1)
+	for key, value := range values {
+		stamped[key] = value
+	}
+	stamped[self.field] = id
+	return stamped
+}
+
+// tenantFields returns the fields of a map or bson.D document.
+func tenantFields(value interface{}) (map[string]interface{}, bool) {
+	if ordered, ok := value.(bson.D); ok {
+		return ordered.Map(), true
+	}
+	return asDocument(value)
+}
+
+func (self tenantStore) Update(ctx context.Context, selector interface{}, update interface{}) error {
+	id, ok := self.tenantID(ctx)
+	if !ok {
+		return ErrNoTenant
+	}
+	values, ok := tenantFields(update)
+	if !ok {
+		return self.store.Update(ctx, self.scope(ctx, selector), self.stamp(update, id))
+	}
+	operators := false
+	for key, value := range values {
+		if !strings.HasPrefix(key, "$") {
+			continue
+		}
+		operators = true
+		if fields, ok := tenantFields(value); ok {
+			if _, ok := fields[self.field]; ok {
+				return fmt.Errorf("httputils: %s cannot change the tenant field %q", key, self.field)
+			}
+		}
+	}
+	if !operators {
+		update = self.stamp(update, id)
+	}
+	return self.store.Update(ctx, self.scope(ctx, selector), update)
+}
+
+func (self tenantStore) Remove(ctx context.Context, selector interface{}) error {
+	if _, ok := self.tenantID(ctx); !ok {
+		return ErrNoTenant
+	}
+	return self.store.Remove(ctx, self.scope(ctx, selector))
+}
+
+func (self tenantStore) withDeleted() Store {
+	return tenantStore{WithDeleted(self.store), self.field}
+}
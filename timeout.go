@@ -0,0 +1,117 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+func HTTP504() ServerError {
+	return ServerError{504, Errors{[]Error{UndefinedKeyError(CodeGatewayTimeout, "Request timed out")}}}
+}
+
+type timeoutWriter struct {
+	serializer ErrorSerializer
+	wrap       Envelope
+	mutex      sync.Mutex
+	header     http.Header
+	buffer     bytes.Buffer
+	code       int
+	timedOut   bool
+}
+
+func (self *timeoutWriter) errorSerializer() ErrorSerializer {
+	return self.serializer
+}
+
+func (self *timeoutWriter) envelope() Envelope {
+	return self.wrap
+}
+
+// Header returns the handler's own copy of the response headers, such as the request id, copied
+// back only once the handler returned in time, so a handler still running after the 504 never
+// touches the real headers.
+func (self *timeoutWriter) Header() http.Header {
+	return self.header
+}
+
+func (self *timeoutWriter) Write(data []byte) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if self.code == 0 {
+		self.code = http.StatusOK
+	}
+	return self.buffer.Write(data)
+}
+
+func (self *timeoutWriter) WriteHeader(code int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.timedOut || self.code != 0 {
+		return
+	}
+	self.code = code
+}
+
+// TimeoutMiddlewareFactory runs the handler with a deadline of d and answers with a 504 if it
+// has not finished in time. The handler's output, headers included, is buffered until it
+// returns.
+func TimeoutMiddlewareFactory(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{serializer: errorSerializerFor(w), wrap: envelopeFor(w), header: w.Header().Clone()}
+			done := make(chan struct{})
+			panics := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						panics <- err
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case err := <-panics:
+				panic(err)
+			case <-done:
+				tw.mutex.Lock()
+				defer tw.mutex.Unlock()
+				for key := range w.Header() {
+					if _, ok := tw.header[key]; !ok {
+						delete(w.Header(), key)
+					}
+				}
+				for key, values := range tw.header {
+					w.Header()[key] = append([]string(nil), values...)
+				}
+				if tw.code == 0 {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				w.Write(tw.buffer.Bytes())
+			case <-ctx.Done():
+				tw.mutex.Lock()
+				defer tw.mutex.Unlock()
+				tw.timedOut = true
+				// A client that went away, or an outer deadline, cancelled the request rather
+				// than d running out: there is no one to answer, or the outer middleware does.
+				if r.Context().Err() != nil {
+					return
+				}
+				HTTP504().Write(w)
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,53 @@
+package httputils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+)
+
+// SecureBytes returns n bytes from crypto/rand. It panics if the system source fails, which
+// leaves no safe way to continue.
+func SecureBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// SecureToken returns n random ASCII letters, a drop-in replacement for RandStringBytes.
+func SecureToken(n int) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(letterBytes)))
+	for i := range b {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = letterBytes[index.Int64()]
+	}
+	return string(b)
+}
+
+// SecureHex returns n random bytes hex encoded, 2n characters long.
+func SecureHex(n int) string {
+	return hex.EncodeToString(SecureBytes(n))
+}
+
+// SecureBase64URL returns n random bytes in unpadded URL-safe base64.
+func SecureBase64URL(n int) string {
+	return base64.RawURLEncoding.EncodeToString(SecureBytes(n))
+}
+
+// ConstantTimeEqual compares secrets such as tokens or API keys without leaking through timing
+// how much of them matched.
+func ConstantTimeEqual(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func ConstantTimeEqualBytes(a []byte, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
@@ -0,0 +1,304 @@
+package httputils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenInvalid = errors.New("httputils: token is invalid")
+	ErrTokenExpired = errors.New("httputils: token expired")
+	ErrTokenRevoked = errors.New("httputils: token was revoked")
+)
+
+// TokenPair is the answer of token issuing and refresh endpoints.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type accessClaims struct {
+	ID          string   `json:"jti"`
+	Session     string   `json:"sid"`
+	Issuer      string   `json:"iss,omitempty"`
+	Subject     string   `json:"sub"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	IssuedAt    int64    `json:"iat"`
+	Expires     int64    `json:"exp"`
+}
+
+type refreshRecord struct {
+	Family   string    `json:"family"`
+	Identity Identity  `json:"identity"`
+	Expires  time.Time `json:"expires"`
+}
+
+// TokenIssuer issues short lived HS256 JWT access tokens and long lived opaque refresh tokens.
+// Refresh tokens are single use: each refresh rotates the token, and presenting a used one,
+// which means it leaked, revokes every token descending from the same login, access tokens
+// included. Refresh tokens, kept hashed, and revocations live in Cache, so with a shared cache
+// they work across instances. Cache must implement CacheAdder, which marks refresh tokens used
+// atomically so that only one of concurrent refreshes with a token succeeds.
+type TokenIssuer struct {
+	Secret     []byte
+	Issuer     string
+	Cache      Cache
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// NewTokenIssuer issues access tokens valid for 15 minutes and refresh tokens valid for 30 days.
+func NewTokenIssuer(secret []byte, cache Cache) *TokenIssuer {
+	return &TokenIssuer{Secret: secret, Cache: cache, AccessTTL: 15 * time.Minute, RefreshTTL: 30 * 24 * time.Hour}
+}
+
+func (self *TokenIssuer) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, self.Secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (self *TokenIssuer) accessToken(identity Identity, family string) (string, error) {
+	now := time.Now()
+	claims, err := json.Marshal(accessClaims{SecureBase64URL(16), family, self.Issuer, identity.ID, identity.Roles,
+		identity.Permissions, now.Unix(), now.Add(self.AccessTTL).Unix()})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + self.sign(unsigned), nil
+}
+
+func (self *TokenIssuer) parse(token string) (accessClaims, error) {
+	var claims accessClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || !ConstantTimeEqual(self.sign(parts[0]+"."+parts[1]), parts[2]) {
+		return claims, ErrTokenInvalid
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil || header.Alg != "HS256" {
+		return claims, ErrTokenInvalid
+	}
+	data, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(data, &claims) != nil || claims.Issuer != self.Issuer {
+		return claims, ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+func refreshKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "refresh:" + hex.EncodeToString(sum[:])
+}
+
+func (self *TokenIssuer) issue(ctx context.Context, identity Identity, family string) (TokenPair, error) {
+	access, err := self.accessToken(identity, family)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh := SecureBase64URL(32)
+	record := refreshRecord{Family: family, Identity: identity, Expires: time.Now().Add(self.RefreshTTL)}
+	if err := SetJSON(ctx, self.Cache, refreshKey(refresh), record, self.RefreshTTL); err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{access, refresh, "Bearer", int(self.AccessTTL.Seconds())}, nil
+}
+
+// Issue starts a login for identity with a new token pair.
+func (self *TokenIssuer) Issue(ctx context.Context, identity Identity) (TokenPair, error) {
+	return self.issue(ctx, identity, SecureHex(16))
+}
+
+func (self *TokenIssuer) familyRevoked(ctx context.Context, family string) (bool, error) {
+	_, err := self.Cache.Get(ctx, "revoked_family:"+family)
+	if err == ErrCacheMiss {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// markUsed marks the refresh token under key used, reporting false when it already was.
+func (self *TokenIssuer) markUsed(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	adder, ok := self.Cache.(CacheAdder)
+	if !ok {
+		return false, errors.New("httputils: TokenIssuer.Cache must implement CacheAdder")
+	}
+	return adder.Add(ctx, key+":used", []byte{1}, ttl)
+}
+
+func (self *TokenIssuer) revokeFamily(ctx context.Context, family string) error {
+	return self.Cache.Set(ctx, "revoked_family:"+family, []byte{1}, self.RefreshTTL)
+}
+
+// Refresh exchanges refreshToken for a new pair and retires it. Unknown, expired, revoked and
+// reused tokens fail with ErrTokenInvalid, ErrTokenExpired or ErrTokenRevoked.
+func (self *TokenIssuer) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	key := refreshKey(refreshToken)
+	var record refreshRecord
+	if err := GetJSON(ctx, self.Cache, key, &record); err != nil {
+		if err == ErrCacheMiss {
+			return TokenPair{}, ErrTokenInvalid
+		}
+		return TokenPair{}, err
+	}
+	if time.Now().After(record.Expires) {
+		return TokenPair{}, ErrTokenExpired
+	}
+	revoked, err := self.familyRevoked(ctx, record.Family)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if revoked {
+		return TokenPair{}, ErrTokenRevoked
+	}
+	first, err := self.markUsed(ctx, key, time.Until(record.Expires))
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !first {
+		LoggerFromContext(ctx).Log(WarnLevel, "refresh token reused, revoking its login", Fields{"subject": record.Identity.ID})
+		if err := self.revokeFamily(ctx, record.Family); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrTokenRevoked
+	}
+	return self.issue(ctx, record.Identity, record.Family)
+}
+
+// Revoke invalidates an access token until it expires or, for a refresh token, every token of
+// its login. Unknown tokens are ignored.
+func (self *TokenIssuer) Revoke(ctx context.Context, token string) error {
+	if claims, err := self.parse(token); err == nil {
+		ttl := time.Until(time.Unix(claims.Expires, 0))
+		if ttl <= 0 {
+			return nil
+		}
+		return self.Cache.Set(ctx, "revoked:"+claims.ID, []byte{1}, ttl)
+	}
+	var record refreshRecord
+	if err := GetJSON(ctx, self.Cache, refreshKey(token), &record); err != nil {
+		if err == ErrCacheMiss {
+			return nil
+		}
+		return err
+	}
+	return self.revokeFamily(ctx, record.Family)
+}
+
+// Verify checks an access token, revoked with its login or on its own, and returns its identity.
+func (self *TokenIssuer) Verify(ctx context.Context, token string) (*Identity, error) {
+	claims, err := self.parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(time.Unix(claims.Expires, 0)) {
+		return nil, ErrTokenExpired
+	}
+	if _, err := self.Cache.Get(ctx, "revoked:"+claims.ID); err != ErrCacheMiss {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenRevoked
+	}
+	if claims.Session != "" {
+		revoked, err := self.familyRevoked(ctx, claims.Session)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return &Identity{ID: claims.Subject, Roles: claims.Roles, Permissions: claims.Permissions}, nil
+}
+
+// tokenError answers token failures with a 401 and cache failures with a 500.
+func tokenError(err error) error {
+	if errors.Is(err, ErrTokenInvalid) || errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrTokenRevoked) {
+		return HTTP401().Wrap(err)
+	}
+	return err
+}
+
+// MiddlewareFactory sets the request identity from the bearer access token, answering 401 when
+// it is invalid, expired or revoked. Requests without one pass through unauthenticated.
+func (self *TokenIssuer) MiddlewareFactory() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token, ok := BearerToken(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			identity, err := self.Verify(r.Context(), token)
+			if err != nil {
+				WriteError(w, tokenError(err))
+				return
+			}
+			next.ServeHTTP(w, SetIdentity(identity, r))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RefreshTokenHandler exchanges the "refresh_token" of the JSON body for a new TokenPair.
+func RefreshTokenHandler(issuer *TokenIssuer) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		body, err := GetValidatedBody(r, VMap{"refresh_token": RequiredStringValidators("refresh_token")})
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		pair, err := issuer.Refresh(r.Context(), body["refresh_token"].(string))
+		if err != nil {
+			WriteError(w, tokenError(err))
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		JSON(w, pair, http.StatusOK)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// RevokeTokenHandler revokes the access or refresh "token" of the JSON body. As RFC 7009 asks,
+// unknown tokens are answered with a 200 too.
+func RevokeTokenHandler(issuer *TokenIssuer) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		body, err := GetValidatedBody(r, VMap{"token": RequiredStringValidators("token")})
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		if err := issuer.Revoke(r.Context(), body["token"].(string)); err != nil {
+			WriteError(w, err)
+			return
+		}
+		JSON(w, map[string]interface{}{}, http.StatusOK)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Tokens mounts RefreshTokenHandler and RevokeTokenHandler as prefix/refresh and prefix/revoke.
+func (self *Router) Tokens(prefix string, issuer *TokenIssuer, mws ...func(http.Handler) http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	self.Post(prefix+"/refresh", RefreshTokenHandler(issuer), mws...)
+	self.Post(prefix+"/revoke", RevokeTokenHandler(issuer), mws...)
+}
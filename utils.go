@@ -3,13 +3,13 @@ package httputils
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/julienschmidt/httprouter"
 	"github.com/ti/mdb"
 	"gopkg.in/mgo.v2/bson"
-	"log"
-	"math/rand"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -19,10 +19,15 @@ func wrapHandler(h http.Handler) httprouter.Handle {
 		for _, value := range ps {
 			params[value.Key] = value.Value
 		}
-		h.ServeHTTP(w, SetInContext(params, "params", r))
+		h.ServeHTTP(w, SetParams(params, r))
 	}
 }
 
+// SetParams stores path params where Params and GetValueFromURLInRequest read them.
+func SetParams(params map[string]string, req *http.Request) *http.Request {
+	return SetInContext(params, ParamsKey, SetInContext(params, legacyParamsKey, req))
+}
+
 func SetInContext(value interface{}, key interface{}, req *http.Request) *http.Request {
 	ctx := context.WithValue(req.Context(), key, value)
 	return req.WithContext(ctx)
@@ -38,27 +43,35 @@ func ConvertMapToValue(value interface{}, jsonMap map[string]interface{}) error
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
+// RandStringBytes returns n random letters. It is now backed by crypto/rand.
+//
+// Deprecated: use SecureToken, or SecureHex and SecureBase64URL for denser tokens.
 func RandStringBytes(n int) string {
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
-	}
-	return string(b)
+	return SecureToken(n)
 }
 
+// JSON writes value with status code. Values that cannot be encoded are logged and answered
+// with a 500; use WriteJSON to handle that and write errors yourself.
 func JSON(w http.ResponseWriter, value interface{}, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
 	bytes, err := json.Marshal(value)
 	if err != nil {
-		panic(err)
+		writeMarshalError(w, err)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	w.Write(bytes)
 }
 
+// DefaultMiddlewaresFactory is the fixed stack used before Config existed; BuildMiddlewares
+// assembles a configurable one.
 func DefaultMiddlewaresFactory(secret string) func(http.Handler) http.Handler {
+	return DefaultMiddlewaresFactoryWithLogger(secret, DefaultLogger)
+}
+
+func DefaultMiddlewaresFactoryWithLogger(secret string, logger Logger) func(http.Handler) http.Handler {
 	f := func(next http.Handler) http.Handler {
-		return AccessMiddlewareFactory(secret)(RecoverMiddleware(LoggingMiddleware(next)))
+		return RequestIDMiddleware(AccessMiddlewareFactory(secret)(RecoverMiddleware(LoggingMiddlewareFactory(logger)(next))))
 	}
 	return f
 }
@@ -87,7 +100,7 @@ func UnwrapOrDefaultBool(value *bool, d bool) bool {
 func AccessMiddlewareFactory(secret string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			if r.Header.Get("Secret") != secret {
+			if !ConstantTimeEqual(r.Header.Get("Secret"), secret) {
 				HTTP403().Write(w)
 				return
 			}
@@ -100,24 +113,23 @@ func AccessMiddlewareFactory(secret string) func(http.Handler) http.Handler {
 
 func WriteResponseOrError(w http.ResponseWriter, code int, response interface{}, err error) {
 	if err != nil {
-		err.(ServerError).Write(w)
+		WriteError(w, err)
 		return
 	}
-	JSON(w, response, code)
+	Respond(w, code, response, nil)
 }
 
-func RecoverMiddleware(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				raise500(w, err)
-			}
-		}()
+// ErrorHandler is a handler that returns its error instead of writing it with WriteError.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request) error
 
-		next.ServeHTTP(w, r)
+func (self ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := self(w, r); err != nil {
+		WriteError(w, err)
 	}
+}
 
-	return http.HandlerFunc(fn)
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return RecoverMiddlewareFactory(RecoverConfig{Logger: DefaultLogger})(next)
 }
 
 func Now() int64 {
@@ -125,14 +137,30 @@ func Now() int64 {
 }
 
 func LoggingMiddleware(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		t1 := time.Now()
-		next.ServeHTTP(w, r)
-		t2 := time.Now()
-		log.Printf("[%s] %q %v\n", r.Method, r.URL.String(), t2.Sub(t1))
-	}
+	return LoggingMiddlewareFactory(DefaultLogger)(next)
+}
 
-	return http.HandlerFunc(fn)
+func LoggingMiddlewareFactory(logger Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			t1 := time.Now()
+			recorder := NewResponseRecorder(w)
+			r = SetLogger(WithFields(RedactingLogger(logger, DefaultRedaction), Fields{"request_id": GetRequestID(r)}), r)
+			next.ServeHTTP(recorder, r)
+			t2 := time.Now()
+			logger.Log(InfoLevel, "request", Fields{
+				"method":     r.Method,
+				"path":       DefaultRedaction.URL(r.URL),
+				"status":     recorder.Status,
+				"bytes":      recorder.Size,
+				"latency":    t2.Sub(t1),
+				"request_id": GetRequestID(r),
+				"remote_ip":  ClientIP(r),
+			})
+		}
+
+		return http.HandlerFunc(fn)
+	}
 }
 
 func GetBody(req *http.Request) (map[string]interface{}, error) {
@@ -140,6 +168,10 @@ func GetBody(req *http.Request) (map[string]interface{}, error) {
 	var _map map[string]interface{}
 	err := decoder.Decode(&_map)
 	defer req.Body.Close()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, HTTP413()
+	}
 	if err != nil {
 		return nil, HTTP400()
 	}
@@ -198,7 +230,7 @@ func ApplySkipLimit(query *mdb.Query, skip *int, limit *int) *mdb.Query {
 }
 
 func GetValueFromURLInRequest(r *http.Request, key string) *string {
-	params := r.Context().Value("params").(map[string]string)
+	params := Params(r)
 	var value string
 	if len(params) > 0 {
 		value = params[key]
@@ -234,18 +266,44 @@ func contains(array []string, element string) bool {
 	return false
 }
 
-func Find(collection *mdb.Collection, q bson.M, skip *int, limit *int) (*interface{}, int) {
+func Find(collection *mdb.Collection, q bson.M, skip *int, limit *int) (*interface{}, int, error) {
+	return FindIn(context.Background(), NewMdbStore(collection), q, FindOptions{Skip: skip, Limit: limit})
+}
+
+func FindIn(ctx context.Context, store Store, q interface{}, opts FindOptions) (*interface{}, int, error) {
 	results := new(interface{})
-	query := collection.Find(q)
-	count, err := query.Count()
-	if err != nil {
-		panic(err)
+	count, err := FindInto(ctx, store, q, &results, opts)
+	return results, count, err
+}
+
+// FindInto decodes the documents matching q into results and returns how many documents match
+// q regardless of skip and limit. The count runs concurrently with the fetch and is -1 when
+// opts.SkipCount is set. Errors are returned as a 500 hiding the driver error from clients.
+func FindInto(ctx context.Context, store Store, q interface{}, results interface{}, opts FindOptions) (int, error) {
+	count := -1
+	var countErr error
+	var wg sync.WaitGroup
+	if !opts.SkipCount {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, countErr = store.Find(ctx, q).Count()
+		}()
+	}
+
+	query := store.Find(ctx, q)
+	if len(opts.Sort) > 0 {
+		query = query.Sort(opts.Sort...)
 	}
-	err = ApplySkipLimit(query, skip, limit).All(&results)
+	err := SkipLimit(query, opts.Skip, opts.Limit).All(results)
+	wg.Wait()
 	if err != nil {
-		panic(err)
+		return 0, Internal(err)
+	}
+	if countErr != nil {
+		return 0, Internal(countErr)
 	}
-	return results, count
+	return count, nil
 }
 
 func IntParameterFromRequest(r *http.Request, name string) *int {
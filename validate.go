@@ -0,0 +1,128 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+)
+
+func ValidatedBodyFromContext(ctx context.Context) map[string]interface{} {
+	body, _ := ctx.Value(BodyKey).(map[string]interface{})
+	return body
+}
+
+// ValidatedBody returns the body checked by WithBody. The request body itself has been consumed.
+func ValidatedBody(r *http.Request) map[string]interface{} {
+	return ValidatedBodyFromContext(r.Context())
+}
+
+func ValidatedQueryFromContext(ctx context.Context) map[string]interface{} {
+	query, _ := ctx.Value(QueryKey).(map[string]interface{})
+	return query
+}
+
+// ValidatedQuery returns the query values checked by WithQuery, keyed like its VMap.
+func ValidatedQuery(r *http.Request) map[string]interface{} {
+	return ValidatedQueryFromContext(r.Context())
+}
+
+// ContextValidator is a Validator that needs the request context, such as one querying a store.
+// It returns an Error for invalid values and any other error when the check itself failed.
+type ContextValidator func(ctx context.Context, value interface{}) error
+
+type CVMap map[string][]ContextValidator
+
+// ValidateMapContext runs the validators of the keys present in dictionary, stopping at the
+// first failing validator of each key like ValidateMap. The error is set when a check could not
+// be run.
+func ValidateMapContext(ctx context.Context, dictionary map[string]interface{}, validatorMap CVMap) ([]Error, error) {
+	errs := []Error{}
+	for key, validators := range validatorMap {
+		value, ok := dictionary[key]
+		if !ok || value == nil {
+			continue
+		}
+		for _, validator := range validators {
+			err := validator(ctx, value)
+			if err == nil {
+				continue
+			}
+			fieldError, ok := err.(Error)
+			if !ok {
+				return nil, err
+			}
+			errs = append(errs, fieldError)
+			break
+		}
+	}
+	return errs, nil
+}
+
+// ValidateBodyContext runs checks on a body that already passed its VMap, answering 400 on
+// failure.
+func ValidateBodyContext(ctx context.Context, body map[string]interface{}, checks ...CVMap) error {
+	errs := []Error{}
+	for _, validatorMap := range checks {
+		checkErrs, err := ValidateMapContext(ctx, body, validatorMap)
+		if err != nil {
+			return Internal(err)
+		}
+		errs = append(errs, checkErrs...)
+	}
+	if len(errs) > 0 {
+		return ServerError{400, Errors{Errors: errs}}
+	}
+	return nil
+}
+
+// WithBody decodes and validates the JSON body before the handler runs, answering 400 on
+// failure, and stores it for ValidatedBody. The checks run once validatorMap passes.
+func WithBody(validatorMap VMap, checks ...CVMap) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			body, err := GetValidatedBody(r, validatorMap)
+			if err == nil {
+				err = ValidateBodyContext(r.Context(), body, checks...)
+			}
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			if entry := AuditFromContext(r.Context()); entry != nil {
+				entry.body = body
+			}
+			next.ServeHTTP(w, SetInContext(body, BodyKey, r))
+		}
+
+		return describe(http.HandlerFunc(fn), func(route *Route) {
+			route.addValidators("body", validatorMap)
+		})
+	}
+}
+
+// WithQuery validates the query string values named in validatorMap before the handler runs,
+// answering 400 on failure, and stores them for ValidatedQuery.
+func WithQuery(validatorMap VMap) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			values := make(map[string]interface{})
+			for _, key := range MapKeys(validatorMap) {
+				if value := query.Get(key); value != "" {
+					values[key] = value
+				} else {
+					values[key] = nil
+				}
+			}
+			errs := ValidateMap(values, validatorMap)
+			if len(errs) > 0 {
+				ServerError{400, Errors{Errors: errs}}.Write(w)
+				return
+			}
+			next.ServeHTTP(w, SetInContext(values, QueryKey, r))
+		}
+
+		return describe(http.HandlerFunc(fn), func(route *Route) {
+			route.addValidators("query", validatorMap)
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"gopkg.in/mgo.v2/bson"
 	"log"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,7 +17,7 @@ type Validator func(value interface{}) error
 func NotEmptyValidator(key string) Validator {
 	return func(value interface{}) error {
 		if value == nil {
-			return Error{key, "Field is required", "REQUIRED_FIELD_ERROR", nil}
+			return Error{Key: key, Description: "Field is required", Code: CodeRequiredFieldError}
 		}
 		return nil
 	}
@@ -26,7 +27,7 @@ func StringValidator(key string) Validator {
 	return func(value interface{}) error {
 		_, ok := value.(string)
 		if !ok {
-			return Error{key, " Should be string", "TYPE_ERROR", []string{"string"}}
+			return Error{Key: key, Description: " Should be string", Code: CodeTypeError, Args: []string{"string"}}
 		}
 		return nil
 	}
@@ -36,7 +37,7 @@ func FloatValidator(key string) Validator {
 	return func(value interface{}) error {
 		_, ok := value.(float64)
 		if !ok {
-			return Error{key, " Should be float", "TYPE_ERROR", []string{"float"}}
+			return Error{Key: key, Description: " Should be float", Code: CodeTypeError, Args: []string{"float"}}
 		}
 		return nil
 	}
@@ -47,7 +48,7 @@ func BoolValidator(key string) Validator {
 	return func(value interface{}) error {
 		_, ok := value.(bool)
 		if !ok {
-			return Error{key, " Should be bool", "TYPE_ERROR", []string{"bool"}}
+			return Error{Key: key, Description: " Should be bool", Code: CodeTypeError, Args: []string{"bool"}}
 		}
 		return nil
 	}
@@ -58,7 +59,7 @@ func IntValidator(key string) Validator {
 		_, ok := value.(int)
 		_, ok = value.(int64)
 		if !ok {
-			return Error{key, " Should be int", "TYPE_ERROR", []string{"int"}}
+			return Error{Key: key, Description: " Should be int", Code: CodeTypeError, Args: []string{"int"}}
 		}
 		return nil
 	}
@@ -83,28 +84,34 @@ type Int64Range struct {
 func FloatInRangeValidator(key string, floatRange FloatRange) Validator {
 	return func(value interface{}) error {
 		float := value.(float64)
-		err := Error{key, "Invalid float", "FLOAT_RANGE_ERROR", nil}
-		if floatRange.Upper != nil && *floatRange.Upper < float {
-			return err
+		if (floatRange.Upper == nil || *floatRange.Upper >= float) && (floatRange.Bottom == nil || *floatRange.Bottom <= float) {
+			return nil
 		}
-		if floatRange.Bottom != nil && *floatRange.Bottom > float {
-			return err
+		meta := map[string]interface{}{"actual": float}
+		if floatRange.Bottom != nil {
+			meta["min"] = *floatRange.Bottom
 		}
-		return nil
+		if floatRange.Upper != nil {
+			meta["max"] = *floatRange.Upper
+		}
+		return Error{Key: key, Description: "Invalid float", Code: CodeFloatRangeError, Meta: meta}
 	}
 }
 
 func IntInRangeValidator(key string, intRange IntRange) Validator {
 	return func(value interface{}) error {
 		intValue := value.(int)
-		err := Error{key, "Invalid int", "INT_RANGE_ERROR", nil}
-		if intRange.Upper != nil && *intRange.Upper < intValue {
-			return err
+		if (intRange.Upper == nil || *intRange.Upper >= intValue) && (intRange.Bottom == nil || *intRange.Bottom <= intValue) {
+			return nil
 		}
-		if intRange.Bottom != nil && *intRange.Bottom > intValue {
-			return err
+		meta := map[string]interface{}{"actual": intValue}
+		if intRange.Bottom != nil {
+			meta["min"] = *intRange.Bottom
 		}
-		return nil
+		if intRange.Upper != nil {
+			meta["max"] = *intRange.Upper
+		}
+		return Error{Key: key, Description: "Invalid int", Code: CodeIntRangeError, Meta: meta}
 	}
 }
 
@@ -112,14 +119,17 @@ func IntInRangeValidator(key string, intRange IntRange) Validator {
 func Int64InRangeValidator(key string, intRange Int64Range) Validator {
 	return func(value interface{}) error {
 		intValue := value.(int64)
-		err := Error{key, "Invalid int", "INT_RANGE_ERROR", nil}
-		if intRange.Upper != nil && *intRange.Upper < intValue {
-			return err
+		if (intRange.Upper == nil || *intRange.Upper >= intValue) && (intRange.Bottom == nil || *intRange.Bottom <= intValue) {
+			return nil
 		}
-		if intRange.Bottom != nil && *intRange.Bottom > intValue {
-			return err
+		meta := map[string]interface{}{"actual": intValue}
+		if intRange.Bottom != nil {
+			meta["min"] = *intRange.Bottom
 		}
-		return nil
+		if intRange.Upper != nil {
+			meta["max"] = *intRange.Upper
+		}
+		return Error{Key: key, Description: "Invalid int", Code: CodeIntRangeError, Meta: meta}
 	}
 }
 
@@ -127,7 +137,17 @@ func ObjectIDValidator(key string) Validator {
 	return func(value interface{}) error {
 		str := value.(string)
 		if !bson.IsObjectIdHex(str) {
-			return Error{key, " Should be object id", "TYPE_ERROR", []string{"ObjectId"}}
+			return Error{Key: key, Description: " Should be object id", Code: CodeTypeError, Args: []string{"ObjectId"}}
+		}
+		return nil
+	}
+}
+
+func UUIDValidator(key string) Validator {
+	return func(value interface{}) error {
+		str := value.(string)
+		if !IsUUID(str) {
+			return Error{Key: key, Description: " Should be uuid", Code: CodeTypeError, Args: []string{"UUID"}}
 		}
 		return nil
 	}
@@ -138,8 +158,9 @@ func StringLengthValidator(length int, key string) Validator {
 	return func(value interface{}) error {
 		stringValue := value.(string)
 		if len(stringValue) < length {
-			return Error{key, fmt.Sprintf("%@ should be minimum %d characters", strings.ToUpper(key), length),
-				"STRING_LENGTH_ERROR", []string{key, "5"}}
+			return Error{Key: key, Description: fmt.Sprintf("%s should be minimum %d characters", strings.ToUpper(key), length),
+				Code: CodeStringLengthError, Args: []string{key, strconv.Itoa(length)},
+				Meta: map[string]interface{}{"min": length, "actual": len(stringValue)}}
 
 		}
 		return nil
@@ -150,7 +171,7 @@ func ArrayValidator(key string) Validator {
 	return func(value interface{}) error {
 		_, ok := value.([]interface{})
 		if !ok {
-			return Error{key, "Should be array", "TYPE_ERROR", []string{"array"}}
+			return Error{Key: key, Description: "Should be array", Code: CodeTypeError, Args: []string{"array"}}
 		}
 		return nil
 	}
@@ -163,7 +184,7 @@ func StringArrayValidator(key string, each []Validator) Validator {
 		for _, item := range values {
 			str, ok := item.(string)
 			if !ok {
-				return Error{key, "Should be string in array", "TYPE_ERROR", []string{"string", "array"}}
+				return Error{Key: key, Description: "Should be string in array", Code: CodeTypeError, Args: []string{"string", "array"}}
 			}
 			strArr = append(strArr, str)
 		}
@@ -183,7 +204,7 @@ func LanguageValidator(key string) Validator {
 	return func(value interface{}) error {
 		stringValue := value.(string)
 		if !langreg.IsValidLanguageCode(stringValue) {
-			return Error{key, "Invalid language", "INVALID_LANGUAGE_ERROR", []string{stringValue}}
+			return Error{Key: key, Description: "Invalid language", Code: CodeInvalidLanguageError, Args: []string{stringValue}}
 
 		}
 		return nil
@@ -196,7 +217,7 @@ func URLValidator(key string) Validator {
 
 		_, err := url.Parse(stringValue)
 		if err != nil {
-			return Error{key, "Invalid url", "INVALID_URL_ERROR", nil}
+			return Error{Key: key, Description: "Invalid url", Code: CodeInvalidURLError}
 		}
 		return nil
 	}
@@ -217,8 +238,9 @@ func StringContainsValidator(key string, values []string) Validator {
 			}
 		}
 		if !contains {
-			return Error{key, fmt.Sprintf("Invalid %s", key),
-				fmt.Sprintf("INVALID_%s_ERROR", strings.ToUpper(key)), nil}
+			return Error{Key: key, Description: fmt.Sprintf("Invalid %s", key),
+				Code: fmt.Sprintf("INVALID_%s_ERROR", strings.ToUpper(key)),
+				Meta: map[string]interface{}{"allowed": values}}
 		}
 		return nil
 	}
@@ -250,7 +272,7 @@ func TimezoneValidator(key string) Validator {
 	return func(value interface{}) error {
 		stringValue := value.(string)
 		if !contains(timezones, stringValue) {
-			return Error{key, "Invalid timezone", "INVALID_TIMEZONE_ERROR", nil}
+			return Error{Key: key, Description: "Invalid timezone", Code: CodeInvalidTimezoneError}
 		}
 		return nil
 	}
@@ -270,7 +292,7 @@ func DateTimeValidator(key string, t *time.Time) Validator {
 		}
 
 		if err != nil {
-			return Error{key, "Invalid datetime", "INVALID_DATETIME_ERROR", nil}
+			return Error{Key: key, Description: "Invalid datetime", Code: CodeInvalidDatetimeError}
 		}
 		return nil
 	}
@@ -280,7 +302,7 @@ func CountryValidator(key string) Validator {
 	return func(value interface{}) error {
 		stringValue := value.(string)
 		if !langreg.IsValidRegionCode(stringValue) {
-			return Error{key, "Invalid country", "INVALID_COUNTRY_ERROR", nil}
+			return Error{Key: key, Description: "Invalid country", Code: CodeInvalidCountryError}
 		}
 		return nil
 	}
@@ -0,0 +1,205 @@
+package httputils
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type WebSocketConfig struct {
+	Upgrader websocket.Upgrader
+	// PingInterval must be shorter than PongWait.
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteWait    time.Duration
+	ReadLimit    int64
+}
+
+var DefaultWebSocketConfig = WebSocketConfig{
+	PingInterval: 50 * time.Second,
+	PongWait:     60 * time.Second,
+	WriteWait:    10 * time.Second,
+	ReadLimit:    1 << 20,
+}
+
+// WebSocketConn is a connection with JSON framing, write deadlines and ping/pong keepalive.
+// WriteJSON is safe for concurrent use; reads must happen from a single goroutine.
+type WebSocketConn struct {
+	*websocket.Conn
+	config WebSocketConfig
+	mutex  sync.Mutex
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Upgrade switches the request to the WebSocket protocol. Failed handshakes are answered with
+// the package's JSON errors.
+func Upgrade(w http.ResponseWriter, r *http.Request, config WebSocketConfig) (*WebSocketConn, error) {
+	upgrader := config.Upgrader
+	if upgrader.Error == nil {
+		upgrader.Error = func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			ServerError{status, Errors{[]Error{UndefinedKeyError(CodeInvalidRequest, reason.Error())}}}.Write(w)
+		}
+	}
+	ws, err := upgrader.Upgrade(hijackableWriter{w}, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn := &WebSocketConn{Conn: ws, config: config, done: make(chan struct{})}
+	if config.ReadLimit > 0 {
+		ws.SetReadLimit(config.ReadLimit)
+	}
+	if config.PongWait > 0 {
+		ws.SetReadDeadline(time.Now().Add(config.PongWait))
+		ws.SetPongHandler(func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(config.PongWait))
+		})
+	}
+	if config.PingInterval > 0 {
+		go conn.ping()
+	}
+	return conn, nil
+}
+
+func (self *WebSocketConn) ping() {
+	ticker := time.NewTicker(self.config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := self.WriteControl(websocket.PingMessage, nil, self.deadline()); err != nil {
+				return
+			}
+		case <-self.done:
+			return
+		}
+	}
+}
+
+func (self *WebSocketConn) deadline() time.Time {
+	if self.config.WriteWait <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(self.config.WriteWait)
+}
+
+func (self *WebSocketConn) WriteJSON(v interface{}) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.SetWriteDeadline(self.deadline())
+	return self.Conn.WriteJSON(v)
+}
+
+func (self *WebSocketConn) writePrepared(message *websocket.PreparedMessage) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.SetWriteDeadline(self.deadline())
+	return self.Conn.WritePreparedMessage(message)
+}
+
+// Close stops the keepalive and closes the underlying connection. It is safe to call twice.
+func (self *WebSocketConn) Close() error {
+	var err error
+	self.once.Do(func() {
+		close(self.done)
+		err = self.Conn.Close()
+	})
+	return err
+}
+
+// WebSocketHandler upgrades the request and runs fn with the connection, closing it when fn
+// returns. Route middlewares such as authentication run before the upgrade.
+func WebSocketHandler(config WebSocketConfig, fn func(conn *WebSocketConn, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, config)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fn(conn, r)
+	})
+}
+
+// WebSocket registers a GET route upgraded with DefaultWebSocketConfig.
+func (self *Router) WebSocket(path string, fn func(conn *WebSocketConn, r *http.Request), mws ...func(http.Handler) http.Handler) {
+	self.handle(http.MethodGet, path, WebSocketHandler(DefaultWebSocketConfig, fn), mws)
+}
+
+// hijackableWriter lets the upgrader hijack connections through wrapping writers that only
+// expose the original one via Unwrap.
+type hijackableWriter struct {
+	http.ResponseWriter
+}
+
+func (self hijackableWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(self.ResponseWriter).Hijack()
+}
+
+func (self hijackableWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+// WebSocketHub fans messages out to a set of connections.
+type WebSocketHub struct {
+	mutex sync.RWMutex
+	conns map[*WebSocketConn]struct{}
+}
+
+func NewWebSocketHub() *WebSocketHub {
+	return &WebSocketHub{conns: make(map[*WebSocketConn]struct{})}
+}
+
+func (self *WebSocketHub) Add(conn *WebSocketConn) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.conns[conn] = struct{}{}
+}
+
+func (self *WebSocketHub) Remove(conn *WebSocketConn) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.conns, conn)
+}
+
+func (self *WebSocketHub) Len() int {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return len(self.conns)
+}
+
+// Broadcast encodes v once and writes it to every connection concurrently. Connections that
+// fail to receive it are closed and removed.
+func (self *WebSocketHub) Broadcast(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	message, err := websocket.NewPreparedMessage(websocket.TextMessage, data)
+	if err != nil {
+		return err
+	}
+	self.mutex.RLock()
+	conns := make([]*WebSocketConn, 0, len(self.conns))
+	for conn := range self.conns {
+		conns = append(conns, conn)
+	}
+	self.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *WebSocketConn) {
+			defer wg.Done()
+			if conn.writePrepared(message) != nil {
+				self.Remove(conn)
+				conn.Close()
+			}
+		}(conn)
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,425 @@
+package httputils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html/charset"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	XMLContentType  = "application/xml"
+	SOAPEnvelopeNS  = "http://schemas.xmlsoap.org/soap/envelope/"
+	xsiNamespace    = "http://www.w3.org/2001/XMLSchema-instance"
+	xmlTextKey      = "#text"
+	xmlAttributeKey = "@"
+)
+
+// XMLOptions describes how XML bodies map to the documents validators check.
+//
+// Elements become keys by local name, ignoring namespaces. Elements holding only text become
+// strings, others objects where attributes are "@name" keys and text is "#text". Repeated
+// elements become arrays; a single element is only an array when its xsi:type ends in "Array",
+// as SOAP encoded arrays do. Values typed with xsi:type as numbers or booleans are converted, so
+// FloatValidator and BoolValidator accept them, and xsi:nil elements are null.
+type XMLOptions struct {
+	// Envelope reads the first element of a SOAP Body instead of the root element, and wraps
+	// responses in an Envelope and Body, errors in a Fault.
+	Envelope bool
+	// Root names the root element of responses, "response" when empty.
+	Root string
+	// Infer also converts untyped "true", "false" and JSON numbers. "01234" stays a string but
+	// "42" does not, so leave it off when string fields may hold only digits.
+	Infer bool
+}
+
+var DefaultXMLOptions = XMLOptions{}
+
+var numberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// inferScalar converts "true", "false" and JSON numbers read from text formats to the types
+// decoded JSON holds, leaving other text, such as "01234", a string.
+func inferScalar(text string) interface{} {
+	if text == "true" || text == "false" {
+		return text == "true"
+	}
+	if numberRegexp.MatchString(text) {
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return number
+		}
+	}
+	return text
+}
+
+func xmlAttribute(start xml.StartElement, space string, local string) (string, bool) {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+func xmlScalar(text string, xsiType string, infer bool) (interface{}, error) {
+	if _, name, ok := strings.Cut(xsiType, ":"); ok {
+		xsiType = name
+	}
+	switch xsiType {
+	case "boolean":
+		return strconv.ParseBool(text)
+	case "int", "integer", "long", "short", "byte", "decimal", "float", "double",
+		"unsignedInt", "unsignedLong", "unsignedShort", "unsignedByte",
+		"positiveInteger", "negativeInteger", "nonNegativeInteger", "nonPositiveInteger":
+		return strconv.ParseFloat(text, 64)
+	case "":
+		if infer {
+			return inferScalar(text), nil
+		}
+	}
+	return text, nil
+}
+
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement, options XMLOptions) (interface{}, error) {
+	if isNil, _ := xmlAttribute(start, xsiNamespace, "nil"); isNil == "true" || isNil == "1" {
+		return nil, decoder.Skip()
+	}
+	xsiType, _ := xmlAttribute(start, xsiNamespace, "type")
+	isArray := strings.HasSuffix(xsiType, "Array")
+	values := map[string]interface{}{}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" || attr.Name.Space == xsiNamespace {
+			continue
+		}
+		values[xmlAttributeKey+attr.Name.Local] = attr.Value
+	}
+	var items []interface{}
+	var text strings.Builder
+	children := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch typed := token.(type) {
+		case xml.StartElement:
+			children = true
+			child, err := decodeXMLElement(decoder, typed, options)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, child)
+			name := typed.Name.Local
+			switch current := values[name].(type) {
+			case nil:
+				if _, ok := values[name]; !ok {
+					values[name] = child
+				} else {
+					values[name] = []interface{}{nil, child}
+				}
+			case []interface{}:
+				values[name] = append(current, child)
+			default:
+				values[name] = []interface{}{current, child}
+			}
+		case xml.CharData:
+			text.Write(typed)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if isArray {
+				if items == nil {
+					items = []interface{}{}
+				}
+				return items, nil
+			}
+			if !children && len(values) == 0 {
+				return xmlScalar(content, xsiType, options.Infer)
+			}
+			if content != "" {
+				values[xmlTextKey] = content
+			}
+			return values, nil
+		}
+	}
+}
+
+func nextXMLStart(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch typed := token.(type) {
+		case xml.StartElement:
+			return typed, nil
+		case xml.EndElement:
+			return xml.StartElement{}, errors.New("element has no children")
+		}
+	}
+}
+
+// DecodeXML decodes the document read from reader, encoded in label when it is not empty and
+// as its XML declaration says otherwise. The result holds the children of the root element, or
+// of the first element of the SOAP Body with Envelope.
+func DecodeXML(reader io.Reader, label string, options XMLOptions) (map[string]interface{}, error) {
+	if label != "" {
+		converted, err := charset.NewReaderLabel(label, reader)
+		if err != nil {
+			return nil, err
+		}
+		reader = converted
+	}
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = func(declared string, input io.Reader) (io.Reader, error) {
+		if label != "" {
+			return input, nil
+		}
+		return charset.NewReaderLabel(declared, input)
+	}
+	start, err := nextXMLStart(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if options.Envelope {
+		if start.Name.Local != "Envelope" {
+			return nil, fmt.Errorf("root element is %s, not Envelope", start.Name.Local)
+		}
+		for start.Name.Local != "Body" {
+			if start, err = nextXMLStart(decoder); err != nil {
+				return nil, err
+			}
+			if start.Name.Local != "Body" {
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if start, err = nextXMLStart(decoder); err != nil {
+			return nil, err
+		}
+	}
+	value, err := decodeXMLElement(decoder, start, options)
+	if err != nil {
+		return nil, err
+	}
+	if document, ok := value.(map[string]interface{}); ok {
+		return document, nil
+	}
+	return map[string]interface{}{}, nil
+}
+
+// GetXMLBodyWithOptions decodes the XML body of req like GetBody does JSON, using the charset
+// parameter of its Content-Type when present.
+func GetXMLBodyWithOptions(req *http.Request, options XMLOptions) (map[string]interface{}, error) {
+	defer req.Body.Close()
+	_, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	body, err := DecodeXML(req.Body, params["charset"], options)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, HTTP413()
+	}
+	if err != nil {
+		return nil, HTTP400()
+	}
+	return body, nil
+}
+
+func GetXMLBody(req *http.Request) (map[string]interface{}, error) {
+	return GetXMLBodyWithOptions(req, DefaultXMLOptions)
+}
+
+func GetValidatedXMLBody(req *http.Request, validatorMap VMap) (map[string]interface{}, error) {
+	body, err := GetXMLBody(req)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateBody(body, validatorMap)
+}
+
+func encodeXMLValue(encoder *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if document, ok := asDocument(value); ok {
+		keys := make([]string, 0, len(document))
+		for key := range document {
+			if strings.HasPrefix(key, xmlAttributeKey) {
+				start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: key[1:]}, Value: fmt.Sprint(document[key])})
+			} else if key != xmlTextKey {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		sort.Slice(start.Attr, func(i, j int) bool { return start.Attr[i].Name.Local < start.Attr[j].Name.Local })
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		if text, ok := document[xmlTextKey]; ok {
+			if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(text))); err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			if err := encodeXMLValue(encoder, key, document[key]); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	}
+	switch typed := value.(type) {
+	case nil:
+		return encoder.EncodeElement("", start)
+	case []interface{}:
+		for _, item := range typed {
+			if err := encodeXMLValue(encoder, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []map[string]interface{}:
+		for _, item := range typed {
+			if err := encodeXMLValue(encoder, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case float64:
+		return encoder.EncodeElement(strconv.FormatFloat(typed, 'f', -1, 64), start)
+	}
+	return encoder.EncodeElement(value, start)
+}
+
+// Marshal encodes value under the root element of options, in a SOAP Envelope and Body with
+// Envelope. Documents are written with the mapping DecodeXML reads and other values with
+// encoding/xml, which names the root element itself.
+func (self XMLOptions) Marshal(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buffer)
+	var wrappers []xml.StartElement
+	if self.Envelope {
+		wrappers = []xml.StartElement{
+			{Name: xml.Name{Local: "soap:Envelope"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:soap"}, Value: SOAPEnvelopeNS}}},
+			{Name: xml.Name{Local: "soap:Body"}},
+		}
+	}
+	for _, wrapper := range wrappers {
+		if err := encoder.EncodeToken(wrapper); err != nil {
+			return nil, err
+		}
+	}
+	root := self.Root
+	if root == "" {
+		root = "response"
+	}
+	var err error
+	switch value.(type) {
+	case map[string]interface{}, []interface{}, []map[string]interface{}, nil:
+		err = encodeXMLValue(encoder, root, value)
+	default:
+		if _, ok := asDocument(value); ok {
+			err = encodeXMLValue(encoder, root, value)
+		} else {
+			err = encoder.Encode(value)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		if err := encoder.EncodeToken(wrappers[i].End()); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// contentType is text/xml for SOAP 1.1 envelopes and application/xml otherwise.
+func (self XMLOptions) contentType() string {
+	if self.Envelope {
+		return "text/xml; charset=utf-8"
+	}
+	return XMLContentType + "; charset=utf-8"
+}
+
+// Write writes value as UTF-8 XML with status code, answering 500 when it cannot be encoded.
+func (self XMLOptions) Write(w http.ResponseWriter, value interface{}, code int) {
+	body, err := self.Marshal(value)
+	if err != nil {
+		writeMarshalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", self.contentType())
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+func XML(w http.ResponseWriter, value interface{}, code int) {
+	DefaultXMLOptions.Write(w, value, code)
+}
+
+type xmlError struct {
+	Key         string   `xml:"key"`
+	Description string   `xml:"description"`
+	Code        string   `xml:"code"`
+	Args        []string `xml:"args>arg,omitempty"`
+}
+
+type xmlErrors struct {
+	XMLName xml.Name   `xml:"errors"`
+	Errors  []xmlError `xml:"error"`
+}
+
+type soapFault struct {
+	XMLName     xml.Name  `xml:"soap:Fault"`
+	FaultCode   string    `xml:"faultcode"`
+	FaultString string    `xml:"faultstring"`
+	Detail      xmlErrors `xml:"detail>errors"`
+}
+
+// XMLErrorSerializer writes errors as an errors element listing each error, inside a SOAP
+// Fault with Envelope.
+func XMLErrorSerializer(options XMLOptions) ErrorSerializer {
+	return func(w http.ResponseWriter, serverError ServerError) {
+		errs := xmlErrors{}
+		for _, item := range serverError.Errors.Errors {
+			errs.Errors = append(errs.Errors, xmlError{item.Key, item.Description, item.Code, item.Args})
+		}
+		var value interface{} = errs
+		if options.Envelope {
+			fault := soapFault{FaultCode: "soap:Client", FaultString: http.StatusText(serverError.StatusCode), Detail: errs}
+			if serverError.StatusCode >= 500 {
+				fault.FaultCode = "soap:Server"
+			}
+			value = fault
+		}
+		body, err := options.Marshal(value)
+		if err != nil {
+			JSONErrorSerializer(w, serverError)
+			return
+		}
+		w.Header().Set("Content-Type", options.contentType())
+		w.WriteHeader(serverError.StatusCode)
+		w.Write(body)
+	}
+}
+
+// XMLErrorsMiddlewareFactory writes the errors of the routes it wraps with XMLErrorSerializer.
+func XMLErrorsMiddlewareFactory(options XMLOptions) func(http.Handler) http.Handler {
+	serializer := XMLErrorSerializer(options)
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(serializerResponseWriter{w, serializer}, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}